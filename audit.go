@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// auditEntry records one mutation performed by a run, as a line of the -audit-file.
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Project string    `json:"project"`
+	// Action is what we did, e.g. create-project or enable-services.
+	Action string `json:"action"`
+	// Target is what we did it to, e.g. the services or the command.
+	Target  string `json:"target,omitempty"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// auditLog appends auditEntries to a file as JSON lines.
+type auditLog struct {
+	mutex sync.Mutex
+	f     *os.File
+}
+
+// openAuditLog opens (or creates) the audit file at path for appending.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit file %q: %w", path, err)
+	}
+	return &auditLog{f: f}, nil
+}
+
+// Close closes the audit file.
+func (a *auditLog) Close() error {
+	return a.f.Close()
+}
+
+// write appends the entry to the audit file.
+func (a *auditLog) write(entry *auditEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit entry: %w", err)
+	}
+	b = append(b, '\n')
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, err := a.f.Write(b); err != nil {
+		return fmt.Errorf("error writing audit entry: %w", err)
+	}
+	return nil
+}
+
+// audit records a mutation we attempted on the project, and its outcome (err is nil on success).
+// It does nothing if -audit-file is not set. Failures to write the audit file are logged, not returned,
+// so that they do not mask the outcome of the mutation itself.
+func (p *ProjectManager) audit(ctx context.Context, projectName string, action string, target string, err error) {
+	if p.auditLog == nil {
+		return
+	}
+	entry := &auditEntry{
+		Time:    time.Now().UTC(),
+		Project: projectName,
+		Action:  action,
+		Target:  target,
+		Outcome: "success",
+	}
+	if err != nil {
+		entry.Outcome = "failure"
+		entry.Error = err.Error()
+	}
+	if writeErr := p.auditLog.write(entry); writeErr != nil {
+		klog.FromContext(ctx).Error(writeErr, "unable to record mutation in audit file", "action", action, "project", projectName)
+	}
+}
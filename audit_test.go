@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestAuditEntriesForRun(t *testing.T) {
+	const account = "billingAccounts/012345-6789AB-CDEF01"
+
+	api := newFakeAPI(t)
+	var created atomic.Bool
+	api.handle("GET /v3/projects/abc-test-1", func(w http.ResponseWriter, r *http.Request) {
+		if !created.Load() {
+			writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "project not found")
+			return
+		}
+		writeJSON(w, &cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1"})
+	})
+	api.handle("POST /v3/projects", func(w http.ResponseWriter, r *http.Request) {
+		created.Store(true)
+		writeJSON(w, &cloudresourcemanager.Operation{Name: "operations/cp.123", Done: true})
+	})
+	api.handle("GET /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{}))
+	api.handle("PUT /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{BillingAccountName: account, BillingEnabled: true}))
+	api.handleIAMPolicy("abc-test-1", &cloudresourcemanager.Policy{})
+
+	_, suClient := newFakeServiceUsage(t)
+
+	config := &Config{
+		NamePattern:    "abc-test-1",
+		BillingAccount: account,
+		Services:       []string{"compute.googleapis.com"},
+		IAMBindings:    []IAMBinding{{Role: "roles/viewer", Members: []string{"group:dev@example.com"}}},
+		SetupCommands:  []string{"true", "exit 3"},
+	}
+	p := newTestProjectManager(t, config, api, suClient)
+	p.identity = &fakeIdentity{email: "ci@example.iam.gserviceaccount.com"}
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := openAuditLog(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.auditLog = auditLog
+
+	ctx := context.Background()
+	for _, phase := range config.EffectivePhases() {
+		err := p.RunPhase(ctx, "abc-test-1", phase)
+		if phase == PhaseSetup {
+			if err == nil {
+				t.Errorf("expected the failing setup command to fail the setup phase")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("phase %s: %v", phase, err)
+		}
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	type summary struct{ Action, Target, Outcome string }
+	var got []summary
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("audit line %q is not valid JSON: %v", scanner.Text(), err)
+		}
+		if entry.Project != "abc-test-1" || entry.Time.IsZero() {
+			t.Errorf("audit entry is missing its project or time: %+v", entry)
+		}
+		if (entry.Outcome == "failure") != (entry.Error != "") {
+			t.Errorf("audit entry has an inconsistent outcome: %+v", entry)
+		}
+		got = append(got, summary{entry.Action, entry.Target, entry.Outcome})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []summary{
+		{"create-project", "", "success"},
+		{"enable-services", "cloudbilling.googleapis.com", "success"},
+		{"link-billing", account, "success"},
+		{"enable-services", "compute.googleapis.com", "success"},
+		{"set-iam-policy", "", "success"},
+		{"run-setup-command", "true", "success"},
+		{"run-setup-command", "exit 3", "failure"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got audit entries\n%v\nwant\n%v", got, want)
+	}
+}
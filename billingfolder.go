@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"k8s.io/klog/v2"
+)
+
+// maxBillingSiblingProjects caps how many sibling projects we inspect when inheriting a billing account.
+const maxBillingSiblingProjects = 50
+
+// inheritBillingAccountFromFolder discovers the billing account used by the projects in the project's folder.
+// The heuristic is: list the active projects directly under the folder (skipping our own project),
+// read their billing info, and pick the billing account linked to the most of them.
+// We fail if the folder has no billed projects, or if two billing accounts are equally common.
+func (p *ProjectManager) inheritBillingAccountFromFolder(ctx context.Context, projectName string) (string, error) {
+	log := klog.FromContext(ctx)
+
+	project, err := p.getProject(ctx, projectName)
+	if err != nil {
+		return "", err
+	}
+	parent := ""
+	if project != nil {
+		parent = project.Parent
+	} else {
+		parent, err = p.resolveParent(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !strings.HasPrefix(parent, "folders/") {
+		return "", fmt.Errorf("cannot inherit billing account: parent of project %q is %q, not a folder", projectName, parent)
+	}
+
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	billingService, err := p.getCloudBillingClient(ctx, projectName)
+	if err != nil {
+		return "", err
+	}
+
+	var siblings []string
+	if err := crmService.Projects.List().Parent(parent).Pages(ctx, func(resp *cloudresourcemanager.ListProjectsResponse) error {
+		for _, sibling := range resp.Projects {
+			if sibling.ProjectId == projectName || sibling.State != "ACTIVE" {
+				continue
+			}
+			if len(siblings) < maxBillingSiblingProjects {
+				siblings = append(siblings, sibling.ProjectId)
+			}
+		}
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("error listing projects in %q: %w", parent, err)
+	}
+
+	counts := make(map[string]int)
+	for _, sibling := range siblings {
+		billingInfo, err := billingService.Projects.GetBillingInfo("projects/" + sibling).Context(ctx).Do()
+		if err != nil {
+			if isPermissionDenied(err) {
+				log.V(2).Info("cannot read billing info of sibling project, skipping", "project", sibling)
+				continue
+			}
+			return "", fmt.Errorf("error getting billing info for project %q: %w", sibling, err)
+		}
+		if billingInfo.BillingAccountName != "" && billingInfo.BillingEnabled {
+			counts[billingInfo.BillingAccountName]++
+		}
+	}
+
+	if len(counts) == 0 {
+		return "", fmt.Errorf("cannot inherit billing account: none of the %d projects we inspected in %q have billing enabled", len(siblings), parent)
+	}
+
+	accounts := make([]string, 0, len(counts))
+	for account := range counts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return counts[accounts[i]] > counts[accounts[j]]
+	})
+	if len(accounts) > 1 && counts[accounts[0]] == counts[accounts[1]] {
+		return "", fmt.Errorf("cannot inherit billing account: billing accounts %q and %q are equally common in %q; set billingAccount explicitly", accounts[0], accounts[1], parent)
+	}
+
+	log.Info("inherited billing account from folder", "folder", parent, "billingAccount", accounts[0], "projects", counts[accounts[0]], "inspected", len(siblings))
+	return accounts[0], nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// handleFolderBilling serves abc-test-1 under folders/123, with siblings in the folder linked to the given billing accounts.
+// An empty account means the sibling has billing disabled.
+func handleFolderBilling(api *fakeAPI, siblings map[string]string) {
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1", Parent: "folders/123"}))
+
+	projects := []*cloudresourcemanager.Project{
+		// Our own project and inactive projects are ignored.
+		{ProjectId: "abc-test-1", State: "ACTIVE"},
+		{ProjectId: "deleted", State: "DELETE_REQUESTED"},
+	}
+	for projectID, account := range siblings {
+		projects = append(projects, &cloudresourcemanager.Project{ProjectId: projectID, State: "ACTIVE"})
+		api.handle("GET /v1/projects/"+projectID+"/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{
+			BillingAccountName: account,
+			BillingEnabled:     account != "",
+		}))
+	}
+	api.handle("GET /v3/projects", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("parent"); got != "folders/123" {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "unexpected parent "+got)
+			return
+		}
+		writeJSON(w, &cloudresourcemanager.ListProjectsResponse{Projects: projects})
+	})
+}
+
+func TestInheritBillingAccountFromFolder(t *testing.T) {
+	const (
+		accountA = "billingAccounts/AAAAAA-AAAAAA-AAAAAA"
+		accountB = "billingAccounts/BBBBBB-BBBBBB-BBBBBB"
+	)
+
+	grid := []struct {
+		name     string
+		siblings map[string]string
+		want     string
+		wantErr  string
+	}{
+		{"majority wins", map[string]string{"s1": accountA, "s2": accountB, "s3": accountA, "s4": ""}, accountA, ""},
+		{"tie", map[string]string{"s1": accountA, "s2": accountB, "s3": ""}, "", "equally common"},
+		{"no billed projects", map[string]string{"s1": "", "s2": ""}, "", "none of the 2 projects"},
+		{"empty folder", nil, "", "none of the 0 projects"},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		handleFolderBilling(api, g.siblings)
+		p := newTestProjectManager(t, &Config{}, api, nil)
+
+		got, err := p.inheritBillingAccountFromFolder(context.Background(), "abc-test-1")
+		if g.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), g.wantErr) {
+				t.Errorf("%s: got %q, %v; want an error containing %q", g.name, got, err, g.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: inheritBillingAccountFromFolder: %v", g.name, err)
+			continue
+		}
+		if got != g.want {
+			t.Errorf("%s: got %q, want %q", g.name, got, g.want)
+		}
+	}
+}
+
+func TestInheritBillingAccountFromFolderNotAFolder(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1", Parent: "organizations/456"}))
+	p := newTestProjectManager(t, &Config{}, api, nil)
+
+	_, err := p.inheritBillingAccountFromFolder(context.Background(), "abc-test-1")
+	if err == nil || !strings.Contains(err.Error(), `"organizations/456", not a folder`) {
+		t.Errorf("got error %v, want an error that the parent is not a folder", err)
+	}
+	// The folder is not listed.
+	if got := api.CallCount("GET /v3/projects"); got != 0 {
+		t.Errorf("got %d project list calls, want none", got)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// serviceUsageConstraint is the org policy constraint that restricts which services can be enabled.
+const serviceUsageConstraint = "constraints/serviceuser.services"
+
+// isBlockedByOrgPolicy returns true if err is the (permanent) failure to enable a service that is denied
+// by the serviceuser.services org policy constraint. The error names the constraint in its message,
+// which distinguishes it from transient or permission failures.
+func isBlockedByOrgPolicy(err error) bool {
+	return err != nil && strings.Contains(err.Error(), serviceUsageConstraint)
+}
+
+// enableServicesSkippingBlocked is called when enabling services failed because at least one of them
+// is blocked by org policy. BatchEnableServices is all-or-nothing, so we enable the services one at a time,
+// skipping (and recording) those that are blocked. A service that fails (or times out, see -service-enable-timeout)
+// does not stop the others; the errors are reported together.
+func (p *ProjectManager) enableServicesSkippingBlocked(ctx context.Context, projectName string, services []string) error {
+	log := klog.FromContext(ctx)
+
+	if len(services) == 1 {
+		log.Info("WARNING: service is blocked by org policy, skipping", "service", services[0], "constraint", serviceUsageConstraint, "project", projectName)
+		p.result.ServicesBlockedByOrgPolicy = append(p.result.ServicesBlockedByOrgPolicy, services[0])
+		return nil
+	}
+
+	log.Info("a service is blocked by org policy, enabling services one at a time", "services", services, "project", projectName)
+	var errs []error
+	for _, serviceID := range services {
+		if err := p.enableSingleService(ctx, projectName, serviceID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enableSingleService enables one service, giving up after serviceEnableTimeout (if set),
+// so that one stuck service does not stall the services enabled after it.
+func (p *ProjectManager) enableSingleService(ctx context.Context, projectName string, serviceID string) error {
+	if p.serviceEnableTimeout <= 0 {
+		return p.EnableProjectServices(ctx, projectName, []string{serviceID})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.serviceEnableTimeout)
+	defer cancel()
+	err := p.EnableProjectServices(ctx, projectName, []string{serviceID})
+	// The gRPC deadline can fire just before ctx reports it.
+	if err != nil && (ctx.Err() != nil || status.Code(err) == codes.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %v enabling service %q: %w", p.serviceEnableTimeout, serviceID, err)
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEnableServicesSkipsBlockedByOrgPolicy(t *testing.T) {
+	blocked := func(services []string) error {
+		if slices.Contains(services, "bigquery.googleapis.com") {
+			return status.Error(codes.FailedPrecondition, "Constraint constraints/serviceuser.services violated for projects/abc-test-1 attempting to enable service bigquery.googleapis.com")
+		}
+		return nil
+	}
+	services := []string{"compute.googleapis.com", "bigquery.googleapis.com", "pubsub.googleapis.com"}
+
+	t.Run("skip enabled", func(t *testing.T) {
+		su, suClient := newFakeServiceUsage(t)
+		su.enableErr = blocked
+		p := newTestProjectManager(t, &Config{SkipServicesBlockedByOrgPolicy: true}, nil, suClient)
+
+		if err := p.EnableProjectServices(context.Background(), "abc-test-1", services); err != nil {
+			t.Fatalf("EnableProjectServices: %v", err)
+		}
+		for _, service := range []string{"compute.googleapis.com", "pubsub.googleapis.com"} {
+			if !su.Enabled(service) {
+				t.Errorf("expected %s to be enabled despite the blocked service", service)
+			}
+		}
+		if got, want := p.result.ServicesBlockedByOrgPolicy, []string{"bigquery.googleapis.com"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got blocked services %v, want %v", got, want)
+		}
+	})
+
+	t.Run("skip disabled", func(t *testing.T) {
+		su, suClient := newFakeServiceUsage(t)
+		su.enableErr = blocked
+		p := newTestProjectManager(t, &Config{}, nil, suClient)
+
+		if err := p.EnableProjectServices(context.Background(), "abc-test-1", services); err == nil {
+			t.Errorf("expected an error for the blocked service without skipServicesBlockedByOrgPolicy")
+		}
+		if len(p.result.ServicesBlockedByOrgPolicy) != 0 {
+			t.Errorf("expected no services recorded as blocked, got %v", p.result.ServicesBlockedByOrgPolicy)
+		}
+	})
+
+	t.Run("other failures are not skipped", func(t *testing.T) {
+		su, suClient := newFakeServiceUsage(t)
+		su.enableErr = func(services []string) error {
+			return status.Error(codes.PermissionDenied, "permission denied to enable service")
+		}
+		p := newTestProjectManager(t, &Config{SkipServicesBlockedByOrgPolicy: true}, nil, suClient)
+
+		if err := p.EnableProjectServices(context.Background(), "abc-test-1", services); err == nil {
+			t.Errorf("expected a permission error not to be treated as blocked by org policy")
+		}
+		if len(p.result.ServicesBlockedByOrgPolicy) != 0 {
+			t.Errorf("expected no services recorded as blocked, got %v", p.result.ServicesBlockedByOrgPolicy)
+		}
+	})
+}
+
+// slowService makes enabling service hang until the test ends, and blocks bigquery.googleapis.com by org policy.
+func slowService(t *testing.T, service string) func(services []string) error {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	return func(services []string) error {
+		if slices.Contains(services, "bigquery.googleapis.com") {
+			return status.Error(codes.FailedPrecondition, "Constraint constraints/serviceuser.services violated for projects/abc-test-1 attempting to enable service bigquery.googleapis.com")
+		}
+		if slices.Contains(services, service) {
+			<-done
+		}
+		return nil
+	}
+}
+
+func TestEnableServicesSkippingBlockedTimesOutSlowService(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	su.enableErr = slowService(t, "pubsub.googleapis.com")
+	p := newTestProjectManager(t, &Config{SkipServicesBlockedByOrgPolicy: true}, nil, suClient)
+	p.serviceEnableTimeout = 100 * time.Millisecond
+
+	services := []string{"compute.googleapis.com", "bigquery.googleapis.com", "pubsub.googleapis.com", "storage.googleapis.com"}
+	err := p.EnableProjectServices(context.Background(), "abc-test-1", services)
+	if err == nil || !strings.Contains(err.Error(), `timed out after 100ms enabling service "pubsub.googleapis.com"`) {
+		t.Fatalf("got error %v, want the slow service reported", err)
+	}
+	// The services after the slow one are still enabled.
+	for _, service := range []string{"compute.googleapis.com", "storage.googleapis.com"} {
+		if !su.Enabled(service) {
+			t.Errorf("expected %s to be enabled despite the slow service", service)
+		}
+	}
+	if got, want := p.result.ServicesBlockedByOrgPolicy, []string{"bigquery.googleapis.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got blocked services %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// projectIDTakenError is returned when the project ID is in use by a project other than ours.
+type projectIDTakenError struct {
+	err error
+}
+
+func (e *projectIDTakenError) Error() string {
+	return e.err.Error()
+}
+
+func (e *projectIDTakenError) Unwrap() error {
+	return e.err
+}
+
+// isProjectIDTaken returns true if err reports that the project ID is in use by another project,
+// in which case a different project ID could succeed.
+func isProjectIDTaken(err error) bool {
+	var takenErr *projectIDTakenError
+	return errors.As(err, &takenErr)
+}
+
+// isRandomizedPattern returns true if the pattern contains ${random} or ${random:N},
+// so that expanding it again gives a different project ID.
+func isRandomizedPattern(pattern string) bool {
+	return strings.Contains(pattern, "${random}") || strings.Contains(pattern, "${random:")
+}
+
+// retryOnIDCollision calls create with projectName. If the project ID is taken and pattern is randomized,
+// it expands the pattern again (with expand) and calls create with the new project ID, up to retries times.
+// It returns the project ID that was last tried.
+func retryOnIDCollision(ctx context.Context, pattern string, projectName string, retries int, expand func() (string, error), create func(projectName string) error) (string, error) {
+	log := klog.FromContext(ctx)
+
+	err := create(projectName)
+	if !isRandomizedPattern(pattern) {
+		return projectName, err
+	}
+	for retry := 1; retry <= retries && isProjectIDTaken(err); retry++ {
+		newName, expandErr := expand()
+		if expandErr == nil {
+			expandErr = validateProjectID(newName)
+		}
+		if expandErr != nil {
+			return projectName, fmt.Errorf("error expanding project name: %w", expandErr)
+		}
+		log.Info("project ID is taken, retrying with a new project ID", "taken", projectName, "name", newName, "retry", retry, "maxRetries", retries)
+		projectName = newName
+		err = create(projectName)
+	}
+	return projectName, err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestRetryOnIDCollision(t *testing.T) {
+	taken := &projectIDTakenError{fmt.Errorf("project ID is already in use")}
+
+	grid := []struct {
+		name        string
+		pattern     string
+		retries     int
+		createErrs  []error
+		wantName    string
+		wantErr     bool
+		wantCreated []string
+	}{
+		{
+			name:        "collision then success",
+			pattern:     "abc-${random}",
+			retries:     3,
+			createErrs:  []error{taken, nil},
+			wantName:    "abc-new1",
+			wantCreated: []string{"abc-first", "abc-new1"},
+		},
+		{
+			name:        "no collision",
+			pattern:     "abc-${random}",
+			retries:     3,
+			createErrs:  []error{nil},
+			wantName:    "abc-first",
+			wantCreated: []string{"abc-first"},
+		},
+		{
+			name:        "pattern without random is not retried",
+			pattern:     "abc-fixed",
+			retries:     3,
+			createErrs:  []error{taken},
+			wantName:    "abc-first",
+			wantErr:     true,
+			wantCreated: []string{"abc-first"},
+		},
+		{
+			name:        "other errors are not retried",
+			pattern:     "abc-${random}",
+			retries:     3,
+			createErrs:  []error{errors.New("permission denied")},
+			wantName:    "abc-first",
+			wantErr:     true,
+			wantCreated: []string{"abc-first"},
+		},
+		{
+			name:        "gives up after retries",
+			pattern:     "abc-${random:6}",
+			retries:     2,
+			createErrs:  []error{taken, taken, taken, nil},
+			wantName:    "abc-new2",
+			wantErr:     true,
+			wantCreated: []string{"abc-first", "abc-new1", "abc-new2"},
+		},
+	}
+
+	for _, g := range grid {
+		t.Run(g.name, func(t *testing.T) {
+			expanded := 0
+			expand := func() (string, error) {
+				expanded++
+				return fmt.Sprintf("abc-new%d", expanded), nil
+			}
+			var created []string
+			create := func(projectName string) error {
+				err := g.createErrs[len(created)]
+				created = append(created, projectName)
+				return err
+			}
+
+			name, err := retryOnIDCollision(context.Background(), g.pattern, "abc-first", g.retries, expand, create)
+			if (err != nil) != g.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if name != g.wantName {
+				t.Errorf("got name %q, want %q", name, g.wantName)
+			}
+			if !slices.Equal(created, g.wantCreated) {
+				t.Errorf("created %v, want %v", created, g.wantCreated)
+			}
+		})
+	}
+}
+
+func TestIsProjectIDTaken(t *testing.T) {
+	if !isProjectIDTaken(fmt.Errorf("creating: %w", &projectIDTakenError{errors.New("taken")})) {
+		t.Errorf("wrapped projectIDTakenError should be reported as taken")
+	}
+	if isProjectIDTaken(errors.New("other")) || isProjectIDTaken(nil) {
+		t.Errorf("other errors should not be reported as taken")
+	}
+}
+
+func TestExpandIAMBindingsProjectID(t *testing.T) {
+	bindings := []IAMBinding{{Role: "roles/viewer", Members: []string{"serviceAccount:ci@${PROJECT_ID}.iam.gserviceaccount.com"}}}
+
+	first, err := expandIAMBindings(bindings, "abc-first", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := expandIAMBindings(bindings, "abc-new1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := first[0].Members[0], "serviceAccount:ci@abc-first.iam.gserviceaccount.com"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := second[0].Members[0], "serviceAccount:ci@abc-new1.iam.gserviceaccount.com"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if bindings[0].Members[0] != "serviceAccount:ci@${PROJECT_ID}.iam.gserviceaccount.com" {
+		t.Errorf("expandIAMBindings modified its input: %v", bindings)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// loadEffectiveConfig loads, applies the environment to, and validates the config at path.
+func loadEffectiveConfig(path string, envName string) (*Config, error) {
+	config, err := loadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config %q: %w", path, err)
+	}
+	return prepareConfig(config, path, envName)
+}
+
+// prepareConfig applies the environment and the GCPX_* overrides to, and validates, a loaded config;
+// source names it in errors.
+func prepareConfig(config *Config, source string, envName string) (*Config, error) {
+	if envName != "" {
+		if err := applyEnvironment(config, envName); err != nil {
+			return nil, fmt.Errorf("error applying environment from config %q: %w", source, err)
+		}
+	}
+	if err := applyEnvOverrides(config); err != nil {
+		return nil, fmt.Errorf("error applying environment overrides to config %q: %w", source, err)
+	}
+	if err := validateConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid config %q: %w", source, err)
+	}
+	return config, nil
+}
+
+// compareConfigs writes the differences between the effective projects of two configs to w.
+// Projects are matched by namePattern. No API calls are made.
+func compareConfigs(w io.Writer, a *Config, b *Config, location *time.Location) error {
+	projectsA := configsByNamePattern(a)
+	projectsB := configsByNamePattern(b)
+
+	namePatterns := slices.Sorted(maps.Keys(projectsA))
+	for namePattern := range projectsB {
+		if _, found := projectsA[namePattern]; !found {
+			namePatterns = append(namePatterns, namePattern)
+		}
+	}
+
+	differences := 0
+	for _, namePattern := range namePatterns {
+		projectA, projectB := projectsA[namePattern], projectsB[namePattern]
+		switch {
+		case projectB == nil:
+			fmt.Fprintf(w, "project %s: removed\n", namePattern)
+			differences++
+			continue
+		case projectA == nil:
+			fmt.Fprintf(w, "project %s: added\n", namePattern)
+			differences++
+			continue
+		}
+
+		var lines []string
+		parentA, _, err := effectiveParent("", projectA, location)
+		if err != nil {
+			return err
+		}
+		parentB, _, err := effectiveParent("", projectB, location)
+		if err != nil {
+			return err
+		}
+		if parentA != parentB {
+			lines = append(lines, fmt.Sprintf("parent: %q -> %q", parentA, parentB))
+		}
+		if projectA.BillingAccount != projectB.BillingAccount {
+			lines = append(lines, fmt.Sprintf("billingAccount: %q -> %q", projectA.BillingAccount, projectB.BillingAccount))
+		}
+		if added := missingFrom(projectB.Services, projectA.Services); len(added) != 0 {
+			lines = append(lines, "services added: "+strings.Join(added, ", "))
+		}
+		if removed := missingFrom(projectA.Services, projectB.Services); len(removed) != 0 {
+			lines = append(lines, "services removed: "+strings.Join(removed, ", "))
+		}
+		if !slices.Equal(projectA.SetupCommands, projectB.SetupCommands) {
+			lines = append(lines, "setupCommands changed")
+		}
+		if !maps.Equal(projectA.Labels, projectB.Labels) {
+			lines = append(lines, fmt.Sprintf("labels: %v -> %v", projectA.Labels, projectB.Labels))
+		}
+
+		if len(lines) == 0 {
+			continue
+		}
+		differences++
+		fmt.Fprintf(w, "project %s:\n", namePattern)
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	if differences == 0 {
+		fmt.Fprintln(w, "no differences")
+	}
+	return nil
+}
+
+// configsByNamePattern returns the effective config of each project, keyed by namePattern.
+func configsByNamePattern(c *Config) map[string]*Config {
+	configs := make(map[string]*Config)
+	for _, projectConfig := range c.ProjectConfigs() {
+		configs[projectConfig.NamePattern] = projectConfig
+	}
+	return configs
+}
+
+// missingFrom returns the values in a that are not in b, in order.
+func missingFrom(a []string, b []string) []string {
+	var missing []string
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareConfigs(t *testing.T) {
+	t.Setenv("GCPX_NAME_PATTERN", "")
+	t.Setenv("GCPX_PARENT", "")
+	t.Setenv("GCPX_BILLING_ACCOUNT", "")
+
+	dir := t.TempDir()
+	writeConfig := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	pathA := writeConfig("a.yaml", `
+parent: folders/111
+billingAccount: billingAccounts/012345-6789AB-CDEF01
+labels:
+  team: infra
+projects:
+- namePattern: abc-dev-1
+  services: [compute.googleapis.com, pubsub.googleapis.com]
+- namePattern: abc-staging-1
+  services: [compute.googleapis.com]
+- namePattern: abc-old-1
+`)
+	pathB := writeConfig("b.yaml", `
+parent: folders/111
+billingAccount: billingAccounts/012345-6789AB-CDEF01
+labels:
+  team: infra
+projects:
+- namePattern: abc-dev-1
+  parent: folders/222
+  billingAccount: billingAccounts/FEDCBA-987654-321000
+  services: [compute.googleapis.com, storage.googleapis.com]
+  setupCommands: [make bootstrap]
+- namePattern: abc-staging-1
+  services: [compute.googleapis.com]
+- namePattern: abc-new-1
+`)
+
+	a, err := loadEffectiveConfig(pathA, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loadEffectiveConfig(pathB, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := compareConfigs(&out, a, b, time.UTC); err != nil {
+		t.Fatalf("compareConfigs: %v", err)
+	}
+	want := `project abc-dev-1:
+  parent: "folders/111" -> "folders/222"
+  billingAccount: "billingAccounts/012345-6789AB-CDEF01" -> "billingAccounts/FEDCBA-987654-321000"
+  services added: storage.googleapis.com
+  services removed: pubsub.googleapis.com
+  setupCommands changed
+project abc-old-1: removed
+project abc-new-1: added
+`
+	if got := out.String(); got != want {
+		t.Errorf("got diff\n%s\nwant\n%s", got, want)
+	}
+
+	out.Reset()
+	if err := compareConfigs(&out, a, a, time.UTC); err != nil {
+		t.Fatalf("compareConfigs: %v", err)
+	}
+	if got, want := out.String(), "no differences\n"; got != want {
+		t.Errorf("comparing a config with itself: got %q, want %q", got, want)
+	}
+}
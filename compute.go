@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/compute/v1"
+	"k8s.io/klog/v2"
+)
+
+// ComputeProjectSettings are project-wide Compute Engine settings.
+type ComputeProjectSettings struct {
+	// DefaultNetworkTier is the default network tier for the project: PREMIUM or STANDARD.
+	DefaultNetworkTier string `yaml:"defaultNetworkTier" json:"defaultNetworkTier"`
+}
+
+// IsSet returns true if any compute project settings are configured.
+func (c *ComputeProjectSettings) IsSet() bool {
+	return c.DefaultNetworkTier != ""
+}
+
+// Validate checks the compute project settings.
+func (c *ComputeProjectSettings) Validate() error {
+	switch c.DefaultNetworkTier {
+	case "", "PREMIUM", "STANDARD":
+	default:
+		return fmt.Errorf("computeProjectSettings.defaultNetworkTier %q is not valid; must be PREMIUM or STANDARD", c.DefaultNetworkTier)
+	}
+	return nil
+}
+
+func (p *ProjectManager) getComputeClient(ctx context.Context) (*compute.Service, error) {
+	if p.computeService != nil {
+		return p.computeService, nil
+	}
+	opts, err := p.clientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	computeService, err := compute.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating compute client: %w", err)
+	}
+	p.computeService = computeService
+	return computeService, nil
+}
+
+// waitForComputeGlobalOperation waits for a compute global operation to complete.
+func (p *ProjectManager) waitForComputeGlobalOperation(ctx context.Context, projectName string, op *compute.Operation) error {
+	computeService, err := p.getComputeClient(ctx)
+	if err != nil {
+		return err
+	}
+	opName := op.Name
+	for op.Status != "DONE" {
+		// Wait returns when the operation is done, or after about two minutes.
+		op, err = computeService.GlobalOperations.Wait(projectName, opName).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("error waiting for compute operation %q: %w", opName, err)
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) != 0 {
+		e := op.Error.Errors[0]
+		return fmt.Errorf("compute operation %q failed: %s: %s", opName, e.Code, e.Message)
+	}
+	return nil
+}
+
+// EnsureComputeProjectSettings applies the configured compute project settings, if they differ.
+func (p *ProjectManager) EnsureComputeProjectSettings(ctx context.Context, projectName string) error {
+	log := klog.FromContext(ctx)
+
+	settings := p.config.ComputeProjectSettings
+	if !settings.IsSet() {
+		return nil
+	}
+
+	if err := p.EnableProjectServices(ctx, projectName, []string{"compute.googleapis.com"}); err != nil {
+		return err
+	}
+	if p.dryRunServiceNotEnabled(ctx, projectName, "compute.googleapis.com", "apply compute project settings") {
+		return nil
+	}
+
+	computeService, err := p.getComputeClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	project, err := computeService.Projects.Get(projectName).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("error getting compute project %q: %w", projectName, err)
+	}
+
+	if settings.DefaultNetworkTier != "" {
+		if project.DefaultNetworkTier == settings.DefaultNetworkTier {
+			log.Info("default network tier already set", "project", projectName, "tier", settings.DefaultNetworkTier)
+		} else {
+			if p.dryRun {
+				log.Info("dry-run: would set default network tier", "project", projectName, "tier", settings.DefaultNetworkTier, "previous", project.DefaultNetworkTier)
+				return nil
+			}
+			log.Info("setting default network tier", "project", projectName, "tier", settings.DefaultNetworkTier, "previous", project.DefaultNetworkTier)
+			req := &compute.ProjectsSetDefaultNetworkTierRequest{NetworkTier: settings.DefaultNetworkTier}
+			op, err := computeService.Projects.SetDefaultNetworkTier(projectName, req).Context(ctx).Do()
+			if err == nil {
+				err = p.waitForComputeGlobalOperation(ctx, projectName, op)
+			}
+			p.audit(ctx, projectName, "set-default-network-tier", settings.DefaultNetworkTier, err)
+			if err != nil {
+				return fmt.Errorf("error setting default network tier for project %q: %w", projectName, err)
+			}
+			log.Info("default network tier set", "project", projectName, "tier", settings.DefaultNetworkTier)
+		}
+	}
+
+	return nil
+}
+
+// SharedVPCConfig attaches the project to a Shared VPC host project.
+type SharedVPCConfig struct {
+	// HostProject is the ID of the Shared VPC host project.
+	HostProject string `yaml:"hostProject" json:"hostProject"`
+}
+
+// EnsureSharedVPCAttachment makes the project a service project of the configured Shared VPC host project.
+func (p *ProjectManager) EnsureSharedVPCAttachment(ctx context.Context, projectName string) error {
+	log := klog.FromContext(ctx)
+
+	hostProject := p.config.SharedVPC.HostProject
+	if hostProject == "" {
+		return nil
+	}
+
+	// The service project must have compute enabled to be attached.
+	if err := p.EnableProjectServices(ctx, projectName, []string{"compute.googleapis.com"}); err != nil {
+		return err
+	}
+	if p.dryRunServiceNotEnabled(ctx, projectName, "compute.googleapis.com", "attach project to shared vpc host "+hostProject) {
+		return nil
+	}
+
+	computeService, err := p.getComputeClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	currentHost, err := computeService.Projects.GetXpnHost(projectName).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("error getting shared vpc host of project %q: %w", projectName, err)
+	}
+	if currentHost.Name == hostProject {
+		log.Info("project already attached to shared vpc host", "project", projectName, "hostProject", hostProject)
+		return nil
+	}
+	if currentHost.Name != "" {
+		return fmt.Errorf("project %q is attached to shared vpc host %q, expected %q", projectName, currentHost.Name, hostProject)
+	}
+
+	if p.dryRun {
+		log.Info("dry-run: would attach project to shared vpc host", "project", projectName, "hostProject", hostProject)
+		return nil
+	}
+
+	log.Info("attaching project to shared vpc host", "project", projectName, "hostProject", hostProject)
+	req := &compute.ProjectsEnableXpnResourceRequest{
+		XpnResource: &compute.XpnResourceId{
+			Id:   projectName,
+			Type: "PROJECT",
+		},
+	}
+	op, err := computeService.Projects.EnableXpnResource(hostProject, req).Context(ctx).Do()
+	if err == nil {
+		err = p.waitForComputeGlobalOperation(ctx, hostProject, op)
+	}
+	p.audit(ctx, projectName, "attach-shared-vpc", hostProject, err)
+	if err != nil {
+		if isPermissionDenied(err) {
+			return fmt.Errorf("permission denied attaching project %q to shared vpc host %q; the caller needs roles/compute.xpnAdmin on the host project's folder or organization: %w", projectName, hostProject, err)
+		}
+		return fmt.Errorf("error attaching project %q to shared vpc host %q: %w", projectName, hostProject, err)
+	}
+	log.Info("project attached to shared vpc host", "project", projectName, "hostProject", hostProject)
+	return nil
+}
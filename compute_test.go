@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestEnsureComputeProjectSettings(t *testing.T) {
+	grid := []struct {
+		current string
+		wantSet bool
+	}{
+		{"PREMIUM", true},
+		{"STANDARD", false},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET /projects/abc-test-1", respondJSON(&compute.Project{Name: "abc-test-1", DefaultNetworkTier: g.current}))
+		var requested string
+		api.handle("POST /projects/abc-test-1/setDefaultNetworkTier", func(w http.ResponseWriter, r *http.Request) {
+			var req compute.ProjectsSetDefaultNetworkTierRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("error decoding request: %v", err)
+			}
+			requested = req.NetworkTier
+			writeJSON(w, &compute.Operation{Name: "op-1", Status: "RUNNING"})
+		})
+		api.handle("POST /projects/abc-test-1/global/operations/op-1/wait", respondJSON(&compute.Operation{Name: "op-1", Status: "DONE"}))
+		su, suClient := newFakeServiceUsage(t)
+		su.enabled["compute.googleapis.com"] = true
+
+		p := newTestProjectManager(t, &Config{ComputeProjectSettings: ComputeProjectSettings{DefaultNetworkTier: "STANDARD"}}, api, suClient)
+		if err := p.EnsureComputeProjectSettings(context.Background(), "abc-test-1"); err != nil {
+			t.Errorf("current tier %s: EnsureComputeProjectSettings: %v", g.current, err)
+		}
+
+		if set := requested != ""; set != g.wantSet {
+			t.Errorf("current tier %s: got set %v, want %v", g.current, set, g.wantSet)
+		}
+		if g.wantSet && requested != "STANDARD" {
+			t.Errorf("current tier %s: requested tier %q, want STANDARD", g.current, requested)
+		}
+		if g.wantSet && api.CallCount("POST /projects/abc-test-1/global/operations/op-1/wait") != 1 {
+			t.Errorf("current tier %s: expected the operation to be waited on", g.current)
+		}
+	}
+}
+
+func TestEnsureComputeProjectSettingsOperationError(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /projects/abc-test-1", respondJSON(&compute.Project{Name: "abc-test-1", DefaultNetworkTier: "PREMIUM"}))
+	api.handle("POST /projects/abc-test-1/setDefaultNetworkTier", respondJSON(&compute.Operation{
+		Name:   "op-1",
+		Status: "DONE",
+		Error:  &compute.OperationError{Errors: []*compute.OperationErrorErrors{{Code: "PERMISSION_DENIED", Message: "denied"}}},
+	}))
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["compute.googleapis.com"] = true
+
+	p := newTestProjectManager(t, &Config{ComputeProjectSettings: ComputeProjectSettings{DefaultNetworkTier: "STANDARD"}}, api, suClient)
+	if err := p.EnsureComputeProjectSettings(context.Background(), "abc-test-1"); err == nil {
+		t.Errorf("expected the failed operation to be reported")
+	}
+}
+
+func TestComputeProjectSettingsValidate(t *testing.T) {
+	for tier, wantErr := range map[string]bool{"": false, "PREMIUM": false, "STANDARD": false, "standard": true, "FIXED": true} {
+		c := ComputeProjectSettings{DefaultNetworkTier: tier}
+		if err := c.Validate(); (err != nil) != wantErr {
+			t.Errorf("tier %q: got error %v, wantErr %v", tier, err, wantErr)
+		}
+	}
+}
+
+func TestEnsureSharedVPCAttachment(t *testing.T) {
+	grid := []struct {
+		name        string
+		currentHost string
+		wantAttach  bool
+		wantErr     bool
+	}{
+		{"not attached", "", true, false},
+		{"already attached", "host-project", false, false},
+		{"attached elsewhere", "other-host", false, true},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET /projects/abc-test-1/getXpnHost", respondJSON(&compute.Project{Name: g.currentHost}))
+		var attached *compute.XpnResourceId
+		api.handle("POST /projects/host-project/enableXpnResource", func(w http.ResponseWriter, r *http.Request) {
+			var req compute.ProjectsEnableXpnResourceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("error decoding request: %v", err)
+			}
+			attached = req.XpnResource
+			writeJSON(w, &compute.Operation{Name: "op-1", Status: "DONE"})
+		})
+		su, suClient := newFakeServiceUsage(t)
+		su.enabled["compute.googleapis.com"] = true
+
+		p := newTestProjectManager(t, &Config{SharedVPC: SharedVPCConfig{HostProject: "host-project"}}, api, suClient)
+		err := p.EnsureSharedVPCAttachment(context.Background(), "abc-test-1")
+		if (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+		if (attached != nil) != g.wantAttach {
+			t.Errorf("%s: got attach %v, want %v", g.name, attached != nil, g.wantAttach)
+		}
+		if attached != nil && (attached.Id != "abc-test-1" || attached.Type != "PROJECT") {
+			t.Errorf("%s: attached %+v, want the project", g.name, attached)
+		}
+	}
+}
+
+func TestEnsureSharedVPCAttachmentPermissionDenied(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /projects/abc-test-1/getXpnHost", respondJSON(&compute.Project{}))
+	api.handle("POST /projects/host-project/enableXpnResource", respondError(http.StatusForbidden, "PERMISSION_DENIED", "Required 'compute.organizations.enableXpnResource' permission"))
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["compute.googleapis.com"] = true
+
+	p := newTestProjectManager(t, &Config{SharedVPC: SharedVPCConfig{HostProject: "host-project"}}, api, suClient)
+	err := p.EnsureSharedVPCAttachment(context.Background(), "abc-test-1")
+	if err == nil || !strings.Contains(err.Error(), "roles/compute.xpnAdmin") {
+		t.Errorf("expected an error naming the required role, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evaluateCondition evaluates a simple condition expression, such as those used for createWhen.
+//
+// Supported forms, after ${...} expansion of each operand:
+//
+//	a == b    true if the operands are equal
+//	a != b    true if the operands differ
+//	a         true if the operand is non-empty (presence check)
+//	!a        true if the operand is empty
+//
+// Operands may be quoted with single or double quotes; surrounding whitespace is ignored.
+// There is deliberately no support for arbitrary code.
+func evaluateCondition(expr string, location *time.Location) (bool, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return false, fmt.Errorf("condition is empty")
+	}
+
+	for _, op := range []string{"==", "!="} {
+		lhs, rhs, found := strings.Cut(expr, op)
+		if !found {
+			continue
+		}
+		l, err := evaluateOperand(lhs, location)
+		if err != nil {
+			return false, err
+		}
+		r, err := evaluateOperand(rhs, location)
+		if err != nil {
+			return false, err
+		}
+		if op == "==" {
+			return l == r, nil
+		}
+		return l != r, nil
+	}
+
+	if operand, found := strings.CutPrefix(expr, "!"); found {
+		v, err := evaluateOperand(operand, location)
+		if err != nil {
+			return false, err
+		}
+		return v == "", nil
+	}
+
+	v, err := evaluateOperand(expr, location)
+	if err != nil {
+		return false, err
+	}
+	return v != "", nil
+}
+
+// evaluateOperand expands an operand of a condition, removing surrounding whitespace and quotes.
+func evaluateOperand(s string, location *time.Location) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			unquoted, err := strconv.Unquote(s)
+			if err != nil {
+				return "", fmt.Errorf("invalid quoted string %s: %w", s, err)
+			}
+			s = unquoted
+		} else {
+			s = s[1 : len(s)-1]
+		}
+	}
+	return expandPattern(s, location)
+}
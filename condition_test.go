@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	t.Setenv("BRANCH", "main")
+	t.Setenv("EMPTY", "")
+
+	grid := []struct {
+		expr string
+		want bool
+	}{
+		{"${env.BRANCH} == main", true},
+		{"${env.BRANCH} == 'main'", true},
+		{`"${env.BRANCH}" == "release"`, false},
+		{"${env.BRANCH} != release", true},
+		{"${env.BRANCH} != main", false},
+		{"${env.BRANCH}", true},
+		{"${env.EMPTY}", false},
+		{"!${env.EMPTY}", true},
+		{"!${env.BRANCH}", false},
+	}
+	for _, g := range grid {
+		got, err := evaluateCondition(g.expr, time.UTC)
+		if err != nil {
+			t.Errorf("evaluateCondition(%q): unexpected error: %v", g.expr, err)
+			continue
+		}
+		if got != g.want {
+			t.Errorf("evaluateCondition(%q) = %v, want %v", g.expr, got, g.want)
+		}
+	}
+
+	if _, err := evaluateCondition("  ", time.UTC); err == nil {
+		t.Errorf("expected an error for an empty condition")
+	}
+}
+
+func TestCreateWhenGatesDelete(t *testing.T) {
+	t.Setenv("BRANCH", "feature")
+
+	config := &Config{
+		NamePattern: "abc-test-1",
+		Parent:      "folders/123",
+		CreateWhen:  "${env.BRANCH} == main",
+	}
+	o := &runOptions{location: time.UTC, deleteProject: true}
+
+	// With the condition false, reconcileConfig must return before building any API client.
+	if err := reconcileConfig(context.Background(), config, "", o); err != nil {
+		t.Errorf("expected -delete to be skipped when createWhen is false, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// stdinIsTerminal returns true if stdin is an interactive terminal.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmDestructive asks the user to confirm a destructive action.
+// With -yes the action is always allowed; when stdin is not a terminal we cannot ask,
+// so we refuse rather than block or proceed silently.
+func (p *ProjectManager) confirmDestructive(ctx context.Context, action string) error {
+	log := klog.FromContext(ctx)
+
+	if p.assumeYes {
+		log.Info("proceeding with destructive action (-yes)", "action", action)
+		return nil
+	}
+	if !p.interactive {
+		return fmt.Errorf("refusing to %s without confirmation; re-run with -yes to allow destructive actions", action)
+	}
+
+	in := p.promptIn
+	if in == nil {
+		in = os.Stdin
+	}
+	out := p.promptOut
+	if out == nil {
+		out = os.Stderr
+	}
+
+	fmt.Fprintf(out, "About to %s. Proceed? [y/N] ", action)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("error reading confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("aborted: did not confirm %s", action)
+	}
+}
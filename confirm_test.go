@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestConfirmDestructive(t *testing.T) {
+	grid := []struct {
+		name        string
+		assumeYes   bool
+		interactive bool
+		input       string
+		wantErr     bool
+		wantPrompt  bool
+	}{
+		{"yes flag", true, false, "", false, false},
+		{"not interactive", false, false, "y\n", true, false},
+		{"confirmed", false, true, "y\n", false, true},
+		{"confirmed in full", false, true, " YES \n", false, true},
+		{"declined", false, true, "n\n", true, true},
+		{"empty answer", false, true, "\n", true, true},
+		{"eof", false, true, "", true, true},
+	}
+	for _, g := range grid {
+		var out bytes.Buffer
+		p := NewProjectManager(&Config{})
+		p.assumeYes = g.assumeYes
+		p.interactive = g.interactive
+		p.promptIn = strings.NewReader(g.input)
+		p.promptOut = &out
+
+		err := p.confirmDestructive(context.Background(), "delete project abc-test-1")
+		if (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+		prompted := strings.Contains(out.String(), "About to delete project abc-test-1. Proceed? [y/N]")
+		if prompted != g.wantPrompt {
+			t.Errorf("%s: got prompt %q, want prompt %v", g.name, out.String(), g.wantPrompt)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// projectCreationLimiter limits project creation separately from the other phases, as creation uses the
+// organization's project-creation quota, which is low and throttled in bursts.
+// One limiter is shared by all the projects of a process, including concurrent -serve requests.
+// A nil limiter does not limit.
+type projectCreationLimiter struct {
+	// inFlight holds a slot for each project creation in progress, bounding their concurrency.
+	inFlight chan struct{}
+	// limiter, if set, bounds the rate of create calls, including retries.
+	limiter *rate.Limiter
+}
+
+// newProjectCreationLimiter returns a limiter allowing concurrency creations at once, and at most qps
+// create calls per second; a qps of 0 does not limit the rate.
+func newProjectCreationLimiter(concurrency int, qps float64) *projectCreationLimiter {
+	l := &projectCreationLimiter{inFlight: make(chan struct{}, concurrency)}
+	if qps > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(qps), 1)
+	}
+	return l
+}
+
+// acquire waits until another project creation may start; release must be called once it has finished.
+func (l *projectCreationLimiter) acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.inFlight <- struct{}{}:
+		return func() { <-l.inFlight }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// wait waits until a create call may be made, within the configured rate.
+func (l *projectCreationLimiter) wait(ctx context.Context) error {
+	if l == nil || l.limiter == nil {
+		return nil
+	}
+	return l.limiter.Wait(ctx)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestProjectCreationLimiter(t *testing.T) {
+	grid := []struct {
+		name        string
+		concurrency int
+		qps         float64
+		// wantMinDuration is the least time the creations can take within the rate limit.
+		wantMinDuration time.Duration
+	}{
+		{"serialized", 1, 0, 0},
+		{"concurrency 2", 2, 0, 0},
+		{"rate limited", 4, 20, 3 * 50 * time.Millisecond},
+	}
+	for _, g := range grid {
+		var mu sync.Mutex
+		inFlight, maxInFlight := 0, 0
+		// release lets the creates finish, once the services phase below has run.
+		release := make(chan struct{})
+		api := newFakeAPI(t)
+		api.handle("POST /v3/projects", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+
+			<-release
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			writeJSON(w, &cloudresourcemanager.Operation{Name: "operations/cp.123", Done: true})
+		})
+		limiter := newProjectCreationLimiter(g.concurrency, g.qps)
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for i := range errs {
+			p := newTestProjectManager(t, &Config{Parent: "folders/123"}, api, nil)
+			p.createLimiter = limiter
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = p.createProject(context.Background(), fmt.Sprintf("abc-test-%d", i))
+			}()
+		}
+
+		// Other phases are not held up by the creations in progress.
+		_, suClient := newFakeServiceUsage(t)
+		other := newTestProjectManager(t, &Config{}, nil, suClient)
+		other.createLimiter = limiter
+		if err := other.EnableProjectServices(context.Background(), "other-project", []string{"compute.googleapis.com"}); err != nil {
+			t.Errorf("%s: EnableProjectServices: %v", g.name, err)
+		}
+		close(release)
+
+		wg.Wait()
+		elapsed := time.Since(start)
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("%s: createProject %d: %v", g.name, i, err)
+			}
+		}
+		if maxInFlight > g.concurrency {
+			t.Errorf("%s: got %d creations at once, want at most %d", g.name, maxInFlight, g.concurrency)
+		}
+		if got := api.CallCount("POST /v3/projects"); got != 4 {
+			t.Errorf("%s: got %d create calls, want 4", g.name, got)
+		}
+		if elapsed < g.wantMinDuration {
+			t.Errorf("%s: took %v, want at least %v at %v qps", g.name, elapsed, g.wantMinDuration, g.qps)
+		}
+	}
+}
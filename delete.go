@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// deletionPollInterval is the delay between reads of a project while -wait waits for its deletion.
+// It is a variable so that tests can poll quickly.
+var deletionPollInterval = 5 * time.Second
+
+// DeleteProject schedules the project for deletion.
+// A project that does not exist, or is already pending deletion, is treated as success.
+func (p *ProjectManager) DeleteProject(ctx context.Context, projectName string) error {
+	log := klog.FromContext(ctx)
+
+	project, err := p.getProject(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		log.Info("project does not exist, nothing to delete", "name", projectName)
+		return nil
+	}
+	log.Info("found project", "name", projectName, "state", project.State)
+	if project.State == "DELETE_REQUESTED" {
+		log.Info("project is already pending deletion", "name", projectName)
+		return nil
+	}
+
+	action := fmt.Sprintf("delete project %q", projectName)
+	if err := p.checkProjectAge(ctx, projectName, action); err != nil {
+		return err
+	}
+
+	// Liens block deletion; they are only removed with -remove-liens.
+	liens, err := p.listProjectLiens(ctx, project)
+	if err != nil {
+		return err
+	}
+	if len(liens) != 0 {
+		if !p.removeLiens {
+			return liensBlockDeletionError(projectName, liens)
+		}
+		action = fmt.Sprintf("remove %d lien(s) from project %q and delete it", len(liens), projectName)
+	}
+
+	if p.dryRun {
+		log.Info("dry-run: would " + action)
+		return nil
+	}
+	if err := p.confirmDestructive(ctx, action); err != nil {
+		return err
+	}
+	if err := p.deleteLiens(ctx, projectName, liens); err != nil {
+		return err
+	}
+
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Info("deleting project", "name", projectName)
+	op, err := crmService.Projects.Delete("projects/" + projectName).Context(ctx).Do()
+	if err != nil {
+		if isNotFound(err) {
+			log.Info("project already deleted", "name", projectName)
+			return nil
+		}
+		p.audit(ctx, projectName, "delete-project", "", err)
+		return fmt.Errorf("error deleting project: %w", err)
+	}
+
+	op, err = p.waitForOperation(ctx, op)
+	if err == nil && op.Error != nil {
+		err = fmt.Errorf("error from project deletion operation: %v", op.Error)
+	}
+	p.audit(ctx, projectName, "delete-project", "", err)
+	if err != nil {
+		return err
+	}
+	log.Info("project scheduled for deletion", "name", projectName)
+
+	if p.waitForDeletion {
+		return p.waitUntilDeleted(ctx, projectName)
+	}
+	return nil
+}
+
+// waitUntilDeleted polls the project until it is pending deletion or gone, or deletionWaitTimeout passes.
+func (p *ProjectManager) waitUntilDeleted(ctx context.Context, projectName string) error {
+	log := klog.FromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, p.deletionWaitTimeout)
+	defer cancel()
+
+	for {
+		project, err := p.getProject(ctx, projectName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("timed out after %v waiting for project %q to be deleted: %w", p.deletionWaitTimeout, projectName, err)
+			}
+			return err
+		}
+		if project == nil || project.State == "DELETE_REQUESTED" {
+			log.Info("project deletion confirmed", "name", projectName)
+			return nil
+		}
+		log.V(2).Info("waiting for project deletion", "name", projectName, "state", project.State)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v waiting for project %q to be deleted (state %s): %w", p.deletionWaitTimeout, projectName, project.State, ctx.Err())
+		case <-time.After(deletionPollInterval):
+		}
+	}
+}
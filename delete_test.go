@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestDeleteProjectWaitsForDeletion(t *testing.T) {
+	defer func(d time.Duration) { deletionPollInterval = d }(deletionPollInterval)
+	deletionPollInterval = time.Millisecond
+
+	grid := []struct {
+		name string
+		// activeReads is how many reads return ACTIVE before the project reports DELETE_REQUESTED; -1 means never.
+		activeReads int
+		wantErr     bool
+	}{
+		{"transitions to deleted", 3, false},
+		{"never deleted", -1, true},
+	}
+	for _, g := range grid {
+		var reads atomic.Int32
+		api := newFakeAPI(t)
+		api.handle("GET /v3/projects/abc-test-1", func(w http.ResponseWriter, r *http.Request) {
+			state := "ACTIVE"
+			if n := int(reads.Add(1)); g.activeReads >= 0 && n > g.activeReads {
+				state = "DELETE_REQUESTED"
+			}
+			writeJSON(w, &cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1", State: state})
+		})
+		api.handle("GET /v3/liens", respondJSON(&cloudresourcemanager.ListLiensResponse{}))
+		api.handle("DELETE /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Operation{Name: "operations/dp.123", Done: true}))
+		p := newTestProjectManager(t, &Config{}, api, nil)
+		p.assumeYes = true
+		p.waitForDeletion = true
+		p.deletionWaitTimeout = 100 * time.Millisecond
+
+		err := p.DeleteProject(context.Background(), "abc-test-1")
+		if g.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "timed out") {
+				t.Errorf("%s: got error %v, want a timeout", g.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: DeleteProject: %v", g.name, err)
+			continue
+		}
+		// One read before deleting, then polls until the state changes.
+		if got, want := int(reads.Load()), g.activeReads+1; got != want {
+			t.Errorf("%s: got %d project reads, want %d", g.name, got, want)
+		}
+	}
+}
+
+func TestDeleteProjectWithoutWait(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1", State: "ACTIVE"}))
+	api.handle("GET /v3/liens", respondJSON(&cloudresourcemanager.ListLiensResponse{}))
+	api.handle("DELETE /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Operation{Name: "operations/dp.123", Done: true}))
+	p := newTestProjectManager(t, &Config{}, api, nil)
+	p.assumeYes = true
+
+	if err := p.DeleteProject(context.Background(), "abc-test-1"); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	if got := api.CallCount("GET /v3/projects/abc-test-1"); got != 1 {
+		t.Errorf("got %d project reads, want 1 without -wait", got)
+	}
+}
+
+func TestDeleteProjectWithLien(t *testing.T) {
+	lien := &cloudresourcemanager.Lien{
+		Name:         "liens/p123-abc",
+		Parent:       "projects/123456789012",
+		Origin:       "compute.googleapis.com",
+		Reason:       "Shared VPC host project",
+		Restrictions: []string{"resourcemanager.projects.delete"},
+	}
+
+	for _, removeLiens := range []bool{false, true} {
+		var listParent string
+		api := newFakeAPI(t)
+		api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1", State: "ACTIVE"}))
+		api.handle("GET /v3/liens", func(w http.ResponseWriter, r *http.Request) {
+			listParent = r.URL.Query().Get("parent")
+			writeJSON(w, &cloudresourcemanager.ListLiensResponse{Liens: []*cloudresourcemanager.Lien{lien}})
+		})
+		api.handle("DELETE /v3/liens/p123-abc", respondJSON(&cloudresourcemanager.Empty{}))
+		api.handle("DELETE /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Operation{Name: "operations/dp.123", Done: true}))
+		p := newTestProjectManager(t, &Config{}, api, nil)
+		p.assumeYes = true
+		p.removeLiens = removeLiens
+		// -force only overrides the age guard; it does not remove liens.
+		p.force = true
+
+		err := p.DeleteProject(context.Background(), "abc-test-1")
+		if listParent != "projects/123456789012" {
+			t.Errorf("removeLiens=%v: got liens listed for %q, want projects/123456789012", removeLiens, listParent)
+		}
+		if !removeLiens {
+			if err == nil || !strings.Contains(err.Error(), "liens/p123-abc") || !strings.Contains(err.Error(), "-remove-liens") {
+				t.Errorf("got error %v, want an error naming the lien and -remove-liens", err)
+			}
+			if calls := api.Calls(); slices.Contains(calls, "DELETE /v3/liens/p123-abc") || slices.Contains(calls, "DELETE /v3/projects/abc-test-1") {
+				t.Errorf("expected nothing to be deleted without -remove-liens, got calls %v", calls)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("removeLiens: DeleteProject: %v", err)
+		}
+		// The lien is removed before the project is deleted.
+		calls := api.Calls()
+		removeLien, deleteProject := slices.Index(calls, "DELETE /v3/liens/p123-abc"), slices.Index(calls, "DELETE /v3/projects/abc-test-1")
+		if removeLien < 0 || deleteProject < 0 || removeLien > deleteProject {
+			t.Errorf("got calls %v, want the lien removed and then the project deleted", calls)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// previewPhaseForMissingProject logs what a phase would do in dry-run mode, when the project would have been created.
+// There is nothing to read for a project that does not exist yet, so we report the configured intent.
+func (p *ProjectManager) previewPhaseForMissingProject(ctx context.Context, projectName string, phase string) {
+	log := klog.FromContext(ctx)
+
+	p.explainf(projectName, "project would be created -> %s phase applies the config as-is", phase)
+	switch phase {
+	case PhaseBilling:
+		if skip, reason := p.skipBillingReason(); skip {
+			log.Info("dry-run: would not link new project to a billing account", "project", projectName, "reason", reason)
+		} else {
+			log.Info("dry-run: would link new project to billing account", "project", projectName, "billingAccount", p.config.BillingAccount)
+		}
+	case PhaseServices:
+		log.Info("dry-run: would enable services on new project", "project", projectName, "services", p.config.Services)
+		for _, group := range p.config.ServiceGroups {
+			log.Info("dry-run: would enable service group on new project", "project", projectName, "group", group.Name, "services", group.Services)
+		}
+	case PhaseSetup:
+		for _, command := range p.config.SetupCommands {
+			if !p.config.SetupCommandsTemplate {
+				command = strings.ReplaceAll(command, "${PROJECT_ID}", projectName)
+			}
+			log.Info("dry-run: would run setup command", "project", projectName, "command", command)
+		}
+	default:
+		log.Info("dry-run: would reconcile phase on new project", "project", projectName, "phase", phase)
+	}
+}
+
+// dryRunServiceNotEnabled returns true in dry-run mode if the service is not enabled on the project.
+// In that case we would have enabled it, but we cannot read the current state through it, so we only log the intended action.
+func (p *ProjectManager) dryRunServiceNotEnabled(ctx context.Context, projectName string, service string, action string) bool {
+	if !p.dryRun || p.enabledServices[service] {
+		return false
+	}
+	log := klog.FromContext(ctx)
+	log.Info("dry-run: service is not yet enabled, cannot read current state", "project", projectName, "service", service, "wouldDo", action)
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+)
+
+// redactedQueryParams are query parameters that can carry credentials.
+var redactedQueryParams = []string{"access_token", "key"}
+
+// redactURL returns the URL as a string, with any credentials removed.
+func redactURL(u *url.URL) string {
+	u2 := *u
+	u2.User = nil
+	q := u2.Query()
+	for _, k := range redactedQueryParams {
+		if q.Has(k) {
+			q.Set(k, "REDACTED")
+		}
+	}
+	u2.RawQuery = q.Encode()
+	return u2.String()
+}
+
+// dumpingRoundTripper logs each request body and the response status.
+// It wraps the authenticating transport, so it never sees the Authorization header; we do not log headers regardless.
+type dumpingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (d *dumpingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	log := klog.FromContext(req.Context())
+
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	log.Info("api request", "method", req.Method, "url", redactURL(req.URL), "body", string(body))
+
+	resp, err := d.next.RoundTrip(req)
+	if err != nil {
+		log.Info("api request failed", "method", req.Method, "url", redactURL(req.URL), "error", err)
+		return nil, err
+	}
+	log.Info("api response", "method", req.Method, "url", redactURL(req.URL), "status", resp.Status)
+	return resp, nil
+}
+
+// dumpingUnaryInterceptor logs each gRPC request message and the resulting status code.
+func dumpingUnaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	log := klog.FromContext(ctx)
+
+	body := ""
+	if m, ok := req.(proto.Message); ok {
+		if b, err := protojson.Marshal(m); err == nil {
+			body = string(b)
+		}
+	}
+	log.Info("api request", "method", method, "body", body)
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	log.Info("api response", "method", method, "status", status.Code(err).String())
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/textlogger"
+)
+
+// newCapturingContext returns a context whose logger writes to the returned buffer.
+func newCapturingContext() (context.Context, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(&buf)))
+	return klog.NewContext(context.Background(), logger), &buf
+}
+
+func TestDumpingRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	ctx, logs := newCapturingContext()
+	client := &http.Client{Transport: &dumpingRoundTripper{next: http.DefaultTransport}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/v3/projects?access_token=secret-token&alt=json", strings.NewReader(`{"projectId":"abc-test-1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret-header")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	out := logs.String()
+	for _, want := range []string{
+		`"api request"`,
+		`method="POST"`,
+		`body="{\"projectId\":\"abc-test-1\"}"`,
+		"access_token=REDACTED",
+		`"api response"`,
+		`status="400 Bad Request"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in dump output:\n%s", want, out)
+		}
+	}
+	for _, secret := range []string{"secret-token", "secret-header"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("credential %q leaked into dump output:\n%s", secret, out)
+		}
+	}
+}
+
+func TestDumpingUnaryInterceptor(t *testing.T) {
+	su, client := newFakeServiceUsage(t, option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(dumpingUnaryInterceptor)))
+	su.enabled["compute.googleapis.com"] = true
+
+	ctx, logs := newCapturingContext()
+	if _, err := client.BatchGetServices(ctx, &serviceusagepb.BatchGetServicesRequest{
+		Parent: "projects/abc-test-1",
+		Names:  []string{"projects/abc-test-1/services/compute.googleapis.com"},
+	}); err != nil {
+		t.Fatalf("BatchGetServices: %v", err)
+	}
+
+	out := logs.String()
+	for _, want := range []string{
+		`method="/google.api.serviceusage.v1.ServiceUsage/BatchGetServices"`,
+		`projects/abc-test-1/services/compute.googleapis.com`,
+		`status="OK"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in dump output:\n%s", want, out)
+		}
+	}
+}
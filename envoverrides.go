@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// configEnvOverrides are the environment variables that override config fields.
+// The precedence is flag > environment variable > config file (including the -env overlay).
+var configEnvOverrides = []struct {
+	name  string
+	field func(c *Config) *string
+	// projectField, if set, is the same field on a project listed under projects, which is overridden too.
+	projectField func(p *ProjectConfig) *string
+}{
+	{nameOverrideEnvVar, func(c *Config) *string { return &c.NamePattern }, nil},
+	{parentOverrideEnvVar, func(c *Config) *string { return &c.Parent }, func(p *ProjectConfig) *string { return &p.Parent }},
+	{"GCPX_BILLING_ACCOUNT", func(c *Config) *string { return &c.BillingAccount }, func(p *ProjectConfig) *string { return &p.BillingAccount }},
+}
+
+const (
+	// nameOverrideEnvVar overrides namePattern, which names a single project.
+	nameOverrideEnvVar = "GCPX_NAME_PATTERN"
+	// parentOverrideEnvVar overrides parent, and takes precedence over parentFrom, which is also from the config.
+	parentOverrideEnvVar = "GCPX_PARENT"
+)
+
+// applyEnvOverrides sets the config fields whose override environment variables are set (and non-empty),
+// at the top level and on each project listed under projects, so that the environment wins over the whole file.
+// GCPX_NAME_PATTERN cannot be used with configs that list projects, as each needs its own namePattern.
+func applyEnvOverrides(c *Config) error {
+	for _, override := range configEnvOverrides {
+		v := os.Getenv(override.name)
+		if v == "" {
+			continue
+		}
+		if override.name == nameOverrideEnvVar && len(c.Projects) != 0 {
+			return fmt.Errorf("%s cannot be used with a config that lists projects, as each project needs its own namePattern", nameOverrideEnvVar)
+		}
+		*override.field(c) = v
+		if override.projectField != nil {
+			for i := range c.Projects {
+				*override.projectField(&c.Projects[i]) = v
+			}
+		}
+		if override.name == parentOverrideEnvVar {
+			c.ParentFrom = ""
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyEnvOverrides(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			NamePattern:    "abc-${today}",
+			Parent:         "folders/1",
+			BillingAccount: "billingAccounts/AAA",
+		}
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		t.Setenv("GCPX_NAME_PATTERN", "")
+		t.Setenv("GCPX_PARENT", "")
+		t.Setenv("GCPX_BILLING_ACCOUNT", "")
+
+		c := newConfig()
+		if err := applyEnvOverrides(c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(c, newConfig()) {
+			t.Errorf("config changed although no overrides are set: %+v", c)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		t.Setenv("GCPX_NAME_PATTERN", "ci-${random}")
+		t.Setenv("GCPX_PARENT", "folders/2")
+		t.Setenv("GCPX_BILLING_ACCOUNT", "billingAccounts/BBB")
+
+		c := newConfig()
+		if err := applyEnvOverrides(c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.NamePattern != "ci-${random}" || c.Parent != "folders/2" || c.BillingAccount != "billingAccounts/BBB" {
+			t.Errorf("overrides not applied: %+v", c)
+		}
+	})
+
+	t.Run("name pattern with projects", func(t *testing.T) {
+		t.Setenv("GCPX_NAME_PATTERN", "ci-${random}")
+
+		c := &Config{Projects: []ProjectConfig{{NamePattern: "a-${random}"}, {NamePattern: "b-${random}"}}}
+		if err := applyEnvOverrides(c); err == nil {
+			t.Errorf("expected an error using GCPX_NAME_PATTERN with projects")
+		}
+	})
+
+	t.Run("parent and billing account with projects", func(t *testing.T) {
+		t.Setenv("GCPX_NAME_PATTERN", "")
+		t.Setenv("GCPX_PARENT", "folders/2")
+		t.Setenv("GCPX_BILLING_ACCOUNT", "billingAccounts/BBB")
+
+		// The environment wins over the values set on a project, as well as the top-level defaults.
+		c := &Config{
+			Parent:         "folders/1",
+			BillingAccount: "billingAccounts/AAA",
+			Projects: []ProjectConfig{
+				{NamePattern: "a-${random}"},
+				{NamePattern: "b-${random}", Parent: "folders/3", BillingAccount: "billingAccounts/CCC"},
+			},
+		}
+		if err := applyEnvOverrides(c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, projectConfig := range c.ProjectConfigs() {
+			if projectConfig.Parent != "folders/2" || projectConfig.BillingAccount != "billingAccounts/BBB" {
+				t.Errorf("project %s: got parent %q and billing account %q, want the overrides", projectConfig.NamePattern, projectConfig.Parent, projectConfig.BillingAccount)
+			}
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// explainf writes a line explaining why an action will or won't run, if -explain is set.
+// The lines are written in the form "<project>: <reason> -> <decision>", to stderr unless explainOut is set.
+func (p *ProjectManager) explainf(projectName string, format string, args ...any) {
+	if !p.explain {
+		return
+	}
+	out := p.explainOut
+	if out == nil {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "%s: %s\n", projectName, fmt.Sprintf(format, args...))
+}
+
+// explainServices explains the decision to enable the missing services, out of those requested.
+func (p *ProjectManager) explainServices(projectName string, requested []string, missing []string) {
+	if len(missing) == 0 {
+		p.explainf(projectName, "all %d services enabled -> skip enable", len(requested))
+		return
+	}
+	p.explainf(projectName, "%d of %d services missing -> will enable %s", len(missing), len(requested), strings.Join(missing, ", "))
+}
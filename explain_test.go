@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestExplainMixedScenario(t *testing.T) {
+	const account = "billingAccounts/012345-6789AB-CDEF01"
+
+	// The project exists and is linked to the configured billing account,
+	// but some services and an IAM binding are missing.
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1", State: "ACTIVE"}))
+	api.handle("GET /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{BillingAccountName: account, BillingEnabled: true}))
+	api.handleIAMPolicy("abc-test-1", &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{{Role: "roles/viewer", Members: []string{"group:dev@example.com"}}},
+	})
+
+	su, suClient := newFakeServiceUsage(t)
+	for _, service := range []string{"cloudbilling.googleapis.com", "compute.googleapis.com", "storage.googleapis.com"} {
+		su.enabled[service] = true
+	}
+
+	config := &Config{
+		NamePattern:    "abc-test-1",
+		BillingAccount: account,
+		Services:       []string{"compute.googleapis.com", "storage.googleapis.com", "pubsub.googleapis.com", "bigquery.googleapis.com", "logging.googleapis.com"},
+		IAMBindings: []IAMBinding{
+			{Role: "roles/viewer", Members: []string{"group:dev@example.com"}},
+			{Role: "roles/editor", Members: []string{"group:ops@example.com"}},
+		},
+		SetupCommands: []string{"make bootstrap"},
+	}
+	p := newTestProjectManager(t, config, api, suClient)
+	p.dryRun = true
+	p.explain = true
+	var out bytes.Buffer
+	p.explainOut = &out
+
+	ctx := context.Background()
+	for _, phase := range config.EffectivePhases() {
+		if err := p.RunPhase(ctx, "abc-test-1", phase); err != nil {
+			t.Fatalf("phase %s: %v", phase, err)
+		}
+	}
+
+	want := []string{
+		"abc-test-1: project exists -> skip create",
+		"abc-test-1: all 1 services enabled -> skip enable",
+		"abc-test-1: billing account matches (" + account + ") -> skip link",
+		"abc-test-1: 3 of 5 services missing -> will enable pubsub.googleapis.com, bigquery.googleapis.com, logging.googleapis.com",
+		"abc-test-1: 1 of 2 iam roles are missing members (roles/editor) -> will update policy",
+		"abc-test-1: setup commands configured (1) -> will run them",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("got explanation\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExplainOff(t *testing.T) {
+	var out bytes.Buffer
+	p := NewProjectManager(&Config{})
+	p.explainOut = &out
+	p.explainf("abc-test-1", "project exists -> skip create")
+	if out.Len() != 0 {
+		t.Errorf("expected no explanation without -explain, got %q", out.String())
+	}
+}
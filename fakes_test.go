@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	longrunning "cloud.google.com/go/longrunning/autogen/longrunningpb"
+	serviceusage "cloud.google.com/go/serviceusage/apiv1"
+	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/orgpolicy/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// fakeServiceUsage is an in-memory Service Usage API server.
+// Enable and disable operations complete immediately.
+type fakeServiceUsage struct {
+	serviceusagepb.UnimplementedServiceUsageServer
+
+	mu sync.Mutex
+	// enabled is the set of enabled service names (e.g. "compute.googleapis.com").
+	enabled map[string]bool
+	// calls records the calls made, e.g. "BatchEnableServices a.googleapis.com,b.googleapis.com".
+	calls []string
+	// enableErr, if set, is consulted before enabling services; a non-nil error fails the call.
+	enableErr func(services []string) error
+	// notReady is the number of BatchGetServices reads for which each service still reports DISABLED after being enabled.
+	notReady map[string]int
+}
+
+// newFakeServiceUsage starts a fake Service Usage server and returns it with a client connected to it.
+func newFakeServiceUsage(t *testing.T, extra ...option.ClientOption) (*fakeServiceUsage, *serviceusage.Client) {
+	t.Helper()
+
+	f := &fakeServiceUsage{enabled: make(map[string]bool), notReady: make(map[string]int)}
+	addr := startGRPCServer(t, func(s *grpc.Server) {
+		serviceusagepb.RegisterServiceUsageServer(s, f)
+	})
+
+	ctx := context.Background()
+	opts := append([]option.ClientOption{
+		option.WithEndpoint(addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}, extra...)
+	client, err := serviceusage.NewClient(ctx, opts...)
+	if err != nil {
+		t.Fatalf("error creating serviceusage client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return f, client
+}
+
+// startGRPCServer starts a gRPC server on a local port and returns its address.
+func startGRPCServer(t *testing.T, register func(s *grpc.Server)) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	s := grpc.NewServer()
+	register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func (f *fakeServiceUsage) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+// Calls returns the calls made so far.
+func (f *fakeServiceUsage) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// CallsTo returns the calls made so far to the named method.
+func (f *fakeServiceUsage) CallsTo(method string) []string {
+	var calls []string
+	for _, call := range f.Calls() {
+		if call == method || strings.HasPrefix(call, method+" ") {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Enabled returns whether the service is enabled.
+func (f *fakeServiceUsage) Enabled(service string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enabled[service]
+}
+
+func (f *fakeServiceUsage) service(parent, name string) *serviceusagepb.Service {
+	state := serviceusagepb.State_DISABLED
+	if f.enabled[name] {
+		state = serviceusagepb.State_ENABLED
+	}
+	return &serviceusagepb.Service{
+		Name:   parent + "/services/" + name,
+		Parent: parent,
+		State:  state,
+		Config: &serviceusagepb.ServiceConfig{Name: name},
+	}
+}
+
+func (f *fakeServiceUsage) ListServices(ctx context.Context, req *serviceusagepb.ListServicesRequest) (*serviceusagepb.ListServicesResponse, error) {
+	f.record("ListServices")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &serviceusagepb.ListServicesResponse{}
+	for name := range f.enabled {
+		if f.enabled[name] {
+			resp.Services = append(resp.Services, f.service(req.GetParent(), name))
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeServiceUsage) BatchGetServices(ctx context.Context, req *serviceusagepb.BatchGetServicesRequest) (*serviceusagepb.BatchGetServicesResponse, error) {
+	f.record("BatchGetServices")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &serviceusagepb.BatchGetServicesResponse{}
+	for _, name := range req.GetNames() {
+		parent, service, _ := strings.Cut(name, "/services/")
+		s := f.service(parent, service)
+		if f.notReady[service] > 0 {
+			f.notReady[service]--
+			s.State = serviceusagepb.State_DISABLED
+		}
+		resp.Services = append(resp.Services, s)
+	}
+	return resp, nil
+}
+
+func (f *fakeServiceUsage) BatchEnableServices(ctx context.Context, req *serviceusagepb.BatchEnableServicesRequest) (*longrunning.Operation, error) {
+	f.record("BatchEnableServices " + strings.Join(req.GetServiceIds(), ","))
+	if err := f.enable(req.GetServiceIds()); err != nil {
+		return nil, err
+	}
+	return doneOperation(&serviceusagepb.BatchEnableServicesResponse{})
+}
+
+func (f *fakeServiceUsage) EnableService(ctx context.Context, req *serviceusagepb.EnableServiceRequest) (*longrunning.Operation, error) {
+	_, service, _ := strings.Cut(req.GetName(), "/services/")
+	f.record("EnableService " + service)
+	if err := f.enable([]string{service}); err != nil {
+		return nil, err
+	}
+	return doneOperation(&serviceusagepb.EnableServiceResponse{})
+}
+
+func (f *fakeServiceUsage) DisableService(ctx context.Context, req *serviceusagepb.DisableServiceRequest) (*longrunning.Operation, error) {
+	_, service, _ := strings.Cut(req.GetName(), "/services/")
+	f.record("DisableService " + service)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.enabled, service)
+	return doneOperation(&serviceusagepb.DisableServiceResponse{})
+}
+
+func (f *fakeServiceUsage) enable(services []string) error {
+	if f.enableErr != nil {
+		if err := f.enableErr(services); err != nil {
+			return err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, service := range services {
+		f.enabled[service] = true
+	}
+	return nil
+}
+
+// doneOperation returns a completed long-running operation with the given response.
+func doneOperation(response proto.Message) (*longrunning.Operation, error) {
+	a, err := anypb.New(response)
+	if err != nil {
+		return nil, err
+	}
+	return &longrunning.Operation{
+		Name:   "operations/fake",
+		Done:   true,
+		Result: &longrunning.Operation_Response{Response: a},
+	}, nil
+}
+
+// fakeAPI is a fake for the HTTP-based Google APIs, serving the handlers registered with handle.
+// Requests that match no handler fail the test.
+type fakeAPI struct {
+	t      *testing.T
+	server *httptest.Server
+	mux    *http.ServeMux
+
+	mu       sync.Mutex
+	requests []fakeRequest
+}
+
+// fakeRequest is a request received by a fakeAPI.
+type fakeRequest struct {
+	// Call is the method and path, e.g. "GET /v3/projects/abc-test-1".
+	Call string
+	Body []byte
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	t.Helper()
+
+	f := &fakeAPI{t: t, mux: http.NewServeMux()}
+	f.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to fake API: %s %s", r.Method, r.URL.Path)
+		writeAPIError(w, http.StatusNotImplemented, "UNIMPLEMENTED", "not implemented by fake")
+	})
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.requests = append(f.requests, fakeRequest{Call: r.Method + " " + r.URL.Path, Body: body})
+		f.mu.Unlock()
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		f.mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// handle registers a handler, using http.ServeMux patterns such as "GET /v3/projects/abc-test-1".
+func (f *fakeAPI) handle(pattern string, handler http.HandlerFunc) {
+	f.mux.HandleFunc(pattern, handler)
+}
+
+// Requests returns the requests received so far.
+func (f *fakeAPI) Requests() []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeRequest(nil), f.requests...)
+}
+
+// Calls returns the method and path of the requests received so far.
+func (f *fakeAPI) Calls() []string {
+	var calls []string
+	for _, r := range f.Requests() {
+		calls = append(calls, r.Call)
+	}
+	return calls
+}
+
+// CallCount returns the number of requests received for the given method and path.
+func (f *fakeAPI) CallCount(call string) int {
+	n := 0
+	for _, r := range f.Requests() {
+		if r.Call == call {
+			n++
+		}
+	}
+	return n
+}
+
+// clientOptions returns the options for a client of the fake.
+func (f *fakeAPI) clientOptions() []option.ClientOption {
+	return []option.ClientOption{option.WithEndpoint(f.server.URL + "/"), option.WithoutAuthentication()}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes an error in the format of the Google APIs.
+func writeAPIError(w http.ResponseWriter, code int, status string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"code": code, "status": status, "message": message},
+	})
+}
+
+// respondJSON returns a handler that always writes v.
+func respondJSON(v any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, v)
+	}
+}
+
+// respondError returns a handler that always fails with the given error.
+func respondError(code int, status string, message string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, code, status, message)
+	}
+}
+
+// newTestProjectManager returns a ProjectManager whose HTTP-based clients talk to api,
+// and whose serviceusage client (if su is not nil) talks to su.
+// Retries are fast, so that tests of transient errors run quickly.
+func newTestProjectManager(t *testing.T, config *Config, api *fakeAPI, su *serviceusage.Client) *ProjectManager {
+	t.Helper()
+
+	ctx := context.Background()
+	p := NewProjectManager(config)
+	p.retryBaseDelay = time.Millisecond
+	p.retryMaxAttempts = 3
+	p.promptOut = io.Discard
+	p.serviceusageClient = su
+
+	if api != nil {
+		opts := api.clientOptions()
+		var err error
+		if p.crmService, err = cloudresourcemanager.NewService(ctx, opts...); err != nil {
+			t.Fatalf("error creating cloudresourcemanager client: %v", err)
+		}
+		if p.billingService, err = cloudbilling.NewService(ctx, opts...); err != nil {
+			t.Fatalf("error creating cloudbilling client: %v", err)
+		}
+		if p.iamService, err = iam.NewService(ctx, opts...); err != nil {
+			t.Fatalf("error creating iam client: %v", err)
+		}
+		if p.computeService, err = compute.NewService(ctx, opts...); err != nil {
+			t.Fatalf("error creating compute client: %v", err)
+		}
+		if p.orgPolicyService, err = orgpolicy.NewService(ctx, opts...); err != nil {
+			t.Fatalf("error creating orgpolicy client: %v", err)
+		}
+		if p.monitoringService, err = monitoring.NewService(ctx, opts...); err != nil {
+			t.Fatalf("error creating monitoring client: %v", err)
+		}
+	}
+	return p
+}
+
+// decodeBody decodes the JSON body of a request received by a fakeAPI.
+func decodeBody(t *testing.T, r fakeRequest, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("error decoding body of %s: %v", r.Call, err)
+	}
+}
+
+// fakeIAMPolicy serves the IAM policy of a project from a fakeAPI, checking etags on writes.
+type fakeIAMPolicy struct {
+	mu     sync.Mutex
+	policy *cloudresourcemanager.Policy
+	etag   int
+	// conflicts is the number of writes to fail with a concurrent modification error before accepting writes.
+	conflicts int
+	// concurrentWrite, if set, is applied to the policy when a write fails with a conflict, to simulate the other writer.
+	concurrentWrite func(policy *cloudresourcemanager.Policy)
+	// writes counts the accepted writes.
+	writes int
+}
+
+// handleIAMPolicy serves getIamPolicy and setIamPolicy for the project, starting from policy.
+func (f *fakeAPI) handleIAMPolicy(projectName string, policy *cloudresourcemanager.Policy) *fakeIAMPolicy {
+	fp := &fakeIAMPolicy{policy: policy}
+	f.handle("POST /v3/projects/"+projectName+":getIamPolicy", func(w http.ResponseWriter, r *http.Request) {
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		fp.policy.Etag = fmt.Sprintf("etag-%d", fp.etag)
+		writeJSON(w, fp.policy)
+	})
+	f.handle("POST /v3/projects/"+projectName+":setIamPolicy", func(w http.ResponseWriter, r *http.Request) {
+		var req cloudresourcemanager.SetIamPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+			return
+		}
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		if fp.conflicts > 0 {
+			fp.conflicts--
+			// Another writer got in first.
+			if fp.concurrentWrite != nil {
+				fp.concurrentWrite(fp.policy)
+			}
+			fp.etag++
+			writeAPIError(w, http.StatusConflict, "ABORTED", "There were concurrent policy changes.")
+			return
+		}
+		if req.Policy.Etag != fmt.Sprintf("etag-%d", fp.etag) {
+			writeAPIError(w, http.StatusConflict, "ABORTED", "etag mismatch")
+			return
+		}
+		fp.etag++
+		fp.writes++
+		fp.policy = req.Policy
+		fp.policy.Etag = fmt.Sprintf("etag-%d", fp.etag)
+		writeJSON(w, fp.policy)
+	})
+	return fp
+}
+
+// Policy returns the current policy.
+func (fp *fakeIAMPolicy) Policy() *cloudresourcemanager.Policy {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return fp.policy
+}
+
+// Members returns the members of the unconditional binding for role.
+func (fp *fakeIAMPolicy) Members(role string) []string {
+	for _, b := range fp.Policy().Bindings {
+		if b.Role == role && b.Condition == nil {
+			return b.Members
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// checkProjectAge refuses a destructive action on a project older than -max-project-age, unless -force is set.
+// This tool manages short-lived test projects; an old project is more likely a long-lived project targeted by mistake.
+func (p *ProjectManager) checkProjectAge(ctx context.Context, projectName string, action string) error {
+	log := klog.FromContext(ctx)
+
+	if p.maxProjectAge <= 0 {
+		return nil
+	}
+
+	project, err := p.getProject(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	if project == nil || project.CreateTime == "" {
+		return nil
+	}
+	createTime, err := time.Parse(time.RFC3339, project.CreateTime)
+	if err != nil {
+		return fmt.Errorf("error parsing createTime %q of project %q: %w", project.CreateTime, projectName, err)
+	}
+	age := time.Since(createTime)
+	if age <= p.maxProjectAge {
+		return nil
+	}
+	if p.force {
+		log.Info("project is older than max-project-age, proceeding because of -force", "project", projectName, "age", age.Round(time.Minute), "maxProjectAge", p.maxProjectAge, "action", action)
+		return nil
+	}
+	return fmt.Errorf("refusing to %s: project %q was created %v ago, which is older than -max-project-age=%v; use -force to override", action, projectName, age.Round(time.Minute), p.maxProjectAge)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestCheckProjectAge(t *testing.T) {
+	grid := []struct {
+		name          string
+		age           time.Duration
+		maxProjectAge time.Duration
+		force         bool
+		wantErr       bool
+	}{
+		{"guard disabled", 365 * 24 * time.Hour, 0, false, false},
+		{"young project", time.Hour, 24 * time.Hour, false, false},
+		{"old project", 30 * 24 * time.Hour, 24 * time.Hour, false, true},
+		{"old project with force", 30 * 24 * time.Hour, 24 * time.Hour, true, false},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{
+			Name:       "projects/123456789012",
+			ProjectId:  "abc-test-1",
+			State:      "ACTIVE",
+			CreateTime: time.Now().Add(-g.age).UTC().Format(time.RFC3339),
+		}))
+		p := newTestProjectManager(t, &Config{}, api, nil)
+		p.maxProjectAge = g.maxProjectAge
+		p.force = g.force
+
+		err := p.checkProjectAge(context.Background(), "abc-test-1", "delete project abc-test-1")
+		if (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+		if g.maxProjectAge == 0 && len(api.Calls()) != 0 {
+			t.Errorf("%s: expected no API calls when the guard is disabled, got %v", g.name, api.Calls())
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"k8s.io/klog/v2"
+)
+
+// IAMBinding grants a role on the project to members.
+type IAMBinding struct {
+	// Role is the role to grant, e.g. roles/viewer.
+	Role string `yaml:"role" json:"role"`
+	// Members are the members to grant the role to, e.g. serviceAccount:ci@example.iam.gserviceaccount.com.
+	// ${PROJECT_ID} and the expressions supported in namePattern are expanded.
+	Members []string `yaml:"members" json:"members"`
+	// Condition, if set, makes the binding conditional, e.g. on a tag of the project.
+	Condition *IAMCondition `yaml:"condition,omitempty" json:"condition,omitempty"`
+}
+
+// IAMCondition is the condition of a conditional IAM binding.
+type IAMCondition struct {
+	// Title identifies the condition, and must be set.
+	Title string `yaml:"title" json:"title"`
+	// Expression is the CEL expression that must be true for the binding to apply, e.g. resource.matchTag("123/env", "sandbox").
+	Expression string `yaml:"expression" json:"expression"`
+	// Description optionally describes the condition.
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// iamRoleKey identifies a binding in a policy: the role, and the condition if the binding is conditional.
+type iamRoleKey struct {
+	role      string
+	condition IAMCondition
+}
+
+// String returns the role, followed by the condition title if the binding is conditional.
+func (k iamRoleKey) String() string {
+	if k.condition == (IAMCondition{}) {
+		return k.role
+	}
+	return fmt.Sprintf("%s if %q", k.role, k.condition.Title)
+}
+
+// expr returns the condition in the form used by the API, or nil if the binding is unconditional.
+func (k iamRoleKey) expr() *cloudresourcemanager.Expr {
+	if k.condition == (IAMCondition{}) {
+		return nil
+	}
+	return &cloudresourcemanager.Expr{
+		Title:       k.condition.Title,
+		Expression:  k.condition.Expression,
+		Description: k.condition.Description,
+	}
+}
+
+// expandIAMBindings returns a copy of the bindings with ${PROJECT_ID} and the namePattern expressions expanded in the members.
+func expandIAMBindings(bindings []IAMBinding, projectName string, location *time.Location) ([]IAMBinding, error) {
+	var expanded []IAMBinding
+	for _, binding := range bindings {
+		var members []string
+		for _, member := range binding.Members {
+			member, err := expandPattern(strings.ReplaceAll(member, "${PROJECT_ID}", projectName), location)
+			if err != nil {
+				return nil, fmt.Errorf("error expanding member of iam binding for %q: %w", binding.Role, err)
+			}
+			members = append(members, member)
+		}
+		expanded = append(expanded, IAMBinding{Role: binding.Role, Members: members, Condition: binding.Condition})
+	}
+	return expanded, nil
+}
+
+// EnsureIAMBindings grants the configured roles on the project to their members.
+// Existing bindings are left in place; the policy is only written if a member is missing.
+func (p *ProjectManager) EnsureIAMBindings(ctx context.Context, projectName string) error {
+	if len(p.config.IAMBindings) == 0 {
+		return nil
+	}
+	roleMembers := make(map[iamRoleKey][]string)
+	for _, binding := range p.config.IAMBindings {
+		key := iamRoleKey{role: binding.Role}
+		if binding.Condition != nil {
+			key.condition = *binding.Condition
+		}
+		roleMembers[key] = append(roleMembers[key], binding.Members...)
+	}
+	return p.ensureProjectRoleMembers(ctx, projectName, roleMembers)
+}
+
+// iamPolicyVersion is the IAM policy version we read and write.
+// Version 3 is required to see (and so to preserve) conditional role bindings.
+const iamPolicyVersion = 3
+
+// getIAMPolicyRequest requests the policy at iamPolicyVersion.
+func getIAMPolicyRequest() *cloudresourcemanager.GetIamPolicyRequest {
+	return &cloudresourcemanager.GetIamPolicyRequest{
+		Options: &cloudresourcemanager.GetPolicyOptions{RequestedPolicyVersion: iamPolicyVersion},
+	}
+}
+
+// getIAMPolicy returns the IAM policy of the project, including any conditional bindings.
+func (p *ProjectManager) getIAMPolicy(ctx context.Context, projectName string) (*cloudresourcemanager.Policy, error) {
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := crmService.Projects.GetIamPolicy("projects/"+projectName, getIAMPolicyRequest()).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error getting iam policy for project %q: %w", projectName, err)
+	}
+	return policy, nil
+}
+
+// PrintIAMPolicy writes the project's current IAM policy to w as indented JSON.
+func (p *ProjectManager) PrintIAMPolicy(ctx context.Context, projectName string, w io.Writer) error {
+	policy, err := p.getIAMPolicy(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling iam policy: %w", err)
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("error writing iam policy: %w", err)
+	}
+	return nil
+}
+
+// addMembersToPolicy adds the members to the binding for role with the given condition (nil for an unconditional binding),
+// creating the binding if needed. It returns true if the policy was changed.
+func addMembersToPolicy(policy *cloudresourcemanager.Policy, role string, condition *cloudresourcemanager.Expr, members []string) bool {
+	var binding *cloudresourcemanager.Binding
+	for _, b := range policy.Bindings {
+		if b.Role == role && sameCondition(b.Condition, condition) {
+			binding = b
+			break
+		}
+	}
+	if binding == nil {
+		binding = &cloudresourcemanager.Binding{Role: role, Condition: condition}
+		policy.Bindings = append(policy.Bindings, binding)
+	}
+
+	changed := false
+	for _, member := range members {
+		if !slices.Contains(binding.Members, member) {
+			binding.Members = append(binding.Members, member)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// sameCondition returns true if the binding conditions are the same; a and b may be nil for unconditional bindings.
+func sameCondition(a, b *cloudresourcemanager.Expr) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Title == b.Title && a.Expression == b.Expression && a.Description == b.Description
+}
+
+// maxIAMPolicyWriteAttempts bounds the read-modify-write retries when the policy is modified concurrently.
+const maxIAMPolicyWriteAttempts = 5
+
+// ensureProjectRoleMembers makes sure that the members are granted each role on the project.
+// The policy is only written if something changed; the etag from the read protects against concurrent edits.
+// If another writer changes the policy between our read and write, we re-read and re-apply our changes.
+func (p *ProjectManager) ensureProjectRoleMembers(ctx context.Context, projectName string, roleMembers map[iamRoleKey][]string) error {
+	log := klog.FromContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		err := p.tryEnsureProjectRoleMembers(ctx, projectName, roleMembers)
+		if err == nil {
+			return nil
+		}
+		if !isConflict(err) || attempt >= maxIAMPolicyWriteAttempts {
+			return err
+		}
+		log.Info("iam policy was modified concurrently, retrying", "project", projectName, "attempt", attempt)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+// tryEnsureProjectRoleMembers performs a single read-modify-write of the project IAM policy.
+func (p *ProjectManager) tryEnsureProjectRoleMembers(ctx context.Context, projectName string, roleMembers map[iamRoleKey][]string) error {
+	log := klog.FromContext(ctx)
+
+	policy, err := p.getIAMPolicy(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	var changedRoles []string
+	for key, members := range roleMembers {
+		if addMembersToPolicy(policy, key.role, key.expr(), members) {
+			log.Info("adding iam binding", "project", projectName, "role", key.role, "condition", key.condition.Title, "members", members)
+			changedRoles = append(changedRoles, key.String())
+		}
+	}
+	if len(changedRoles) == 0 {
+		p.explainf(projectName, "all %d iam roles have their members -> skip policy update", len(roleMembers))
+		log.Info("iam policy already up to date", "project", projectName)
+		return nil
+	}
+	slices.Sort(changedRoles)
+	p.explainf(projectName, "%d of %d iam roles are missing members (%s) -> will update policy", len(changedRoles), len(roleMembers), strings.Join(changedRoles, ", "))
+
+	if p.dryRun {
+		log.Info("dry-run: would update iam policy", "project", projectName)
+		return nil
+	}
+
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return err
+	}
+	// We read the policy at version 3, so must write it as version 3 to keep (and add) conditional bindings.
+	policy.Version = iamPolicyVersion
+	req := &cloudresourcemanager.SetIamPolicyRequest{Policy: policy}
+	_, err = crmService.Projects.SetIamPolicy("projects/"+projectName, req).Context(ctx).Do()
+	p.audit(ctx, projectName, "set-iam-policy", "", err)
+	if err != nil {
+		return fmt.Errorf("error setting iam policy for project %q: %w", projectName, err)
+	}
+	log.Info("updated iam policy", "project", projectName)
+	return nil
+}
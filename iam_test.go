@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestGetIAMPolicyRequestVersion(t *testing.T) {
+	req := getIAMPolicyRequest()
+	if req.Options == nil || req.Options.RequestedPolicyVersion != 3 {
+		t.Errorf("expected policy version 3 to be requested, got %+v", req.Options)
+	}
+}
+
+func TestAddMembersToPolicyKeepsConditionalBindings(t *testing.T) {
+	condition := &cloudresourcemanager.Expr{Title: "sandbox", Expression: `resource.matchTag("123/env", "sandbox")`}
+	policy := &cloudresourcemanager.Policy{
+		Version: 3,
+		Bindings: []*cloudresourcemanager.Binding{
+			{Role: "roles/editor", Members: []string{"user:alice@example.com"}, Condition: condition},
+		},
+	}
+
+	if !addMembersToPolicy(policy, "roles/editor", nil, []string{"user:bob@example.com"}) {
+		t.Fatalf("expected the policy to change")
+	}
+	if len(policy.Bindings) != 2 {
+		t.Fatalf("expected a new unconditional binding, got %d bindings", len(policy.Bindings))
+	}
+	conditional, unconditional := policy.Bindings[0], policy.Bindings[1]
+	if conditional.Condition != condition || !slices.Equal(conditional.Members, []string{"user:alice@example.com"}) {
+		t.Errorf("conditional binding was modified: %+v", conditional)
+	}
+	if unconditional.Condition != nil || !slices.Equal(unconditional.Members, []string{"user:bob@example.com"}) {
+		t.Errorf("unexpected unconditional binding: %+v", unconditional)
+	}
+
+	if addMembersToPolicy(policy, "roles/editor", nil, []string{"user:bob@example.com"}) {
+		t.Errorf("expected no change when the member is already bound")
+	}
+}
+
+func TestEnsureIAMBindingsConditional(t *testing.T) {
+	condition := &IAMCondition{
+		Title:       "sandbox",
+		Expression:  `resource.matchTag("123/env", "sandbox")`,
+		Description: "Broad access to sandbox projects",
+	}
+	api := newFakeAPI(t)
+	api.handleIAMPolicy("abc-test-1", &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{{Role: "roles/editor", Members: []string{"user:admin@example.com"}}},
+	})
+	p := newTestProjectManager(t, &Config{IAMBindings: []IAMBinding{
+		{Role: "roles/editor", Members: []string{"group:devs@example.com"}, Condition: condition},
+	}}, api, nil)
+
+	ctx := context.Background()
+	if err := p.EnsureIAMBindings(ctx, "abc-test-1"); err != nil {
+		t.Fatalf("EnsureIAMBindings: %v", err)
+	}
+
+	var req struct {
+		Policy struct {
+			Version  int64 `json:"version"`
+			Bindings []struct {
+				Role      string   `json:"role"`
+				Members   []string `json:"members"`
+				Condition *struct {
+					Title       string `json:"title"`
+					Expression  string `json:"expression"`
+					Description string `json:"description"`
+				} `json:"condition"`
+			} `json:"bindings"`
+		} `json:"policy"`
+	}
+	var writes int
+	for _, r := range api.Requests() {
+		if r.Call == "POST /v3/projects/abc-test-1:setIamPolicy" {
+			decodeBody(t, r, &req)
+			writes++
+		}
+	}
+	if writes != 1 {
+		t.Fatalf("got %d policy writes, want 1", writes)
+	}
+	if req.Policy.Version != 3 {
+		t.Errorf("got policy version %d, want 3 for a conditional binding", req.Policy.Version)
+	}
+	if len(req.Policy.Bindings) != 2 {
+		t.Fatalf("got bindings %+v, want the unconditional binding and a new conditional one", req.Policy.Bindings)
+	}
+	if b := req.Policy.Bindings[0]; b.Condition != nil || !slices.Equal(b.Members, []string{"user:admin@example.com"}) {
+		t.Errorf("the unconditional binding was modified: %+v", b)
+	}
+	b := req.Policy.Bindings[1]
+	if b.Role != "roles/editor" || !slices.Equal(b.Members, []string{"group:devs@example.com"}) {
+		t.Errorf("unexpected conditional binding: %+v", b)
+	}
+	if b.Condition == nil || b.Condition.Title != condition.Title || b.Condition.Expression != condition.Expression || b.Condition.Description != condition.Description {
+		t.Errorf("got condition %+v, want %+v", b.Condition, condition)
+	}
+
+	// The conditional binding is found again, so the policy is not rewritten.
+	if err := p.EnsureIAMBindings(ctx, "abc-test-1"); err != nil {
+		t.Fatalf("EnsureIAMBindings: %v", err)
+	}
+	if n := api.CallCount("POST /v3/projects/abc-test-1:setIamPolicy"); n != 1 {
+		t.Errorf("got %d policy writes, want no write once the conditional binding exists", n)
+	}
+}
+
+func TestValidateIAMBindingCondition(t *testing.T) {
+	grid := []struct {
+		condition *IAMCondition
+		wantErr   bool
+	}{
+		{nil, false},
+		{&IAMCondition{Title: "sandbox", Expression: `resource.matchTag("123/env", "sandbox")`}, false},
+		{&IAMCondition{Title: "sandbox", Expression: " "}, true},
+		{&IAMCondition{Expression: `resource.matchTag("123/env", "sandbox")`}, true},
+	}
+	for _, g := range grid {
+		c := &Config{NamePattern: "abc-test-1", IAMBindings: []IAMBinding{
+			{Role: "roles/editor", Members: []string{"group:devs@example.com"}, Condition: g.condition},
+		}}
+		if err := validateConfig(c); (err != nil) != g.wantErr {
+			t.Errorf("condition %+v: got error %v, want error %v", g.condition, err, g.wantErr)
+		}
+	}
+}
+
+func TestEnsureIAMBindingsRetriesEtagConflict(t *testing.T) {
+	api := newFakeAPI(t)
+	policy := api.handleIAMPolicy("abc-test-1", &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{{Role: "roles/owner", Members: []string{"user:admin@example.com"}}},
+	})
+	policy.conflicts = 1
+	policy.concurrentWrite = func(p *cloudresourcemanager.Policy) {
+		p.Bindings = append(p.Bindings, &cloudresourcemanager.Binding{Role: "roles/browser", Members: []string{"user:other@example.com"}})
+	}
+
+	p := newTestProjectManager(t, &Config{IAMBindings: []IAMBinding{
+		{Role: "roles/viewer", Members: []string{"group:devs@example.com"}},
+	}}, api, nil)
+	if err := p.EnsureIAMBindings(context.Background(), "abc-test-1"); err != nil {
+		t.Fatalf("EnsureIAMBindings: %v", err)
+	}
+
+	if n := api.CallCount("POST /v3/projects/abc-test-1:getIamPolicy"); n != 2 {
+		t.Errorf("got %d policy reads, want 2 (the policy is re-read after the conflict)", n)
+	}
+	if n := api.CallCount("POST /v3/projects/abc-test-1:setIamPolicy"); n != 2 {
+		t.Errorf("got %d policy writes, want 2", n)
+	}
+	if policy.writes != 1 {
+		t.Errorf("got %d accepted writes, want 1", policy.writes)
+	}
+	// Our binding is applied on top of the concurrent writer's change, which is kept.
+	if got := policy.Members("roles/viewer"); !slices.Equal(got, []string{"group:devs@example.com"}) {
+		t.Errorf("got roles/viewer members %v", got)
+	}
+	if got := policy.Members("roles/browser"); !slices.Equal(got, []string{"user:other@example.com"}) {
+		t.Errorf("the concurrent change was lost: roles/browser members %v", got)
+	}
+	if got := policy.Policy().Version; got != iamPolicyVersion {
+		t.Errorf("got policy version %d, want %d", got, iamPolicyVersion)
+	}
+}
+
+func TestPrintIAMPolicyAfterBindings(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handleIAMPolicy("abc-test-1", &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{{Role: "roles/owner", Members: []string{"user:admin@example.com"}}},
+	})
+	p := newTestProjectManager(t, &Config{
+		IAMBindings: []IAMBinding{{Role: "roles/viewer", Members: []string{"group:dev@example.com"}}},
+	}, api, nil)
+
+	ctx := context.Background()
+	if err := p.EnsureIAMBindings(ctx, "abc-test-1"); err != nil {
+		t.Fatalf("EnsureIAMBindings: %v", err)
+	}
+	var out bytes.Buffer
+	if err := p.PrintIAMPolicy(ctx, "abc-test-1", &out); err != nil {
+		t.Fatalf("PrintIAMPolicy: %v", err)
+	}
+
+	var printed cloudresourcemanager.Policy
+	if err := json.Unmarshal(out.Bytes(), &printed); err != nil {
+		t.Fatalf("printed policy is not valid JSON: %v\n%s", err, out.String())
+	}
+	members := make(map[string][]string)
+	for _, binding := range printed.Bindings {
+		members[binding.Role] = binding.Members
+	}
+	want := map[string][]string{
+		"roles/owner":  {"user:admin@example.com"},
+		"roles/viewer": {"group:dev@example.com"},
+	}
+	if !reflect.DeepEqual(members, want) {
+		t.Errorf("got printed bindings %v, want %v", members, want)
+	}
+	if printed.Version != iamPolicyVersion {
+		t.Errorf("got printed policy version %d, want %d", printed.Version, iamPolicyVersion)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// identityProvider resolves the email of the identity used for API calls.
+type identityProvider interface {
+	CallerEmail(ctx context.Context) (string, error)
+}
+
+// tokenInfoURL is the endpoint that reports who an access token belongs to.
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// adcIdentity resolves the identity from Application Default Credentials.
+//
+// Service account keys and impersonation configs name the account directly;
+// for other credentials (gcloud user credentials, metadata server) we ask the
+// tokeninfo endpoint who the access token belongs to.
+type adcIdentity struct {
+	// httpClient is used to call the tokeninfo endpoint.
+	httpClient *http.Client
+	// tokenInfoURL overrides the tokeninfo endpoint, for tests.
+	tokenInfoURL string
+}
+
+// getIdentityProvider returns the identity provider, using the configured tls and proxy settings for tokeninfo.
+func (p *ProjectManager) getIdentityProvider() (identityProvider, error) {
+	if p.identity != nil {
+		return p.identity, nil
+	}
+	transport, err := p.baseTransport()
+	if err != nil {
+		return nil, err
+	}
+	p.identity = &adcIdentity{httpClient: &http.Client{Transport: transport}}
+	return p.identity, nil
+}
+
+// CallerEmail implements identityProvider.
+func (a *adcIdentity) CallerEmail(ctx context.Context) (string, error) {
+	creds, err := google.FindDefaultCredentials(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return "", fmt.Errorf("error finding default credentials: %w", err)
+	}
+
+	if len(creds.JSON) != 0 {
+		email, err := emailFromCredentialsJSON(creds.JSON)
+		if err != nil {
+			return "", err
+		}
+		if email != "" {
+			return email, nil
+		}
+	}
+
+	token, err := creds.TokenSource.Token()
+	if err != nil {
+		return "", fmt.Errorf("error getting access token: %w", err)
+	}
+	return a.tokenInfoEmail(ctx, token.AccessToken)
+}
+
+// emailFromCredentialsJSON returns the account named by a service account key or impersonation config,
+// or "" if the credentials do not name one.
+func emailFromCredentialsJSON(b []byte) (string, error) {
+	var f struct {
+		ClientEmail                    string `json:"client_email"`
+		ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return "", fmt.Errorf("error parsing default credentials: %w", err)
+	}
+	if f.ClientEmail != "" {
+		return f.ClientEmail, nil
+	}
+	// e.g. https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa@example.iam.gserviceaccount.com:generateAccessToken
+	if f.ServiceAccountImpersonationURL != "" {
+		_, account, found := strings.Cut(f.ServiceAccountImpersonationURL, "/serviceAccounts/")
+		if found {
+			account, _, _ = strings.Cut(account, ":")
+			return account, nil
+		}
+	}
+	return "", nil
+}
+
+// tokenInfoEmail asks the tokeninfo endpoint for the email of the access token's owner.
+// The token is sent in the POST body rather than the URL, so that it cannot leak into error messages or logs.
+func (a *adcIdentity) tokenInfoEmail(ctx context.Context, accessToken string) (string, error) {
+	endpoint := a.tokenInfoURL
+	if endpoint == "" {
+		endpoint = tokenInfoURL
+	}
+	form := url.Values{"access_token": {accessToken}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("error building tokeninfo request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpClient := a.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling tokeninfo: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from tokeninfo: %v", resp.Status)
+	}
+	var info struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("error parsing tokeninfo response: %w", err)
+	}
+	if info.Email == "" {
+		return "", fmt.Errorf("tokeninfo did not return an email (is the userinfo.email scope granted?)")
+	}
+	return info.Email, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeIdentity is an identityProvider that returns a fixed email or error.
+type fakeIdentity struct {
+	email string
+	err   error
+}
+
+func (f *fakeIdentity) CallerEmail(ctx context.Context) (string, error) {
+	return f.email, f.err
+}
+
+func TestSetupCommandEnvActorEmail(t *testing.T) {
+	p := NewProjectManager(&Config{})
+	p.identity = &fakeIdentity{email: "ci@example.iam.gserviceaccount.com"}
+
+	env := p.setupCommandEnv(context.Background(), "abc-test-1", "123456789012")
+	for _, want := range []string{"PROJECT_ID=abc-test-1", "PROJECT_NUMBER=123456789012", "ACTOR_EMAIL=ci@example.iam.gserviceaccount.com"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("expected %q in setup command environment", want)
+		}
+	}
+}
+
+func TestSetupCommandEnvWithoutIdentity(t *testing.T) {
+	p := NewProjectManager(&Config{})
+	p.identity = &fakeIdentity{err: errors.New("no credentials")}
+
+	env := p.setupCommandEnv(context.Background(), "abc-test-1", "123456789012")
+	// Only PROJECT_ID and PROJECT_NUMBER are added to our own environment.
+	want := append(os.Environ(), "PROJECT_ID=abc-test-1", "PROJECT_NUMBER=123456789012")
+	if !slices.Equal(env, want) {
+		t.Errorf("got environment %v, want %v", env, want)
+	}
+}
+
+func TestEmailFromCredentialsJSON(t *testing.T) {
+	grid := []struct {
+		json string
+		want string
+	}{
+		{`{"type": "service_account", "client_email": "sa@example.iam.gserviceaccount.com"}`, "sa@example.iam.gserviceaccount.com"},
+		{`{"type": "impersonated_service_account", "service_account_impersonation_url": "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa@example.iam.gserviceaccount.com:generateAccessToken"}`, "sa@example.iam.gserviceaccount.com"},
+		{`{"type": "authorized_user", "client_id": "123"}`, ""},
+	}
+	for _, g := range grid {
+		got, err := emailFromCredentialsJSON([]byte(g.json))
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", g.json, err)
+			continue
+		}
+		if got != g.want {
+			t.Errorf("got %q for %s, want %q", got, g.json, g.want)
+		}
+	}
+}
+
+func TestTokenInfoEmailSendsTokenInBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("got method %q, want POST", r.Method)
+		}
+		if r.URL.RawQuery != "" {
+			t.Errorf("the token must not be sent in the URL, got query %q", r.URL.RawQuery)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("error parsing form: %v", err)
+		}
+		if got := r.PostForm.Get("access_token"); got != "token-123" {
+			t.Errorf("got access_token %q, want token-123", got)
+		}
+		w.Write([]byte(`{"email": "user@example.com"}`))
+	}))
+	defer server.Close()
+
+	a := &adcIdentity{httpClient: server.Client(), tokenInfoURL: server.URL}
+	email, err := a.tokenInfoEmail(context.Background(), "token-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if email != "user@example.com" {
+		t.Errorf("got email %q, want user@example.com", email)
+	}
+}
+
+func TestTokenInfoEmailErrorDoesNotLeakToken(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	a := &adcIdentity{tokenInfoURL: url}
+	_, err := a.tokenInfoEmail(context.Background(), "token-123")
+	if err == nil {
+		t.Fatalf("expected an error calling a closed server")
+	}
+	if strings.Contains(err.Error(), "token-123") {
+		t.Errorf("error leaks the access token: %v", err)
+	}
+}
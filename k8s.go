@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// KubernetesManifestConfig configures the Kubernetes objects we render describing the project.
+type KubernetesManifestConfig struct {
+	// Name is the name of the ConfigMap (and Secret); defaults to gcp-project.
+	Name string `yaml:"name" json:"name"`
+	// Namespace is the namespace of the objects; defaults to default.
+	Namespace string `yaml:"namespace" json:"namespace"`
+	// Secret also renders a Secret with the same data, for workloads that consume secrets.
+	Secret bool `yaml:"secret" json:"secret"`
+}
+
+// WriteKubernetesManifest renders the project details as Kubernetes objects and writes them to path.
+// If path is "-", the manifest is written to stdout.
+func (p *ProjectManager) WriteKubernetesManifest(ctx context.Context, projectName string, path string) error {
+	log := klog.FromContext(ctx)
+
+	data, err := p.projectOutputData(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	b, err := renderKubernetesManifest(p.config.KubernetesManifest, data)
+	if err != nil {
+		return err
+	}
+
+	if path == "-" {
+		if _, err := os.Stdout.Write(b); err != nil {
+			return fmt.Errorf("error writing kubernetes manifest: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("error writing kubernetes manifest to %q: %w", path, err)
+	}
+	log.Info("wrote kubernetes manifest", "project", projectName, "path", path)
+	return nil
+}
+
+// renderKubernetesManifest renders a ConfigMap (and optionally a Secret) containing data, as multi-document YAML.
+func renderKubernetesManifest(c KubernetesManifestConfig, data map[string]string) ([]byte, error) {
+	name := c.Name
+	if name == "" {
+		name = "gcp-project"
+	}
+	namespace := c.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	metadata := map[string]any{
+		"name":      name,
+		"namespace": namespace,
+	}
+
+	objects := []map[string]any{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   metadata,
+			"data":       data,
+		},
+	}
+	if c.Secret {
+		objects = append(objects, map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   metadata,
+			"type":       "Opaque",
+			"stringData": data,
+		})
+	}
+
+	var out []byte
+	for i, obj := range objects {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling %v: %w", obj["kind"], err)
+		}
+		if i != 0 {
+			out = append(out, []byte("---\n")...)
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestRenderKubernetesManifest(t *testing.T) {
+	data := map[string]string{
+		"PROJECT_ID":      "abc-test-1",
+		"PROJECT_NUMBER":  "123456789012",
+		"BILLING_ACCOUNT": "billingAccounts/012345-6789AB-CDEF01",
+	}
+
+	grid := []struct {
+		name          string
+		config        KubernetesManifestConfig
+		wantName      string
+		wantNamespace string
+		wantKinds     []string
+	}{
+		{"defaults", KubernetesManifestConfig{}, "gcp-project", "default", []string{"ConfigMap"}},
+		{"configured", KubernetesManifestConfig{Name: "project-info", Namespace: "platform"}, "project-info", "platform", []string{"ConfigMap"}},
+		{"with secret", KubernetesManifestConfig{Secret: true}, "gcp-project", "default", []string{"ConfigMap", "Secret"}},
+	}
+	for _, g := range grid {
+		b, err := renderKubernetesManifest(g.config, data)
+		if err != nil {
+			t.Fatalf("%s: renderKubernetesManifest: %v", g.name, err)
+		}
+
+		docs := strings.Split(string(b), "---\n")
+		if len(docs) != len(g.wantKinds) {
+			t.Fatalf("%s: got %d documents, want %d:\n%s", g.name, len(docs), len(g.wantKinds), b)
+		}
+		for i, doc := range docs {
+			var obj struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+				Metadata   struct {
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"metadata"`
+				Data       map[string]string `json:"data"`
+				StringData map[string]string `json:"stringData"`
+			}
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+				t.Fatalf("%s: error parsing document %d: %v", g.name, i, err)
+			}
+			if obj.APIVersion != "v1" || obj.Kind != g.wantKinds[i] {
+				t.Errorf("%s: document %d is %s %s, want v1 %s", g.name, i, obj.APIVersion, obj.Kind, g.wantKinds[i])
+			}
+			if obj.Metadata.Name != g.wantName || obj.Metadata.Namespace != g.wantNamespace {
+				t.Errorf("%s: document %d is %s/%s, want %s/%s", g.name, i, obj.Metadata.Namespace, obj.Metadata.Name, g.wantNamespace, g.wantName)
+			}
+			got := obj.Data
+			if obj.Kind == "Secret" {
+				got = obj.StringData
+			}
+			for k, v := range data {
+				if got[k] != v {
+					t.Errorf("%s: %s %s = %q, want %q", g.name, obj.Kind, k, got[k], v)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"k8s.io/klog/v2"
+)
+
+// expandLabels expands the ${...} expressions in the label values, as for the project name.
+func expandLabels(labels map[string]string, location *time.Location) (map[string]string, error) {
+	if len(labels) == 0 {
+		return labels, nil
+	}
+	expanded := make(map[string]string, len(labels))
+	for k, v := range labels {
+		s, err := expandPattern(v, location)
+		if err != nil {
+			return nil, fmt.Errorf("error expanding label %q: %w", k, err)
+		}
+		expanded[k] = s
+	}
+	return expanded, nil
+}
+
+// ciRunLabel records the CI pipeline run that provisioned or last reconciled a project, from -ci-run-id.
+const ciRunLabel = "ci-run"
+
+// labelValuePattern matches valid label values: up to 63 lowercase letters, digits, underscores and dashes.
+var labelValuePattern = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_-]{0,63}$`)
+
+// validateLabelValue returns an error if value cannot be used as a label value.
+func validateLabelValue(value string) error {
+	if !labelValuePattern.MatchString(value) {
+		return fmt.Errorf("label value %q is not valid: it must be at most 63 lowercase letters, digits, underscores and dashes", value)
+	}
+	return nil
+}
+
+// withCIRunLabel returns the labels with the ci-run label set to ciRunID, if it is set.
+// The other labels are kept; a ci-run label set in the config takes precedence.
+func withCIRunLabel(labels map[string]string, ciRunID string) map[string]string {
+	if ciRunID == "" {
+		return labels
+	}
+	if _, found := labels[ciRunLabel]; found {
+		return labels
+	}
+	merged := maps.Clone(labels)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	merged[ciRunLabel] = ciRunID
+	return merged
+}
+
+// protectedLabels are the labels that -prune-labels never removes, as they record who manages a project
+// and when it expires.
+var protectedLabels = []string{"managed-by", "expires-at"}
+
+// ensureProjectMetadata reconciles the display name and labels of an existing project, with a single Patch
+// whose update mask lists only the fields that differ.
+// The display name is only reconciled if it is set in projectOverrides; labels on the project that are not
+// in the config are left as-is, unless -prune-labels is set, when they are removed (except protectedLabels).
+func (p *ProjectManager) ensureProjectMetadata(ctx context.Context, project *cloudresourcemanager.Project) error {
+	log := klog.FromContext(ctx)
+
+	patch := &cloudresourcemanager.Project{}
+	var updateMask []string
+
+	if displayName, ok := p.config.ProjectOverrides["displayName"].(string); ok && displayName != project.DisplayName {
+		patch.DisplayName = displayName
+		updateMask = append(updateMask, "displayName")
+	}
+
+	labels := maps.Clone(project.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labelsChanged := false
+	for k, v := range p.config.Labels {
+		if current, found := labels[k]; !found || current != v {
+			labels[k] = v
+			labelsChanged = true
+		}
+	}
+	if p.pruneLabels {
+		for k := range labels {
+			if _, found := p.config.Labels[k]; !found && !slices.Contains(protectedLabels, k) {
+				log.Info("removing label not in config", "project", project.ProjectId, "label", k)
+				delete(labels, k)
+				labelsChanged = true
+			}
+		}
+	}
+	if labelsChanged {
+		patch.Labels = labels
+		updateMask = append(updateMask, "labels")
+	}
+
+	if len(updateMask) == 0 {
+		log.V(2).Info("project display name and labels are up to date", "project", project.ProjectId)
+		return nil
+	}
+
+	if p.dryRun {
+		log.Info("dry-run: would update project", "project", project.ProjectId, "fields", updateMask, "displayName", patch.DisplayName, "labels", patch.Labels)
+		return nil
+	}
+
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Info("updating project", "project", project.ProjectId, "fields", updateMask, "displayName", patch.DisplayName, "labels", patch.Labels)
+	var op *cloudresourcemanager.Operation
+	err = p.retryWithBackoff(ctx, func() error {
+		var err error
+		op, err = crmService.Projects.Patch(project.Name, patch).UpdateMask(strings.Join(updateMask, ",")).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("error updating %s on project %q: %w", strings.Join(updateMask, " and "), project.ProjectId, err)
+	} else {
+		op, err = p.waitForOperation(ctx, op)
+		if err == nil && op.Error != nil {
+			err = fmt.Errorf("error from project update operation: %v", op.Error)
+		}
+	}
+	p.audit(ctx, project.ProjectId, "update-project", strings.Join(updateMask, ","), err)
+	return err
+}
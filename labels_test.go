@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestEnsureProjectMetadataSinglePatch(t *testing.T) {
+	existing := &cloudresourcemanager.Project{
+		Name:        "projects/123456789012",
+		ProjectId:   "abc-test-1",
+		DisplayName: "abc-test-1",
+		Labels:      map[string]string{"team": "infra", "owner": "alice"},
+	}
+
+	grid := []struct {
+		name       string
+		config     Config
+		wantMask   string
+		wantLabels map[string]string
+	}{
+		{
+			name:       "both drift",
+			config:     Config{Labels: map[string]string{"team": "data"}, ProjectOverrides: map[string]any{"displayName": "ABC Test"}},
+			wantMask:   "displayName,labels",
+			wantLabels: map[string]string{"team": "data", "owner": "alice"},
+		},
+		{
+			name:     "display name only",
+			config:   Config{Labels: map[string]string{"team": "infra"}, ProjectOverrides: map[string]any{"displayName": "ABC Test"}},
+			wantMask: "displayName",
+		},
+		{
+			name:       "labels only",
+			config:     Config{Labels: map[string]string{"env": "dev"}, ProjectOverrides: map[string]any{"displayName": "abc-test-1"}},
+			wantMask:   "labels",
+			wantLabels: map[string]string{"team": "infra", "owner": "alice", "env": "dev"},
+		},
+		{
+			name:   "up to date",
+			config: Config{Labels: map[string]string{"team": "infra"}},
+		},
+	}
+	for _, g := range grid {
+		var masks []string
+		api := newFakeAPI(t)
+		api.handle("PATCH /v3/projects/123456789012", func(w http.ResponseWriter, r *http.Request) {
+			masks = append(masks, r.URL.Query().Get("updateMask"))
+			writeJSON(w, &cloudresourcemanager.Operation{Name: "operations/cp.456", Done: true})
+		})
+		p := newTestProjectManager(t, &g.config, api, nil)
+
+		if err := p.ensureProjectMetadata(context.Background(), existing); err != nil {
+			t.Errorf("%s: ensureProjectMetadata: %v", g.name, err)
+			continue
+		}
+		if g.wantMask == "" {
+			if len(masks) != 0 {
+				t.Errorf("%s: expected no Patch, got masks %v", g.name, masks)
+			}
+			continue
+		}
+		if len(masks) != 1 {
+			t.Errorf("%s: got %d Patch calls, want 1", g.name, len(masks))
+			continue
+		}
+		if masks[0] != g.wantMask {
+			t.Errorf("%s: got update mask %q, want %q", g.name, masks[0], g.wantMask)
+		}
+		patch := &cloudresourcemanager.Project{}
+		decodeBody(t, api.Requests()[0], patch)
+		if !reflect.DeepEqual(patch.Labels, g.wantLabels) {
+			t.Errorf("%s: got labels %v, want %v", g.name, patch.Labels, g.wantLabels)
+		}
+	}
+}
+
+func TestEnsureProjectMetadataPruneLabels(t *testing.T) {
+	existing := &cloudresourcemanager.Project{
+		Name:      "projects/123456789012",
+		ProjectId: "abc-test-1",
+		Labels:    map[string]string{"team": "infra", "stale": "yes", "managed-by": "gcpx", "expires-at": "20261231"},
+	}
+
+	grid := []struct {
+		name        string
+		pruneLabels bool
+		wantLabels  map[string]string
+	}{
+		{"without -prune-labels", false, nil},
+		{"with -prune-labels", true, map[string]string{"team": "infra", "managed-by": "gcpx", "expires-at": "20261231"}},
+	}
+	for _, g := range grid {
+		var masks []string
+		api := newFakeAPI(t)
+		api.handle("PATCH /v3/projects/123456789012", func(w http.ResponseWriter, r *http.Request) {
+			masks = append(masks, r.URL.Query().Get("updateMask"))
+			writeJSON(w, &cloudresourcemanager.Operation{Name: "operations/cp.456", Done: true})
+		})
+		p := newTestProjectManager(t, &Config{Labels: map[string]string{"team": "infra"}}, api, nil)
+		p.pruneLabels = g.pruneLabels
+
+		if err := p.ensureProjectMetadata(context.Background(), existing); err != nil {
+			t.Errorf("%s: ensureProjectMetadata: %v", g.name, err)
+			continue
+		}
+		if g.wantLabels == nil {
+			// The config's labels are already present, so there is nothing to change.
+			if len(masks) != 0 {
+				t.Errorf("%s: expected no Patch, got masks %v", g.name, masks)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(masks, []string{"labels"}) {
+			t.Errorf("%s: got update masks %v, want a single labels Patch", g.name, masks)
+			continue
+		}
+		patch := &cloudresourcemanager.Project{}
+		decodeBody(t, api.Requests()[0], patch)
+		if !reflect.DeepEqual(patch.Labels, g.wantLabels) {
+			t.Errorf("%s: got labels %v, want %v", g.name, patch.Labels, g.wantLabels)
+		}
+	}
+}
+
+func TestWithCIRunLabel(t *testing.T) {
+	grid := []struct {
+		name    string
+		labels  map[string]string
+		ciRunID string
+		want    map[string]string
+	}{
+		{"not set", map[string]string{"team": "infra"}, "", map[string]string{"team": "infra"}},
+		{"merged", map[string]string{"team": "infra"}, "12345", map[string]string{"team": "infra", "ci-run": "12345"}},
+		{"no labels", nil, "12345", map[string]string{"ci-run": "12345"}},
+		{"set in config", map[string]string{"ci-run": "pinned"}, "12345", map[string]string{"ci-run": "pinned"}},
+	}
+	for _, g := range grid {
+		if got := withCIRunLabel(g.labels, g.ciRunID); !reflect.DeepEqual(got, g.want) {
+			t.Errorf("%s: got %v, want %v", g.name, got, g.want)
+		}
+	}
+
+	// The config's labels are not modified.
+	labels := map[string]string{"team": "infra"}
+	withCIRunLabel(labels, "12345")
+	if _, found := labels["ci-run"]; found {
+		t.Errorf("withCIRunLabel modified its argument")
+	}
+}
+
+func TestValidateLabelValue(t *testing.T) {
+	for _, value := range []string{"", "12345", "main-build_7", strings.Repeat("a", 63)} {
+		if err := validateLabelValue(value); err != nil {
+			t.Errorf("validateLabelValue(%q): unexpected error: %v", value, err)
+		}
+	}
+	for _, value := range []string{"Build-7", "7.1", "a/b", "ci run", strings.Repeat("a", 64)} {
+		if err := validateLabelValue(value); err == nil {
+			t.Errorf("validateLabelValue(%q): expected an error", value)
+		}
+	}
+}
+
+func TestEnsureProjectMetadataCIRunLabel(t *testing.T) {
+	existing := &cloudresourcemanager.Project{
+		Name:      "projects/123456789012",
+		ProjectId: "abc-test-1",
+		Labels:    map[string]string{"team": "infra", "owner": "alice", "ci-run": "100"},
+	}
+	api := newFakeAPI(t)
+	api.handle("PATCH /v3/projects/123456789012", respondJSON(&cloudresourcemanager.Operation{Name: "operations/cp.456", Done: true}))
+	p := newTestProjectManager(t, &Config{Labels: withCIRunLabel(map[string]string{"team": "infra"}, "200")}, api, nil)
+
+	if err := p.ensureProjectMetadata(context.Background(), existing); err != nil {
+		t.Fatalf("ensureProjectMetadata: %v", err)
+	}
+	patch := &cloudresourcemanager.Project{}
+	decodeBody(t, api.Requests()[0], patch)
+	// The label is updated to the current run; labels not in the config are kept.
+	if want := map[string]string{"team": "infra", "owner": "alice", "ci-run": "200"}; !reflect.DeepEqual(patch.Labels, want) {
+		t.Errorf("got labels %v, want %v", patch.Labels, want)
+	}
+}
+
+func TestEnsureProjectMetadataRetriesTransientErrors(t *testing.T) {
+	existing := &cloudresourcemanager.Project{
+		Name:      "projects/123456789012",
+		ProjectId: "abc-test-1",
+		Labels:    map[string]string{"team": "data"},
+	}
+	var patches atomic.Int32
+	api := newFakeAPI(t)
+	api.handle("PATCH /v3/projects/123456789012", func(w http.ResponseWriter, r *http.Request) {
+		if patches.Add(1) == 1 {
+			writeAPIError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "try again")
+			return
+		}
+		writeJSON(w, &cloudresourcemanager.Operation{Name: "operations/cp.456", Done: true})
+	})
+	p := newTestProjectManager(t, &Config{Labels: map[string]string{"team": "infra"}}, api, nil)
+
+	if err := p.ensureProjectMetadata(context.Background(), existing); err != nil {
+		t.Fatalf("ensureProjectMetadata: %v", err)
+	}
+	if got := patches.Load(); got != 2 {
+		t.Errorf("got %d Patch calls, want 2 (the 503 is retried)", got)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"k8s.io/klog/v2"
+)
+
+// listProjectLiens returns the liens on the project, which block its deletion.
+// project.Name is used as the parent, as liens are listed by project number.
+func (p *ProjectManager) listProjectLiens(ctx context.Context, project *cloudresourcemanager.Project) ([]*cloudresourcemanager.Lien, error) {
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var liens []*cloudresourcemanager.Lien
+	if err := crmService.Liens.List().Parent(project.Name).Pages(ctx, func(resp *cloudresourcemanager.ListLiensResponse) error {
+		liens = append(liens, resp.Liens...)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("error listing liens on project %q: %w", project.ProjectId, err)
+	}
+	return liens, nil
+}
+
+// liensBlockDeletionError explains that the liens must be removed (or -remove-liens used) before the project can be deleted.
+func liensBlockDeletionError(projectName string, liens []*cloudresourcemanager.Lien) error {
+	var descriptions []string
+	for _, lien := range liens {
+		descriptions = append(descriptions, fmt.Sprintf("%s (origin %q, reason %q)", lien.Name, lien.Origin, lien.Reason))
+	}
+	return fmt.Errorf("project %q cannot be deleted because it has %d lien(s): %s; remove them, or use -remove-liens to remove them before deleting", projectName, len(liens), strings.Join(descriptions, ", "))
+}
+
+// deleteLiens deletes the liens, so that the project can be deleted.
+func (p *ProjectManager) deleteLiens(ctx context.Context, projectName string, liens []*cloudresourcemanager.Lien) error {
+	log := klog.FromContext(ctx)
+
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return err
+	}
+	for _, lien := range liens {
+		log.Info("removing lien that blocks deletion", "project", projectName, "lien", lien.Name, "origin", lien.Origin, "reason", lien.Reason)
+		_, err := crmService.Liens.Delete(lien.Name).Context(ctx).Do()
+		if err != nil && isNotFound(err) {
+			log.Info("lien already removed", "project", projectName, "lien", lien.Name)
+			continue
+		}
+		p.audit(ctx, projectName, "remove-lien", lien.Name, err)
+		if err != nil {
+			return fmt.Errorf("error removing lien %q: %w", lien.Name, err)
+		}
+	}
+	return nil
+}
@@ -2,51 +2,328 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/api/option"
+	"google.golang.org/api/orgpolicy/v2"
+	"google.golang.org/grpc"
 
 	serviceusage "cloud.google.com/go/serviceusage/apiv1"
 	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
 	"google.golang.org/api/cloudbilling/v1"
 	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iam/v1"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/monitoring/v3"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/yaml"
 )
 
 type Config struct {
-	NamePattern    string   `yaml:"namePattern"`
-	Parent         string   `yaml:"parent"`
-	BillingAccount string   `yaml:"billingAccount"`
-	Services       []string `yaml:"services"`
-	SetupCommands  []string `yaml:"setupCommands"`
+	NamePattern    string   `yaml:"namePattern" json:"namePattern"`
+	Parent         string   `yaml:"parent" json:"parent"`
+	BillingAccount string   `yaml:"billingAccount" json:"billingAccount"`
+	Services       []string `yaml:"services" json:"services"`
+	SetupCommands  []string `yaml:"setupCommands" json:"setupCommands"`
+
+	// ParentFrom is the name of an environment variable holding the parent.
+	// If the variable is set, it takes precedence over Parent (but not over the -parent flag).
+	ParentFrom string `yaml:"parentFrom" json:"parentFrom"`
+
+	// Labels are set on the project. Values are expanded like NamePattern.
+	// Labels on an existing project are reconciled; labels not listed here are left as-is.
+	Labels map[string]string `yaml:"labels" json:"labels"`
+
+	// ProjectOverrides are extra fields of the Project sent when creating it, merged in as a JSON merge patch,
+	// for fields the tool does not model itself (e.g. tags). Fields the tool manages (projectId, parent) cannot be set.
+	ProjectOverrides map[string]any `yaml:"projectOverrides" json:"projectOverrides"`
+
+	// ProjectNumberHint is a requested project number.
+	// The resource manager API does not allow choosing the project number,
+	// so this is validated and reported but cannot be honored.
+	ProjectNumberHint string `yaml:"projectNumberHint" json:"projectNumberHint"`
+
+	// BillingLinkPolicy controls what we do when the project is already linked to a billing account.
+	// One of ensure (the default), skip-if-linked or fail-if-different.
+	BillingLinkPolicy string `yaml:"billingLinkPolicy" json:"billingLinkPolicy"`
+
+	// SetupCommandsTemplate renders each setup command as a Go template, instead of only substituting ${PROJECT_ID}.
+	SetupCommandsTemplate bool `yaml:"setupCommandsTemplate" json:"setupCommandsTemplate"`
+
+	// SetupCommandTimeout is how long each setup command may run before it is killed, as a duration (e.g. 5m).
+	// Defaults to 10m; the -command-timeout flag takes precedence.
+	SetupCommandTimeout string `yaml:"setupCommandTimeout" json:"setupCommandTimeout"`
+
+	// SetupCommandsInitialDelay is how long to wait before the first setup command when the project was just created,
+	// as a duration (e.g. 30s), to allow for propagation delays. Defaults to no delay.
+	SetupCommandsInitialDelay string `yaml:"setupCommandsInitialDelay" json:"setupCommandsInitialDelay"`
+
+	// SetupCommandsPhase controls where in the pipeline the setup commands run.
+	// One of before-services, after-services or after-all (the default).
+	SetupCommandsPhase string `yaml:"setupCommandsPhase" json:"setupCommandsPhase"`
+
+	// CreateWhen is a condition that must be true for the tool to make any changes, e.g. `${env.BRANCH} == main`.
+	// If it evaluates to false, the run is skipped.
+	CreateWhen string `yaml:"createWhen" json:"createWhen"`
+
+	// Phases lists the phases to run, in order. Phases that are not listed are skipped.
+	// If empty, all phases run in the default order.
+	Phases []string `yaml:"phases" json:"phases"`
+
+	// SkipServicesBlockedByOrgPolicy skips (and reports) services that cannot be enabled because
+	// the constraints/serviceuser.services org policy denies them, instead of failing the run.
+	SkipServicesBlockedByOrgPolicy bool `yaml:"skipServicesBlockedByOrgPolicy" json:"skipServicesBlockedByOrgPolicy"`
+
+	// ServiceGroups are sets of services that are enabled all-or-nothing, after Services.
+	ServiceGroups []ServiceGroupConfig `yaml:"serviceGroups" json:"serviceGroups"`
+
+	// Timeouts are the timeouts of phases, keyed by phase name (e.g. create: 3m), or default for unlisted phases.
+	Timeouts map[string]string `yaml:"timeouts" json:"timeouts"`
+
+	// IAMBindings grant roles on the project to members.
+	IAMBindings []IAMBinding `yaml:"iamBindings" json:"iamBindings"`
+
+	// ServiceAccounts are service accounts to create in the project.
+	ServiceAccounts []ServiceAccountConfig `yaml:"serviceAccounts" json:"serviceAccounts"`
+
+	// CMEKRequiredServices are services that must use customer-managed encryption keys,
+	// enforced on the project with the gcp.restrictNonCmekServices org policy.
+	CMEKRequiredServices []string `yaml:"cmekRequiredServices" json:"cmekRequiredServices"`
+
+	// ComputeProjectSettings are project-wide Compute Engine settings to apply.
+	ComputeProjectSettings ComputeProjectSettings `yaml:"computeProjectSettings" json:"computeProjectSettings"`
+
+	// SharedVPC attaches the project to a Shared VPC host project.
+	SharedVPC SharedVPCConfig `yaml:"sharedVPC" json:"sharedVPC"`
+
+	// KubernetesManifest configures the manifest written with -k8s-manifest.
+	KubernetesManifest KubernetesManifestConfig `yaml:"kubernetesManifest" json:"kubernetesManifest"`
+
+	// TLS configures custom certificates for outbound API calls.
+	TLS TLSConfig `yaml:"tls" json:"tls"`
+
+	// Proxy is the URL of the proxy for outbound API calls.
+	// If not set, the proxy is taken from the environment (HTTPS_PROXY etc).
+	Proxy string `yaml:"proxy" json:"proxy"`
+
+	// Projects lists the projects to manage with this config.
+	// Fields not set on a project (parent, billing account, services, setup commands) default to the top-level values.
+	// If empty, the top-level fields describe a single project.
+	Projects []ProjectConfig `yaml:"projects" json:"projects"`
+
+	// PostRunCommands are run once, after all the projects have been reconciled, e.g. to update a central registry.
+	// The IDs of the reconciled projects are passed in $PROJECT_IDS, separated by spaces.
+	PostRunCommands []string `yaml:"postRunCommands" json:"postRunCommands"`
+	// PostRunCommandsOnFailure also runs the postRunCommands when the run failed, with $RUN_RESULT set to failure.
+	PostRunCommandsOnFailure bool `yaml:"postRunCommandsOnFailure" json:"postRunCommandsOnFailure"`
+
+	// Environments are named overlays selected with -env.
+	// Fields set in the environment take precedence over the top-level fields.
+	Environments map[string]json.RawMessage `yaml:"environments" json:"environments"`
+}
+
+// ProjectConfig describes one of several projects managed from a single config.
+type ProjectConfig struct {
+	NamePattern    string   `yaml:"namePattern" json:"namePattern"`
+	Parent         string   `yaml:"parent" json:"parent"`
+	BillingAccount string   `yaml:"billingAccount" json:"billingAccount"`
+	Services       []string `yaml:"services" json:"services"`
+	SetupCommands  []string `yaml:"setupCommands" json:"setupCommands"`
+}
+
+// ProjectConfigs returns the effective config for each project.
+// If Projects is empty, the config itself describes the only project.
+func (c *Config) ProjectConfigs() []*Config {
+	if len(c.Projects) == 0 {
+		return []*Config{c}
+	}
+	var configs []*Config
+	for _, project := range c.Projects {
+		projectConfig := *c
+		projectConfig.Projects = nil
+		projectConfig.NamePattern = project.NamePattern
+		if project.Parent != "" {
+			projectConfig.Parent = project.Parent
+		}
+		if project.BillingAccount != "" {
+			projectConfig.BillingAccount = project.BillingAccount
+		}
+		if project.Services != nil {
+			projectConfig.Services = project.Services
+		}
+		if project.SetupCommands != nil {
+			projectConfig.SetupCommands = project.SetupCommands
+		}
+		configs = append(configs, &projectConfig)
+	}
+	return configs
 }
 
+const (
+	// BillingLinkPolicyEnsure links the project to the configured billing account, relinking if needed.
+	BillingLinkPolicyEnsure = "ensure"
+	// BillingLinkPolicySkipIfLinked leaves any existing billing link alone.
+	BillingLinkPolicySkipIfLinked = "skip-if-linked"
+	// BillingLinkPolicyFailIfDifferent returns an error if the project is linked to a different billing account.
+	BillingLinkPolicyFailIfDifferent = "fail-if-different"
+)
+
+const (
+	// SetupCommandsPhaseBeforeServices runs setup commands after billing is linked, before services are enabled.
+	SetupCommandsPhaseBeforeServices = "before-services"
+	// SetupCommandsPhaseAfterServices runs setup commands as soon as services are enabled.
+	SetupCommandsPhaseAfterServices = "after-services"
+	// SetupCommandsPhaseAfterAll runs setup commands once all other reconciliation is complete.
+	SetupCommandsPhaseAfterAll = "after-all"
+)
+
 type ProjectManager struct {
 	config *Config
+	projectManagerOptions
 
 	crmService         *cloudresourcemanager.Service
 	serviceusageClient *serviceusage.Client
+	iamService         *iam.Service
+	computeService     *compute.Service
+	orgPolicyService   *orgpolicy.Service
+	monitoringService  *monitoring.Service
+	billingService     *cloudbilling.APIService
 	enabledServices    map[string]bool
+
+	// dryRunProjectMissing is set in dry-run mode when the project would have been created.
+	dryRunProjectMissing bool
+
+	// resolvedParent caches the parent resolved from an organization:<domain> config value.
+	resolvedParent string
+
+	// result records what we did to the project, for -output json.
+	result *ProjectResult
+
+	// identity resolves the caller's email for ACTOR_EMAIL; it is built on first use.
+	identity identityProvider
+
+	// operations reads the state of resourcemanager operations; it is built on first use.
+	operations operationsGetter
+}
+
+// projectManagerOptions are the settings from command-line flags, shared by all the projects in a run.
+type projectManagerOptions struct {
+	// checkIDAvailable enables a pre-flight check that the project ID is not taken before we try to create it.
+	checkIDAvailable bool
+
+	// setupLogDir, if set, is a directory where the output of each setup command is captured.
+	setupLogDir string
+	// setupOutputLimit, if positive, limits the bytes of each setup command's output we stream to our own output.
+	setupOutputLimit int64
+
+	// skipBilling skips linking the project to a billing account.
+	skipBilling bool
+	// billingAccountFromFolder inherits the billing account from the project's folder when none is configured.
+	billingAccountFromFolder bool
+
+	// setupCommandTimeout, if positive, overrides the config's timeout for each setup command.
+	setupCommandTimeout time.Duration
+
+	// strictBillingVerify re-reads the billing info after linking and fails if billing is not enabled.
+	strictBillingVerify bool
+
+	// servicesCacheTTL, if positive, is how long we trust the locally cached set of enabled services.
+	servicesCacheTTL time.Duration
+
+	// waitForServicesReady polls newly enabled services until they report ENABLED, for up to servicesReadyTimeout.
+	waitForServicesReady bool
+	servicesReadyTimeout time.Duration
+
+	// waitForDeletion polls a deleted project until it is pending deletion, for up to deletionWaitTimeout.
+	waitForDeletion     bool
+	deletionWaitTimeout time.Duration
+
+	// assumeYes skips confirmation of destructive actions.
+	assumeYes bool
+	// interactive is true if we can prompt the user for confirmation.
+	interactive bool
+	// promptIn and promptOut are used for confirmation prompts; they default to stdin and stderr.
+	promptIn  io.Reader
+	promptOut io.Writer
+
+	// maxProjectAge, if positive, is the age beyond which we refuse destructive actions on a project.
+	maxProjectAge time.Duration
+	// force overrides safety checks such as maxProjectAge.
+	force bool
+	// removeLiens removes the liens that block deleting a project.
+	removeLiens bool
+
+	// retryBaseDelay is the delay before the first retry of a transient API error; it doubles for each retry.
+	retryBaseDelay time.Duration
+	// retryMaxAttempts is the number of times we try an API call that fails with a transient error.
+	retryMaxAttempts int
+
+	// auditLog, if set, records every mutation we make.
+	auditLog *auditLog
+
+	// dumpRequests logs the body and response status of every API call.
+	dumpRequests bool
+
+	// dryRun logs the changes we would make, without making them.
+	// Read-only API calls are still made, so that the plan is accurate.
+	dryRun bool
+	// pruneServices disables enabled services that are not in the config.
+	pruneServices bool
+	// pruneLabels removes labels on an existing project that are not in the config.
+	pruneLabels bool
+	// concurrency is the maximum number of service-enable batches in flight at once.
+	concurrency int
+	// serviceEnableTimeout, if positive, bounds each service enabled on its own (in a service group, or
+	// when falling back for services blocked by org policy).
+	serviceEnableTimeout time.Duration
+	// createLimiter, if set, limits project creation across all the projects of the process.
+	createLimiter *projectCreationLimiter
+
+	// dryRunServices previews the changes to the configured services, while other phases run for real.
+	dryRunServices bool
+
+	// explain writes the reasoning for each decision to explainOut; it defaults to stderr.
+	explain    bool
+	explainOut io.Writer
 }
 
 func NewProjectManager(config *Config) *ProjectManager {
-	return &ProjectManager{config: config}
+	return &ProjectManager{config: config, result: &ProjectResult{}}
 }
 
 func (p *ProjectManager) getServiceUsageClient(ctx context.Context) (*serviceusage.Client, error) {
 	if p.serviceusageClient != nil {
 		return p.serviceusageClient, nil
 	}
-	suClient, err := serviceusage.NewClient(ctx)
+	var opts []option.ClientOption
+	if p.dumpRequests {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(dumpingUnaryInterceptor)))
+	}
+	proxyDialOption, err := p.grpcProxyDialOption()
+	if err != nil {
+		return nil, err
+	}
+	if proxyDialOption != nil {
+		opts = append(opts, option.WithGRPCDialOption(proxyDialOption))
+	}
+	suClient, err := serviceusage.NewClient(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating serviceusage client: %w", err)
 	}
@@ -64,7 +341,11 @@ func (p *ProjectManager) getCloudResourceManagerClient(ctx context.Context) (*cl
 	if p.crmService != nil {
 		return p.crmService, nil
 	}
-	crmService, err := cloudresourcemanager.NewService(ctx)
+	opts, err := p.clientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	crmService, err := cloudresourcemanager.NewService(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating cloudresourcemanager client: %w", err)
 	}
@@ -72,6 +353,24 @@ func (p *ProjectManager) getCloudResourceManagerClient(ctx context.Context) (*cl
 	return crmService, nil
 }
 
+// getCloudBillingClient returns the billing client, which bills quota to projectName.
+// Like the other clients it is cached; a ProjectManager only manages one project.
+func (p *ProjectManager) getCloudBillingClient(ctx context.Context, projectName string) (*cloudbilling.APIService, error) {
+	if p.billingService != nil {
+		return p.billingService, nil
+	}
+	opts, err := p.clientOptions(ctx, option.WithQuotaProject(projectName))
+	if err != nil {
+		return nil, err
+	}
+	billingService, err := cloudbilling.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cloudbilling client: %w", err)
+	}
+	p.billingService = billingService
+	return billingService, nil
+}
+
 func (p *ProjectManager) EnsureProjectExists(ctx context.Context, projectName string) error {
 	log := klog.FromContext(ctx)
 
@@ -80,12 +379,27 @@ func (p *ProjectManager) EnsureProjectExists(ctx context.Context, projectName st
 		return err
 	}
 	if project == nil {
+		if p.checkIDAvailable {
+			if err := p.checkProjectIDAvailable(ctx, projectName); err != nil {
+				return err
+			}
+		}
+		p.explainf(projectName, "project does not exist -> will create")
 		log.Info("project does not exist, creating", "name", projectName)
 		if err := p.createProject(ctx, projectName); err != nil {
 			return err
 		}
+	} else if project.State == "DELETE_REQUESTED" {
+		p.explainf(projectName, "project is pending deletion -> cannot create")
+		// The project ID remains reserved, so creating it again would fail with ALREADY_EXISTS.
+		return fmt.Errorf("project %q is pending deletion (state %s); restore it with `gcloud projects undelete %s`, or choose a different project ID (IDs of deleted projects cannot be reused)", projectName, project.State, projectName)
 	} else {
+		p.explainf(projectName, "project exists -> skip create")
 		log.Info("project already exists", "name", projectName)
+		p.result.ProjectNumber = strings.TrimPrefix(project.Name, "projects/")
+		if err := p.ensureProjectMetadata(ctx, project); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -103,108 +417,895 @@ func run(ctx context.Context) error {
 	klog.InitFlags(nil)
 
 	configPath := ""
-	flag.StringVar(&configPath, "config", configPath, "Path to the configuration file")
+	flag.StringVar(&configPath, "config", configPath, "Path to the configuration file (YAML, or JSON if it ends in .json)")
+	configDir := ""
+	flag.StringVar(&configDir, "config-dir", configDir, "Path to a directory of configuration files (*.yaml, *.yml, *.json) to process in turn, reporting which succeeded")
+	parent := ""
+	flag.StringVar(&parent, "parent", parent, "Parent of the project (folders/<id>, organizations/<id> or organization:<domain>), overriding parentFrom and parent in the config")
+	envName := ""
+	flag.StringVar(&envName, "env", envName, "Name of the environment in the config file's environments section to apply over the top-level settings")
+	snapshotPath := ""
+	flag.StringVar(&snapshotPath, "snapshot", snapshotPath, "If set, write the observed project state to a timestamped JSON file based on this path after a successful run")
+	checkIDAvailable := false
+	flag.BoolVar(&checkIDAvailable, "check-id-available", checkIDAvailable, "Before creating a project, check that the project ID does not appear to be taken by a project we cannot see")
+	setupLogDir := ""
+	flag.StringVar(&setupLogDir, "setup-log-dir", setupLogDir, "If set, capture the output of each setup command to a log file in this directory")
+	var setupOutputLimit int64
+	flag.Int64Var(&setupOutputLimit, "setup-output-limit", setupOutputLimit, "If positive, truncate the streamed stdout/stderr of each setup command after this many bytes")
+	var commandTimeout time.Duration
+	flag.DurationVar(&commandTimeout, "command-timeout", commandTimeout, "If positive, kill each setup command that runs longer than this (overrides setupCommandTimeout in the config; the default is 10m)")
+	skipBilling := false
+	flag.BoolVar(&skipBilling, "skip-billing", skipBilling, "Do not link the project to a billing account (e.g. where billing is pre-attached or unavailable)")
+	billingAccountFromFolder := false
+	flag.BoolVar(&billingAccountFromFolder, "billing-account-from-folder", billingAccountFromFolder, "If billingAccount is not configured and the parent is a folder, link the billing account most commonly used by the other projects in the folder")
+	strictBillingVerify := false
+	flag.BoolVar(&strictBillingVerify, "strict-billing-verify", strictBillingVerify, "After linking billing, verify that billing is actually enabled on the project")
+	var servicesCacheTTL time.Duration
+	flag.DurationVar(&servicesCacheTTL, "services-cache-ttl", servicesCacheTTL, "If positive, cache the enabled services of the project locally and trust the cache for this long")
+	waitForServicesReady := false
+	flag.BoolVar(&waitForServicesReady, "wait-for-services-ready", waitForServicesReady, "After enabling services, poll until they all report state ENABLED, as they are sometimes not immediately usable")
+	servicesReadyTimeout := 5 * time.Minute
+	flag.DurationVar(&servicesReadyTimeout, "services-ready-timeout", servicesReadyTimeout, "How long -wait-for-services-ready waits for the services to be ready")
+	assumeYes := false
+	flag.BoolVar(&assumeYes, "yes", assumeYes, "Proceed with destructive actions (such as deleting projects or relinking billing) without prompting; required when stdin is not a terminal")
+	flag.BoolVar(&assumeYes, "y", assumeYes, "Shorthand for -yes")
+	strictEnv := false
+	flag.BoolVar(&strictEnv, "strict-env", strictEnv, "Fail if namePattern references an environment variable that is not set and has no ${env.VAR:-default}")
+	timezone := "UTC"
+	flag.StringVar(&timezone, "timezone", timezone, "IANA timezone (e.g. America/New_York) used to compute ${today}; use Local for the machine's timezone")
+	var maxProjectAge time.Duration
+	flag.DurationVar(&maxProjectAge, "max-project-age", maxProjectAge, "If positive, refuse destructive actions (such as deleting projects or relinking billing) on projects created longer ago than this")
+	force := false
+	flag.BoolVar(&force, "force", force, "Override safety checks such as -max-project-age")
+	removeLiens := false
+	flag.BoolVar(&removeLiens, "remove-liens", removeLiens, "With -delete, remove the liens that block deleting the project (a destructive action; liens protect projects other resources depend on)")
+	writeBack := false
+	flag.BoolVar(&writeBack, "write-back", writeBack, "Instead of reconciling, update the services list in the config file to match the project's enabled services (a .bak backup is kept)")
+	dryRun := false
+	flag.BoolVar(&dryRun, "dry-run", dryRun, "Log the changes that would be made (project creation, billing, services, setup commands) without making them")
+	explain := false
+	flag.BoolVar(&explain, "explain", explain, "Print why each action will or won't run (e.g. \"project exists -> skip create\"); most useful with -dry-run")
+	dryRunServices := false
+	flag.BoolVar(&dryRunServices, "dry-run-services", dryRunServices, "Log the changes that would be made to the configured services without making them; other phases run normally")
+	pruneServices := false
+	flag.BoolVar(&pruneServices, "prune-services", pruneServices, "Also disable enabled services that are not in the config (a destructive action; disabling can break dependent services)")
+	createConcurrency := 1
+	flag.IntVar(&createConcurrency, "create-concurrency", createConcurrency, "Maximum number of projects created at once, across all projects (including concurrent -serve requests), as creation uses the org's project-creation quota")
+	createQPS := 0.0
+	flag.Float64Var(&createQPS, "create-qps", createQPS, "If positive, the maximum rate of project create calls per second, across all projects; 0 does not limit the rate")
+	serviceEnableTimeout := time.Duration(0)
+	flag.DurationVar(&serviceEnableTimeout, "service-enable-timeout", serviceEnableTimeout, "If positive, give up on a service enabled on its own (in a service group, or skipping services blocked by org policy) after this long, so one stuck service does not stall the rest")
+	concurrency := 1
+	flag.IntVar(&concurrency, "concurrency", concurrency, "Maximum number of service-enable batches (of 20 services) to run at once, for long services lists")
+	pruneLabels := false
+	flag.BoolVar(&pruneLabels, "prune-labels", pruneLabels, "Also remove labels on an existing project that are not in the config (managed-by and expires-at are kept)")
+	deleteProject := false
+	flag.BoolVar(&deleteProject, "delete", deleteProject, "Instead of creating the project, schedule it for deletion")
+	waitForDeletion := false
+	flag.BoolVar(&waitForDeletion, "wait", waitForDeletion, "With -delete, poll the project until it is pending deletion before exiting, as needed before recreating it")
+	deletionWaitTimeout := 5 * time.Minute
+	flag.DurationVar(&deletionWaitTimeout, "wait-timeout", deletionWaitTimeout, "How long -wait waits for the project to be deleted")
+	reportUnusedServices := false
+	flag.BoolVar(&reportUnusedServices, "report-unused-services", reportUnusedServices, "Instead of reconciling, print the enabled services that had no API requests recently (see -unused-services-window); nothing is disabled")
+	unusedServicesWindow := 30 * 24 * time.Hour
+	flag.DurationVar(&unusedServicesWindow, "unused-services-window", unusedServicesWindow, "How far back -report-unused-services looks for API requests; at most 6 weeks, as request counts are not kept longer")
+	idCollisionRetries := 3
+	flag.IntVar(&idCollisionRetries, "id-collision-retries", idCollisionRetries, "If the project ID is taken and namePattern contains ${random}, expand the pattern again and retry creation up to this many times")
+	assertServices := false
+	flag.BoolVar(&assertServices, "assert-services", assertServices, "Instead of reconciling, check that all configured services are enabled and fail if any are not")
+	retryBaseDelay := time.Second
+	flag.DurationVar(&retryBaseDelay, "retry-base-delay", retryBaseDelay, "Delay before retrying an API call that failed with a transient error (429, 500, 502, 503); doubles with each retry")
+	retryMaxAttempts := 5
+	flag.IntVar(&retryMaxAttempts, "retry-max-attempts", retryMaxAttempts, "Maximum number of attempts for an API call that fails with a transient error; 1 disables retries")
+	auditFile := ""
+	flag.StringVar(&auditFile, "audit-file", auditFile, "If set, append a JSON line to this file for every change the run makes (and its outcome)")
+	dumpRequests := false
+	flag.BoolVar(&dumpRequests, "dump-requests", dumpRequests, "Log the request body and response status of every API call (credentials are not logged)")
+	k8sManifestPath := ""
+	flag.StringVar(&k8sManifestPath, "k8s-manifest", k8sManifestPath, "If set, write a Kubernetes ConfigMap (and optionally Secret) describing the project to this path; use - for stdout")
+	printIAM := false
+	flag.BoolVar(&printIAM, "print-iam", printIAM, "After a successful run, print the project's IAM policy to stdout as JSON")
+	serveAddr := ""
+	flag.StringVar(&serveAddr, "serve", serveAddr, "Instead of reconciling a config file, listen on this address (e.g. :8080) and reconcile the configs POSTed to /provision")
+	serveTokenFile := ""
+	flag.StringVar(&serveTokenFile, "serve-token-file", serveTokenFile, "File containing the shared token that -serve clients must send as an Authorization: Bearer header (required with -serve)")
+	serveMaxConcurrent := 4
+	flag.IntVar(&serveMaxConcurrent, "serve-max-concurrent", serveMaxConcurrent, "Maximum number of provision requests -serve runs at once; further requests get 429 Too Many Requests")
+	serveRequestTimeout := 30 * time.Minute
+	flag.DurationVar(&serveRequestTimeout, "serve-request-timeout", serveRequestTimeout, "Maximum time -serve spends on a provision request")
+	serveAllowSetupCommands := false
+	flag.BoolVar(&serveAllowSetupCommands, "serve-allow-setup-commands", serveAllowSetupCommands, "Allow -serve to run setupCommands and postRunCommands from provision requests; they run as the server's user, so any client with the token can run commands")
+	compare := false
+	flag.BoolVar(&compare, "compare-configs", compare, "Instead of reconciling, print the differences between the effective configs given as the two arguments (services, billing account, parent); no API calls are made")
+	output := ""
+	flag.StringVar(&output, "output", output, "If set, print to stdout after the run: shell prints export statements for eval, json prints a JSON document describing what the run did")
+	failOnSkip := false
+	flag.BoolVar(&failOnSkip, "fail-on-skip", failOnSkip, "Fail if setupCommands are configured but would be skipped (because the setup phase is not in phases), instead of only warning")
+	ciRunID := os.Getenv("CI_PIPELINE_ID")
+	flag.StringVar(&ciRunID, "ci-run-id", ciRunID, "If set, label the projects with ci-run set to this ID, to trace them back to the pipeline run; defaults to $CI_PIPELINE_ID")
+	webhookURL := ""
+	flag.StringVar(&webhookURL, "webhook-url", webhookURL, "If set, POST the JSON result (as printed by -output json) to this URL after the run")
+	webhookSecretFile := ""
+	flag.StringVar(&webhookSecretFile, "webhook-secret-file", webhookSecretFile, "File containing a secret to sign the -webhook-url payload with; the HMAC-SHA256 is sent in the X-Signature-256 header")
+	webhookTimeout := 30 * time.Second
+	flag.DurationVar(&webhookTimeout, "webhook-timeout", webhookTimeout, "Maximum time spent posting to -webhook-url, including retries")
 	flag.Parse()
 
 	logger := klog.NewKlogr()
 	ctx = klog.NewContext(ctx, logger)
 
-	if configPath == "" {
-		return fmt.Errorf("config file path must be specified with -config flag")
-	}
-	config, err := loadConfig(configPath)
+	location, err := time.LoadLocation(timezone)
 	if err != nil {
-		return fmt.Errorf("error loading config %q: %w", configPath, err)
+		return fmt.Errorf("error loading timezone %q: %w", timezone, err)
 	}
 
-	projectName, err := expandProjectName(config.NamePattern)
-	if err != nil {
-		return fmt.Errorf("error expanding project name: %w", err)
+	if compare {
+		if flag.NArg() != 2 {
+			return fmt.Errorf("-compare-configs requires two config file paths as arguments")
+		}
+		a, err := loadEffectiveConfig(flag.Arg(0), envName)
+		if err != nil {
+			return err
+		}
+		b, err := loadEffectiveConfig(flag.Arg(1), envName)
+		if err != nil {
+			return err
+		}
+		return compareConfigs(os.Stdout, a, b, location)
+	}
+
+	if serveAddr != "" {
+		if configPath != "" || configDir != "" {
+			return fmt.Errorf("-serve reads configs from requests, so cannot be combined with -config or -config-dir")
+		}
+		if writeBack || assertServices || reportUnusedServices || deleteProject {
+			return fmt.Errorf("-serve cannot be combined with -write-back, -assert-services, -report-unused-services or -delete")
+		}
+		if snapshotPath != "" || k8sManifestPath != "" || output != "" || printIAM {
+			return fmt.Errorf("-serve returns the result in the response, so cannot be combined with -snapshot, -k8s-manifest, -output or -print-iam")
+		}
+		if serveTokenFile == "" {
+			return fmt.Errorf("-serve-token-file must be specified with -serve")
+		}
+		if serveMaxConcurrent < 1 {
+			return fmt.Errorf("-serve-max-concurrent must be at least 1")
+		}
+		if serveRequestTimeout <= 0 {
+			return fmt.Errorf("-serve-request-timeout must be positive")
+		}
+	} else if configPath == "" && configDir == "" {
+		return fmt.Errorf("config file path must be specified with -config flag (or a directory with -config-dir)")
+	}
+	if configPath != "" && configDir != "" {
+		return fmt.Errorf("-config and -config-dir cannot be combined")
+	}
+	if configDir != "" && os.Getenv(nameOverrideEnvVar) != "" {
+		return fmt.Errorf("%s cannot be used with -config-dir, as it would give every config the same project ID", nameOverrideEnvVar)
+	}
+	switch output {
+	case "", OutputShell, OutputJSON:
+	default:
+		return fmt.Errorf("-output %q is not valid; must be %s or %s", output, OutputShell, OutputJSON)
+	}
+	if printIAM && output != "" {
+		return fmt.Errorf("-print-iam cannot be combined with -output, as both write to stdout")
+	}
+	if configDir != "" && (output != "" || writeBack) {
+		return fmt.Errorf("-output and -write-back are not supported with -config-dir")
+	}
+	if unusedServicesWindow <= 0 || unusedServicesWindow > 6*7*24*time.Hour {
+		return fmt.Errorf("-unused-services-window must be positive and at most 6 weeks (1008h)")
+	}
+	if idCollisionRetries < 0 {
+		return fmt.Errorf("-id-collision-retries must not be negative")
+	}
+	if retryMaxAttempts < 1 {
+		return fmt.Errorf("-retry-max-attempts must be at least 1")
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1")
+	}
+	if serviceEnableTimeout < 0 {
+		return fmt.Errorf("-service-enable-timeout must not be negative")
+	}
+	if createConcurrency < 1 {
+		return fmt.Errorf("-create-concurrency must be at least 1")
+	}
+	if createQPS < 0 {
+		return fmt.Errorf("-create-qps must not be negative")
+	}
+	if waitForServicesReady && servicesReadyTimeout <= 0 {
+		return fmt.Errorf("-services-ready-timeout must be positive")
+	}
+	if retryBaseDelay < 0 {
+		return fmt.Errorf("-retry-base-delay must not be negative")
+	}
+	if removeLiens && !deleteProject {
+		return fmt.Errorf("-remove-liens can only be used with -delete")
+	}
+	if waitForDeletion && !deleteProject {
+		return fmt.Errorf("-wait can only be used with -delete")
+	}
+	if waitForDeletion && deletionWaitTimeout <= 0 {
+		return fmt.Errorf("-wait-timeout must be positive")
+	}
+	if err := validateLabelValue(ciRunID); err != nil {
+		return fmt.Errorf("-ci-run-id: %w", err)
+	}
+	if webhookSecretFile != "" && webhookURL == "" {
+		return fmt.Errorf("-webhook-secret-file can only be used with -webhook-url")
+	}
+	if webhookURL != "" && webhookTimeout <= 0 {
+		return fmt.Errorf("-webhook-timeout must be positive")
 	}
 
 	log := klog.FromContext(ctx)
-	log.Info("Project name", "name", projectName)
 
-	projectManager := NewProjectManager(config)
-	defer projectManager.closeClients()
-	if err := projectManager.EnsureProjectExists(ctx, projectName); err != nil {
-		return err
+	pmOpts := projectManagerOptions{
+		checkIDAvailable:         checkIDAvailable,
+		setupLogDir:              setupLogDir,
+		setupOutputLimit:         setupOutputLimit,
+		setupCommandTimeout:      commandTimeout,
+		strictBillingVerify:      strictBillingVerify,
+		billingAccountFromFolder: billingAccountFromFolder,
+		skipBilling:              skipBilling,
+		servicesCacheTTL:         servicesCacheTTL,
+		waitForServicesReady:     waitForServicesReady,
+		servicesReadyTimeout:     servicesReadyTimeout,
+		waitForDeletion:          waitForDeletion,
+		deletionWaitTimeout:      deletionWaitTimeout,
+		assumeYes:                assumeYes,
+		interactive:              stdinIsTerminal(),
+		maxProjectAge:            maxProjectAge,
+		force:                    force,
+		removeLiens:              removeLiens,
+		dumpRequests:             dumpRequests,
+		dryRun:                   dryRun,
+		dryRunServices:           dryRunServices,
+		explain:                  explain,
+		pruneServices:            pruneServices,
+		pruneLabels:              pruneLabels,
+		concurrency:              concurrency,
+		serviceEnableTimeout:     serviceEnableTimeout,
+		createLimiter:            newProjectCreationLimiter(createConcurrency, createQPS),
 	}
 
-	// Ensure cloudbilling.googleapis.com is enabled first so we can set up billing
-	if err := projectManager.EnableProjectServices(ctx, projectName, []string{"cloudbilling.googleapis.com"}); err != nil {
-		return err
+	if auditFile != "" {
+		auditLog, err := openAuditLog(auditFile)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
+		pmOpts.auditLog = auditLog
 	}
 
-	if err := projectManager.LinkProjectToBillingAccount(ctx, projectName); err != nil {
-		return err
+	opts := &runOptions{
+		envName:              envName,
+		strictEnv:            strictEnv,
+		parent:               parent,
+		snapshotPath:         snapshotPath,
+		k8sManifestPath:      k8sManifestPath,
+		output:               output,
+		printIAM:             printIAM,
+		writeBack:            writeBack,
+		assertServices:       assertServices,
+		reportUnusedServices: reportUnusedServices,
+		unusedServicesWindow: unusedServicesWindow,
+		deleteProject:        deleteProject,
+		idCollisionRetries:   idCollisionRetries,
+		location:             location,
+		failOnSkip:           failOnSkip,
+		ciRunID:              ciRunID,
+		webhookURL:           webhookURL,
+		webhookTimeout:       webhookTimeout,
+		projectManager:       pmOpts,
+	}
+	if webhookSecretFile != "" {
+		secret, err := readWebhookSecret(webhookSecretFile)
+		if err != nil {
+			return err
+		}
+		opts.webhookSecret = secret
+	}
+
+	if serveAddr != "" {
+		token, err := readServeToken(serveTokenFile)
+		if err != nil {
+			return err
+		}
+		// There is no one at the terminal to answer prompts for a request.
+		opts.projectManager.interactive = false
+		so := serveOptions{
+			addr:               serveAddr,
+			token:              token,
+			maxConcurrent:      serveMaxConcurrent,
+			requestTimeout:     serveRequestTimeout,
+			allowSetupCommands: serveAllowSetupCommands,
+		}
+		return serve(ctx, so, opts)
+	}
+
+	if configDir == "" {
+		return runConfig(ctx, configPath, opts)
 	}
 
-	if err := projectManager.EnableProjectServices(ctx, projectName, config.Services); err != nil {
+	configPaths, err := listConfigFiles(configDir)
+	if err != nil {
 		return err
 	}
+	opts.perProjectOutputs = true
+
+	var failed []string
+	for _, configPath := range configPaths {
+		log.Info("processing config", "config", configPath)
+		if err := runConfig(ctx, configPath, opts); err != nil {
+			log.Error(err, "config failed", "config", configPath)
+			failed = append(failed, configPath)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Processed %d configs from %s:\n", len(configPaths), configDir)
+	for _, configPath := range configPaths {
+		result := "succeeded"
+		if slices.Contains(failed, configPath) {
+			result = "FAILED"
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", configPath, result)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("%d of %d configs failed", len(failed), len(configPaths))
+	}
+	return nil
+}
+
+// runOptions are the settings from command-line flags that control a run, other than projectManagerOptions.
+type runOptions struct {
+	envName              string
+	strictEnv            bool
+	parent               string
+	snapshotPath         string
+	k8sManifestPath      string
+	output               string
+	printIAM             bool
+	writeBack            bool
+	assertServices       bool
+	reportUnusedServices bool
+	unusedServicesWindow time.Duration
+	deleteProject        bool
+	location             *time.Location
+
+	// idCollisionRetries is how many times we retry creation with a new random project ID if the ID is taken.
+	idCollisionRetries int
+
+	// perProjectOutputs names output files (snapshots, manifests, setup logs) after each project,
+	// even for configs with a single project; it is set when processing a directory of configs.
+	perProjectOutputs bool
+
+	// failOnSkip fails the run if configured setup commands would be skipped.
+	failOnSkip bool
+
+	// ciRunID, if set, is the value of the ci-run label added to the projects.
+	ciRunID string
+
+	// webhookURL, if set, is where the result is POSTed after the run.
+	webhookURL string
+	// webhookSecret, if set, is the key the webhook payload is signed with.
+	webhookSecret []byte
+	// webhookTimeout bounds the time spent posting to the webhook, including retries.
+	webhookTimeout time.Duration
+
+	// result accumulates the outcome of the run for -output json and -webhook-url; it is set by runConfig.
+	result *Result
+
+	// stdoutManifests counts the Kubernetes manifests written to stdout, across all configs,
+	// so that consecutive manifests are separated with "---".
+	stdoutManifests int
+
+	projectManager projectManagerOptions
+}
+
+// writeManifestSeparator writes the "---" document separator before every manifest written to stdout but the first.
+func (o *runOptions) writeManifestSeparator(w io.Writer) {
+	if o.stdoutManifests != 0 {
+		fmt.Fprintln(w, "---")
+	}
+	o.stdoutManifests++
+}
+
+// listConfigFiles returns the *.yaml, *.yml and *.json files in dir, sorted by name.
+func listConfigFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config directory %q: %w", dir, err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.yaml, *.yml or *.json files found in config directory %q", dir)
+	}
+	return paths, nil
+}
+
+// runConfig loads the config at configPath and reconciles its projects.
+func runConfig(ctx context.Context, configPath string, o *runOptions) (err error) {
+	if o.output == OutputJSON || o.webhookURL != "" {
+		result := &Result{Projects: []*ProjectResult{}, DryRun: o.projectManager.dryRun}
+		o.result = result
+		defer func() {
+			if err != nil {
+				result.Error = err.Error()
+			}
+			if o.output == OutputJSON {
+				if writeErr := writeResultJSON(os.Stdout, result); writeErr != nil && err == nil {
+					err = writeErr
+				}
+			}
+			if o.webhookURL != "" {
+				if webhookErr := postResultToWebhook(ctx, o, result); webhookErr != nil {
+					err = errors.Join(err, webhookErr)
+				}
+			}
+		}()
+	}
 
-	if err := projectManager.RunSetupCommands(ctx, projectName); err != nil {
+	config, err := loadEffectiveConfig(configPath, o.envName)
+	if err != nil {
 		return err
 	}
+	return reconcileConfig(ctx, config, configPath, o)
+}
+
+// reconcileConfig runs the pipeline for each project in the (loaded and validated) config.
+// configPath is only used by -write-back. If o.result is set, the outcome is recorded in it.
+func reconcileConfig(ctx context.Context, config *Config, configPath string, o *runOptions) (err error) {
+	log := klog.FromContext(ctx)
+
+	location := o.location
+	opts := o.projectManager
+
+	projectConfigs := config.ProjectConfigs()
+	multiProject := len(projectConfigs) > 1
+	perProjectOutputs := multiProject || o.perProjectOutputs
+
+	projectNames := make([]string, len(projectConfigs))
+	// rawIAMBindings are the bindings before expansion, so they can be expanded again if the project name changes.
+	rawIAMBindings := make([][]IAMBinding, len(projectConfigs))
+	for i, projectConfig := range projectConfigs {
+		projectName, err := expandProjectName(projectConfig.NamePattern, location, o.strictEnv)
+		if err != nil {
+			return fmt.Errorf("error expanding project name: %w", err)
+		}
+		if err := validateProjectID(projectName); err != nil {
+			return fmt.Errorf("invalid project name from namePattern %q: %w", projectConfig.NamePattern, err)
+		}
+		if slices.Contains(projectNames[:i], projectName) {
+			return fmt.Errorf("project name %q is used by more than one project in the config", projectName)
+		}
+		projectNames[i] = projectName
+		log.Info("Project name", "name", projectName)
+
+		parent, source, err := effectiveParent(o.parent, projectConfig, location)
+		if err != nil {
+			return err
+		}
+		projectConfig.Parent = parent
+		log.V(2).Info("parent", "parent", parent, "source", source, "project", projectName)
+
+		labels, err := expandLabels(projectConfig.Labels, location)
+		if err != nil {
+			return err
+		}
+		projectConfig.Labels = withCIRunLabel(labels, o.ciRunID)
+
+		rawIAMBindings[i] = projectConfig.IAMBindings
+		iamBindings, err := expandIAMBindings(projectConfig.IAMBindings, projectName, location)
+		if err != nil {
+			return err
+		}
+		projectConfig.IAMBindings = iamBindings
+	}
+
+	if o.output == OutputShell && multiProject {
+		return fmt.Errorf("-output %s is only supported for configs with a single project", OutputShell)
+	}
+
+	if o.assertServices {
+		var errs []error
+		for i, projectConfig := range projectConfigs {
+			projectManager := NewProjectManager(projectConfig)
+			projectManager.projectManagerOptions = opts
+			defer projectManager.closeClients()
+			if err := projectManager.AssertProjectServices(ctx, projectNames[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	if o.reportUnusedServices {
+		for i, projectConfig := range projectConfigs {
+			projectManager := NewProjectManager(projectConfig)
+			projectManager.projectManagerOptions = opts
+			defer projectManager.closeClients()
+			if err := projectManager.ReportUnusedServices(ctx, projectNames[i], o.unusedServicesWindow, os.Stdout); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// createWhen gates every mode that makes changes, including -write-back and -delete.
+	if config.CreateWhen != "" {
+		ok, err := evaluateCondition(config.CreateWhen, location)
+		if err != nil {
+			return fmt.Errorf("error evaluating createWhen: %w", err)
+		}
+		if !ok {
+			log.Info("createWhen condition is false, skipping all changes", "createWhen", config.CreateWhen)
+			return nil
+		}
+		log.Info("createWhen condition is true", "createWhen", config.CreateWhen)
+	}
+
+	if o.writeBack {
+		if multiProject {
+			return fmt.Errorf("-write-back is only supported for configs with a single project")
+		}
+		projectManager := NewProjectManager(projectConfigs[0])
+		projectManager.projectManagerOptions = opts
+		defer projectManager.closeClients()
+		return projectManager.WriteBackServices(ctx, projectNames[0], configPath)
+	}
+
+	if o.deleteProject {
+		for i, projectConfig := range projectConfigs {
+			projectManager := NewProjectManager(projectConfig)
+			projectManager.projectManagerOptions = opts
+			defer projectManager.closeClients()
+			if err := projectManager.DeleteProject(ctx, projectNames[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// processed are the IDs of the projects that have been reconciled, for the postRunCommands.
+	var processed []string
+	if !opts.dryRun {
+		postRun := NewProjectManager(config)
+		postRun.projectManagerOptions = opts
+		defer func() {
+			err = postRun.RunPostRunCommands(ctx, processed, err)
+		}()
+	}
+
+	for i, projectConfig := range projectConfigs {
+		projectName := projectNames[i]
+
+		projectManager := NewProjectManager(projectConfig)
+		projectManager.projectManagerOptions = opts
+		if perProjectOutputs && opts.setupLogDir != "" {
+			projectManager.setupLogDir = filepath.Join(opts.setupLogDir, projectName)
+		}
+		defer projectManager.closeClients()
+		projectManager.result.ProjectID = projectName
+		if o.result != nil {
+			o.result.Projects = append(o.result.Projects, projectManager.result)
+		}
+
+		if reason := projectConfig.SetupCommandsSkipReason(); reason != "" {
+			log.Info("WARNING: setupCommands are configured but will not run", "project", projectName, "reason", reason)
+			projectManager.result.SetupCommandsSkipped = reason
+			if o.failOnSkip {
+				return fmt.Errorf("setupCommands of project %q would be skipped (-fail-on-skip): %s", projectName, reason)
+			}
+		}
+
+		// setProjectName points everything derived from the project name at name.
+		setProjectName := func(name string) error {
+			iamBindings, err := expandIAMBindings(rawIAMBindings[i], name, location)
+			if err != nil {
+				return err
+			}
+			projectConfig.IAMBindings = iamBindings
+			if perProjectOutputs && opts.setupLogDir != "" {
+				projectManager.setupLogDir = filepath.Join(opts.setupLogDir, name)
+			}
+			projectName = name
+			projectNames[i] = name
+			projectManager.result.ProjectID = name
+			return nil
+		}
+
+		for _, phase := range projectConfig.EffectivePhases() {
+			if phase != PhaseCreate {
+				if err := projectManager.RunPhase(ctx, projectName, phase); err != nil {
+					return err
+				}
+				continue
+			}
+			expand := func() (string, error) {
+				return expandProjectName(projectConfig.NamePattern, location, o.strictEnv)
+			}
+			create := func(name string) error {
+				if name != projectName {
+					if err := setProjectName(name); err != nil {
+						return err
+					}
+				}
+				return projectManager.RunPhase(ctx, name, phase)
+			}
+			if _, err := retryOnIDCollision(ctx, projectConfig.NamePattern, projectName, o.idCollisionRetries, expand, create); err != nil {
+				return err
+			}
+		}
+
+		if opts.dryRun {
+			log.Info("dry-run complete, no changes were made", "project", projectName)
+			continue
+		}
+
+		if o.result != nil && projectManager.result.ProjectNumber == "" {
+			// A new project's number is only known once we read it back.
+			if _, err := projectManager.getProjectNumber(ctx, projectName); err != nil {
+				return err
+			}
+		}
+
+		if o.snapshotPath != "" {
+			outPath := o.snapshotPath
+			if perProjectOutputs {
+				outPath = perProjectPath(o.snapshotPath, projectName)
+			}
+			if err := projectManager.WriteSnapshot(ctx, projectName, outPath); err != nil {
+				return err
+			}
+		}
+
+		if o.k8sManifestPath != "" {
+			outPath := o.k8sManifestPath
+			if perProjectOutputs && outPath != "-" {
+				outPath = perProjectPath(o.k8sManifestPath, projectName)
+			}
+			if outPath == "-" {
+				o.writeManifestSeparator(os.Stdout)
+			}
+			if err := projectManager.WriteKubernetesManifest(ctx, projectName, outPath); err != nil {
+				return err
+			}
+		}
+
+		if o.output == OutputShell {
+			if err := projectManager.WriteShellExports(ctx, projectName, os.Stdout); err != nil {
+				return err
+			}
+		}
+
+		if o.printIAM {
+			if err := projectManager.PrintIAMPolicy(ctx, projectName, os.Stdout); err != nil {
+				return err
+			}
+		}
+
+		processed = append(processed, projectName)
+	}
 
 	return nil
 }
 
+// perProjectPath inserts the project name into the path before the extension, e.g. out.json => out-myproject.json
+func perProjectPath(path string, projectName string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + projectName + ext
+}
+
 func (p *ProjectManager) createProject(ctx context.Context, projectName string) error {
 	crmService, err := p.getCloudResourceManagerClient(ctx)
 	if err != nil {
 		return err
 	}
+	if p.config.ProjectNumberHint != "" {
+		log := klog.FromContext(ctx)
+		log.Info("projectNumberHint is not supported; project numbers are assigned by GCP, only the project ID is chosen", "projectNumberHint", p.config.ProjectNumberHint, "name", projectName)
+	}
+	parent, err := p.resolveParent(ctx)
+	if err != nil {
+		return err
+	}
+	if parent == "" {
+		log := klog.FromContext(ctx)
+		log.Info("WARNING: no parent configured (via -parent, parentFrom or parent); the project will be created without a folder or organization", "name", projectName)
+	}
 	project := &cloudresourcemanager.Project{
 		ProjectId:   projectName,
 		DisplayName: projectName,
-		Parent:      p.config.Parent,
+		Parent:      parent,
+		Labels:      p.config.Labels,
 	}
-	op, err := crmService.Projects.Create(project).Context(ctx).Do()
+	project, err = applyProjectOverrides(project, p.config.ProjectOverrides)
 	if err != nil {
-		return fmt.Errorf("error creating project: %w", err)
+		return err
+	}
+	if p.dryRun {
+		log := klog.FromContext(ctx)
+		log.Info("dry-run: would create project", "name", projectName, "parent", parent)
+		p.dryRunProjectMissing = true
+		return nil
 	}
 
-	for !op.Done {
-		time.Sleep(2 * time.Second)
-		op, err = crmService.Operations.Get(op.Name).Context(ctx).Do()
-		if err != nil {
-			return fmt.Errorf("error getting operation status: %w", err)
+	// Creation is limited separately from the other phases (see -create-concurrency and -create-qps).
+	release, err := p.createLimiter.acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error waiting to create project: %w", err)
+	}
+	defer release()
+
+	var op *cloudresourcemanager.Operation
+	retryable := func(err error) bool {
+		return isRetryable(err) || isTransientCreateConflict(err)
+	}
+	attempts := 0
+	err = p.retryWithBackoffIf(ctx, retryable, func() error {
+		if err := p.createLimiter.wait(ctx); err != nil {
+			return fmt.Errorf("error waiting to create project: %w", err)
+		}
+		attempts++
+		op, err = crmService.Projects.Create(project).Context(ctx).Do()
+		return err
+	})
+	if err != nil && attempts > 1 && isAlreadyExists(err) {
+		// Create is not idempotent: an earlier attempt that failed with a 5xx may have created the project.
+		existing, getErr := p.getProject(ctx, projectName)
+		if getErr != nil {
+			return fmt.Errorf("error checking whether an earlier attempt created project %q: %w", projectName, getErr)
+		}
+		if createdByUs(existing, project) {
+			p.audit(ctx, projectName, "create-project", parent, nil)
+			p.result.Created = true
+			log := klog.FromContext(ctx)
+			log.Info("project was created by an earlier attempt", "name", projectName)
+			return nil
 		}
 	}
+	if err != nil {
+		p.audit(ctx, projectName, "create-project", parent, err)
+		if isAlreadyExists(err) {
+			return &projectIDTakenError{fmt.Errorf("project ID %q is already in use (perhaps by a project you cannot see, or one pending deletion); choose a different namePattern: %w", projectName, err)}
+		}
+		return fmt.Errorf("error creating project: %w", err)
+	}
 
-	if op.Error != nil {
-		return fmt.Errorf("error from project creation operation: %v", op.Error)
+	op, err = p.waitForOperation(ctx, op)
+	if err == nil && op.Error != nil {
+		err = fmt.Errorf("error from project creation operation: %v", op.Error)
+	}
+	p.audit(ctx, projectName, "create-project", parent, err)
+	if err != nil {
+		return err
 	}
+	p.result.Created = true
 	log := klog.FromContext(ctx)
 	log.Info("project created", "name", projectName)
 	return nil
 }
 
-// getProject gets the project, returning nil if it does not exist
+// createdByUs returns true if the existing project looks like the one we asked to create:
+// it is visible to us, and has the parent and labels we requested.
+func createdByUs(existing *cloudresourcemanager.Project, requested *cloudresourcemanager.Project) bool {
+	if existing == nil || existing.State == "DELETE_REQUESTED" || existing.Parent != requested.Parent {
+		return false
+	}
+	for k, v := range requested.Labels {
+		if existing.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// getProject gets the project, returning nil if it does not exist.
+// Projects.Get returns PermissionDenied both for projects that do not exist and for projects we cannot access,
+// so in that case we search for the project by ID, and only treat an empty search result as non-existent.
+// (We do not search first because search results are eventually consistent, so miss newly created projects.)
 func (p *ProjectManager) getProject(ctx context.Context, projectName string) (*cloudresourcemanager.Project, error) {
 	crmService, err := p.getCloudResourceManagerClient(ctx)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: Search instead of get
 	resp, err := crmService.Projects.Get("projects/" + projectName).Context(ctx).Do()
-	if err != nil {
-		if isNotFound(err) || isPermissionDenied(err) {
-			return nil, nil
-		}
+	if err == nil {
+		return resp, nil
+	}
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if !isPermissionDenied(err) {
 		return nil, fmt.Errorf("error getting project: %w", err)
 	}
-	return resp, nil
+
+	var found *cloudresourcemanager.Project
+	if err := crmService.Projects.Search().Query("projectId:"+projectName).Pages(ctx, func(resp *cloudresourcemanager.SearchProjectsResponse) error {
+		for _, project := range resp.Projects {
+			if project.ProjectId == projectName {
+				found = project
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("error searching for project %q: %w", projectName, err)
+	}
+	return found, nil
+}
+
+// checkProjectIDAvailable is a best-effort check that nobody else owns the project ID.
+// GCP has no API to check if a project ID is free, so we interpret the result of Projects.Get:
+// NotFound means the ID is (very likely) available, while PermissionDenied means that either
+// the ID belongs to a project we cannot access, or we lack permission to look it up.
+// We treat PermissionDenied as taken, so this check can report false positives.
+func (p *ProjectManager) checkProjectIDAvailable(ctx context.Context, projectName string) error {
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = crmService.Projects.Get("projects/" + projectName).Context(ctx).Do()
+	if err == nil {
+		return &projectIDTakenError{fmt.Errorf("project ID %q is already in use", projectName)}
+	}
+	if isNotFound(err) {
+		return nil
+	}
+	if isPermissionDenied(err) {
+		return &projectIDTakenError{fmt.Errorf("project ID %q appears to be taken by a project you cannot access; project IDs are globally unique, so choose a more specific namePattern (e.g. add ${random})", projectName)}
+	}
+	return fmt.Errorf("error checking availability of project ID %q: %w", projectName, err)
+}
+
+// skipBillingReason returns true, and why, if we should not link the project to a billing account:
+// because of -skip-billing, or because no billing account is configured (and none is inherited).
+func (p *ProjectManager) skipBillingReason() (bool, string) {
+	if p.skipBilling {
+		return true, "-skip-billing is set"
+	}
+	if p.config.BillingAccount == "" && !p.billingAccountFromFolder {
+		return true, "no billingAccount is configured"
+	}
+	return false, ""
 }
 
 func (p *ProjectManager) LinkProjectToBillingAccount(ctx context.Context, projectName string) error {
 	log := klog.FromContext(ctx)
 
-	billingService, err := cloudbilling.NewService(ctx, option.WithQuotaProject(projectName))
+	if p.config.BillingAccount == "" && p.billingAccountFromFolder {
+		billingAccount, err := p.inheritBillingAccountFromFolder(ctx, projectName)
+		if err != nil {
+			return err
+		}
+		p.config.BillingAccount = billingAccount
+	}
+	if p.config.BillingAccount == "" {
+		// Updating the billing info with an empty account name would unlink the project.
+		p.explainf(projectName, "no billing account configured -> skip link")
+		log.Info("no billing account configured, not linking", "project", projectName)
+		p.result.BillingStatus = BillingStatusSkipped
+		return nil
+	}
+	p.result.BillingAccount = p.config.BillingAccount
+
+	if p.dryRunServiceNotEnabled(ctx, projectName, "cloudbilling.googleapis.com", "link project to billing account "+p.config.BillingAccount) {
+		return nil
+	}
+
+	billingService, err := p.getCloudBillingClient(ctx, projectName)
 	if err != nil {
-		return fmt.Errorf("error creating cloudbilling client: %w", err)
+		return err
 	}
 
 	// Check if already linked
@@ -214,7 +1315,50 @@ func (p *ProjectManager) LinkProjectToBillingAccount(ctx context.Context, projec
 	}
 
 	if currentBillingInfo.BillingAccountName == p.config.BillingAccount && currentBillingInfo.BillingEnabled {
+		p.explainf(projectName, "billing account matches (%s) -> skip link", p.config.BillingAccount)
 		log.Info("project already linked to billing account", "project", projectName, "billingAccount", p.config.BillingAccount)
+		p.result.BillingStatus = BillingStatusAlreadyLinked
+		return nil
+	}
+
+	if currentBillingInfo.BillingAccountName != "" {
+		switch p.config.BillingLinkPolicy {
+		case BillingLinkPolicySkipIfLinked:
+			p.explainf(projectName, "linked to billing account %s and billingLinkPolicy is %s -> skip link", currentBillingInfo.BillingAccountName, p.config.BillingLinkPolicy)
+			log.Info("project already linked to a billing account, leaving as-is", "project", projectName, "currentBillingAccount", currentBillingInfo.BillingAccountName, "policy", p.config.BillingLinkPolicy)
+			p.result.BillingStatus = BillingStatusSkipped
+			return nil
+		case BillingLinkPolicyFailIfDifferent:
+			if currentBillingInfo.BillingAccountName != p.config.BillingAccount {
+				return fmt.Errorf("project %q is linked to billing account %q, expected %q (billingLinkPolicy is %q)", projectName, currentBillingInfo.BillingAccountName, p.config.BillingAccount, p.config.BillingLinkPolicy)
+			}
+		}
+	}
+
+	switch {
+	case currentBillingInfo.BillingAccountName == "":
+		p.explainf(projectName, "not linked to a billing account -> will link to %s", p.config.BillingAccount)
+	case currentBillingInfo.BillingAccountName != p.config.BillingAccount:
+		p.explainf(projectName, "linked to billing account %s, config has %s -> will relink", currentBillingInfo.BillingAccountName, p.config.BillingAccount)
+	default:
+		p.explainf(projectName, "billing is disabled on account %s -> will re-enable", p.config.BillingAccount)
+	}
+	if currentBillingInfo.BillingAccountName != "" && currentBillingInfo.BillingAccountName != p.config.BillingAccount {
+		action := fmt.Sprintf("relink project %q from billing account %q to %q", projectName, currentBillingInfo.BillingAccountName, p.config.BillingAccount)
+		if err := p.checkProjectAge(ctx, projectName, action); err != nil {
+			return err
+		}
+		if p.dryRun {
+			log.Info("dry-run: would " + action)
+			return nil
+		}
+		if err := p.confirmDestructive(ctx, action); err != nil {
+			return err
+		}
+	}
+
+	if p.dryRun {
+		log.Info("dry-run: would link project to billing account", "project", projectName, "billingAccount", p.config.BillingAccount)
 		return nil
 	}
 
@@ -225,11 +1369,30 @@ func (p *ProjectManager) LinkProjectToBillingAccount(ctx context.Context, projec
 		BillingEnabled:     true,
 	}
 
-	_, err = billingService.Projects.UpdateBillingInfo("projects/"+projectName, projectBillingInfo).Context(ctx).Do()
+	err = p.retryWithBackoff(ctx, func() error {
+		_, err := billingService.Projects.UpdateBillingInfo("projects/"+projectName, projectBillingInfo).Context(ctx).Do()
+		return err
+	})
+	p.audit(ctx, projectName, "link-billing", p.config.BillingAccount, err)
 	if err != nil {
+		if isBillingAccountPermissionDenied(err, p.config.BillingAccount) {
+			return fmt.Errorf("permission denied linking project %q to billing account %q: the caller needs billing.resourceAssociations.create on the billing account (e.g. roles/billing.user): %w", projectName, p.config.BillingAccount, err)
+		}
 		return fmt.Errorf("error linking project %q to billing account %q: %w", projectName, p.config.BillingAccount, err)
 	}
 
+	if p.strictBillingVerify {
+		billingInfo, err := billingService.Projects.GetBillingInfo("projects/" + projectName).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("error verifying billing info for project %q: %w", projectName, err)
+		}
+		if !billingInfo.BillingEnabled {
+			return fmt.Errorf("project %q was linked to billing account %q but billing is not enabled (is the billing account closed?)", projectName, p.config.BillingAccount)
+		}
+		log.Info("verified billing is enabled", "project", projectName, "billingAccount", billingInfo.BillingAccountName)
+	}
+
+	p.result.BillingStatus = BillingStatusLinked
 	log.Info("project linked to billing account", "project", projectName, "billingAccount", p.config.BillingAccount)
 	return nil
 }
@@ -237,6 +1400,10 @@ func (p *ProjectManager) LinkProjectToBillingAccount(ctx context.Context, projec
 func (p *ProjectManager) getEnabledServices(ctx context.Context, projectName string) (map[string]bool, error) {
 	log := klog.FromContext(ctx)
 
+	if p.enabledServices == nil && p.servicesCacheTTL > 0 {
+		p.enabledServices = p.readServicesCache(ctx, projectName)
+	}
+
 	if p.enabledServices == nil {
 		p.enabledServices = make(map[string]bool)
 
@@ -264,11 +1431,38 @@ func (p *ProjectManager) getEnabledServices(ctx context.Context, projectName str
 			p.enabledServices[resp.Config.Name] = true
 		}
 		log.Info("fetched enabled services", "count", len(p.enabledServices), "project", projectName)
+		if p.servicesCacheTTL > 0 {
+			p.writeServicesCache(ctx, projectName, p.enabledServices)
+		}
 	}
 	return p.enabledServices, nil
 }
 
-func (p *ProjectManager) EnableProjectServices(ctx context.Context, projectName string, servicesToEnable []string) error {
+// servicePrerequisites maps services to services that must be enabled before them.
+// BatchEnableServices normally resolves dependencies itself, so this only lists pairs
+// where we have seen enablement fail in some organizations.
+var servicePrerequisites = map[string][]string{
+	"container.googleapis.com":      {"compute.googleapis.com"},
+	"cloudfunctions.googleapis.com": {"cloudbuild.googleapis.com"},
+}
+
+// missingServices returns the services that are not in enabledServices, logging those that are.
+func (p *ProjectManager) missingServices(ctx context.Context, projectName string, enabledServices map[string]bool, services []string) []string {
+	log := klog.FromContext(ctx)
+
+	var missing []string
+	for _, serviceID := range services {
+		if !enabledServices[serviceID] {
+			missing = append(missing, serviceID)
+		} else {
+			log.Info("service already enabled", "service", serviceID, "project", projectName)
+		}
+	}
+	return missing
+}
+
+// PreviewProjectServices reads the enabled services and logs which of servicesToEnable would be enabled, without enabling them.
+func (p *ProjectManager) PreviewProjectServices(ctx context.Context, projectName string, servicesToEnable []string) error {
 	log := klog.FromContext(ctx)
 
 	enabledServices, err := p.getEnabledServices(ctx, projectName)
@@ -276,44 +1470,173 @@ func (p *ProjectManager) EnableProjectServices(ctx context.Context, projectName
 		return err
 	}
 
-	var servicesToBatchEnable []string
-	for _, serviceID := range servicesToEnable {
-		if !enabledServices[serviceID] {
-			servicesToBatchEnable = append(servicesToBatchEnable, serviceID)
-		} else {
-			log.Info("service already enabled", "service", serviceID, "project", projectName)
-		}
+	missing := p.missingServices(ctx, projectName, enabledServices, servicesToEnable)
+	p.explainServices(projectName, servicesToEnable, missing)
+	if len(missing) == 0 {
+		log.Info("dry-run: no services would be enabled", "project", projectName)
+		return nil
+	}
+	log.Info("dry-run: would enable services", "services", missing, "project", projectName)
+	return nil
+}
+
+// AssertProjectServices checks that all the configured services are enabled, without enabling any.
+// It returns an error listing the services that are not enabled.
+func (p *ProjectManager) AssertProjectServices(ctx context.Context, projectName string) error {
+	log := klog.FromContext(ctx)
+
+	enabledServices, err := p.getEnabledServices(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	missing := p.missingServices(ctx, projectName, enabledServices, p.config.Services)
+	if len(missing) != 0 {
+		return fmt.Errorf("services not enabled on project %q: %v", projectName, missing)
+	}
+	log.Info("all configured services are enabled", "project", projectName, "count", len(p.config.Services))
+	return nil
+}
+
+// EnableProjectServices enables the services that are not already enabled on the project.
+// The enabled services are listed first (once per run, or from the cache with -services-cache-ttl),
+// so that no BatchEnableServices operation is started when there is nothing to do; it has low quota limits.
+func (p *ProjectManager) EnableProjectServices(ctx context.Context, projectName string, servicesToEnable []string) error {
+	log := klog.FromContext(ctx)
+
+	enabledServices, err := p.getEnabledServices(ctx, projectName)
+	if err != nil {
+		return err
 	}
 
+	servicesToBatchEnable := p.missingServices(ctx, projectName, enabledServices, servicesToEnable)
+	p.explainServices(projectName, servicesToEnable, servicesToBatchEnable)
+
 	if len(servicesToBatchEnable) == 0 {
-		log.Info("no new services to enable", "project", projectName)
+		log.Info("all services already enabled", "services", servicesToEnable, "project", projectName)
+		return nil
+	}
+
+	// Enable (and wait for) any known prerequisites first, as BatchEnableServices does not always handle them.
+	var prerequisites []string
+	for _, serviceID := range servicesToBatchEnable {
+		for _, prerequisite := range servicePrerequisites[serviceID] {
+			if !enabledServices[prerequisite] && !slices.Contains(prerequisites, prerequisite) {
+				prerequisites = append(prerequisites, prerequisite)
+			}
+		}
+	}
+	if p.dryRun {
+		log.Info("dry-run: would enable services", "services", append(prerequisites, servicesToBatchEnable...), "project", projectName)
 		return nil
 	}
 
+	if len(prerequisites) != 0 {
+		log.Info("enabling prerequisite services first", "prerequisites", prerequisites, "project", projectName)
+		if err := p.EnableProjectServices(ctx, projectName, prerequisites); err != nil {
+			return err
+		}
+		servicesToBatchEnable = slices.DeleteFunc(servicesToBatchEnable, func(serviceID string) bool {
+			return enabledServices[serviceID]
+		})
+		if len(servicesToBatchEnable) == 0 {
+			return nil
+		}
+	}
+
 	suClient, err := p.getServiceUsageClient(ctx)
 	if err != nil {
 		return err
 	}
 
+	// BatchEnableServices accepts a limited number of services per request, so we enable them in batches.
+	// Up to -concurrency batches are in flight at once; rate limit errors are retried with backoff.
+	// A failed batch does not stop the others; the errors are reported together.
+	batches := slices.Collect(slices.Chunk(servicesToBatchEnable, maxServicesPerBatchEnable))
+	batchErrs := make([]error, len(batches))
+	inFlight := make(chan struct{}, max(p.concurrency, 1))
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			batchErrs[i] = p.batchEnableServices(ctx, suClient, projectName, batch)
+		}()
+	}
+	wg.Wait()
+
+	// Recording the results (and falling back for services blocked by org policy) updates our state, so is not done concurrently.
+	var errs []error
+	for i, batch := range batches {
+		if err := p.finishBatchEnableServices(ctx, projectName, batch, batchErrs[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// maxServicesPerBatchEnable is the maximum number of services BatchEnableServices accepts in one request.
+const maxServicesPerBatchEnable = 20
+
+// batchEnableServices enables the services with a single BatchEnableServices operation, and waits for it.
+// It may be called concurrently for different batches.
+func (p *ProjectManager) batchEnableServices(ctx context.Context, suClient *serviceusage.Client, projectName string, servicesToBatchEnable []string) error {
+	log := klog.FromContext(ctx)
+
 	log.Info("enabling services", "services", servicesToBatchEnable, "project", projectName)
 	req := &serviceusagepb.BatchEnableServicesRequest{
 		Parent:     fmt.Sprintf("projects/%s", projectName),
 		ServiceIds: servicesToBatchEnable,
 	}
 
-	op, err := suClient.BatchEnableServices(ctx, req)
+	var op *serviceusage.BatchEnableServicesOperation
+	err := p.retryWithBackoff(ctx, func() error {
+		var err error
+		op, err = suClient.BatchEnableServices(ctx, req)
+		return err
+	})
 	if err != nil {
+		p.audit(ctx, projectName, "enable-services", strings.Join(servicesToBatchEnable, ","), err)
 		return fmt.Errorf("error starting batch enable services operation: %w", err)
 	}
 
+	if p.servicesCacheTTL > 0 {
+		p.invalidateServicesCache(ctx, projectName)
+	}
+
 	_, err = op.Wait(ctx)
+	p.audit(ctx, projectName, "enable-services", strings.Join(servicesToBatchEnable, ","), err)
 	if err != nil {
 		return fmt.Errorf("error waiting for batch enable services operation: %w", err)
 	}
 
+	if p.waitForServicesReady {
+		if err := p.waitUntilServicesReady(ctx, suClient, projectName, servicesToBatchEnable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishBatchEnableServices records the outcome of batchEnableServices for the batch, returning its error.
+// If the batch failed because a service is blocked by org policy (and skipServicesBlockedByOrgPolicy is set),
+// the services are enabled one at a time instead, skipping the blocked ones.
+func (p *ProjectManager) finishBatchEnableServices(ctx context.Context, projectName string, servicesToBatchEnable []string, err error) error {
+	log := klog.FromContext(ctx)
+
+	if p.config.SkipServicesBlockedByOrgPolicy && isBlockedByOrgPolicy(err) {
+		return p.enableServicesSkippingBlocked(ctx, projectName, servicesToBatchEnable)
+	}
+	if err != nil {
+		return err
+	}
+
 	for _, serviceID := range servicesToBatchEnable {
 		p.enabledServices[serviceID] = true
 	}
+	p.result.ServicesEnabled = append(p.result.ServicesEnabled, servicesToBatchEnable...)
 
 	log.Info("services enabled", "services", servicesToBatchEnable, "project", projectName)
 	return nil
@@ -323,25 +1646,118 @@ func (p *ProjectManager) RunSetupCommands(ctx context.Context, projectName strin
 	log := klog.FromContext(ctx)
 
 	if len(p.config.SetupCommands) == 0 {
+		p.explainf(projectName, "no setup commands configured -> skip setup")
 		log.Info("no setup commands to run", "project", projectName)
 		return nil
 	}
+	p.explainf(projectName, "setup commands configured (%d) -> will run them", len(p.config.SetupCommands))
+
+	projectNumber, err := p.getProjectNumber(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	if p.dryRun {
+		templateData, err := p.setupCommandTemplateDataIfEnabled(ctx, projectName)
+		if err != nil {
+			return err
+		}
+		for _, command := range p.config.SetupCommands {
+			expandedCommand, err := expandSetupCommand(command, projectName, projectNumber, templateData)
+			if err != nil {
+				return err
+			}
+			log.Info("dry-run: would run setup command", "command", expandedCommand, "project", projectName)
+		}
+		return nil
+	}
+
+	env := p.setupCommandEnv(ctx, projectName, projectNumber)
+
+	templateData, err := p.setupCommandTemplateDataIfEnabled(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	timeout := p.setupCommandTimeoutOrDefault()
+
+	if err := p.waitBeforeSetupCommands(ctx, projectName); err != nil {
+		return err
+	}
 
 	log.Info("running setup commands", "project", projectName)
-	for _, command := range p.config.SetupCommands {
-		expandedCommand := strings.ReplaceAll(command, "${PROJECT_ID}", projectName)
+	for i, command := range p.config.SetupCommands {
+		expandedCommand, err := expandSetupCommand(command, projectName, projectNumber, templateData)
+		if err != nil {
+			return err
+		}
 		log.Info("running command", "command", expandedCommand, "project", projectName)
-		cmd := exec.Command("bash", "-c", expandedCommand)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("error running setup command %q: %w", expandedCommand, err)
+		output, err := p.newSetupCommandOutput(i)
+		if err != nil {
+			return err
+		}
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(cmdCtx, "bash", "-c", expandedCommand)
+		cmd.Env = env
+		cmd.Stdout = output.Stdout
+		cmd.Stderr = output.Stderr
+		killProcessGroupOnCancel(cmd)
+		start := time.Now()
+		runErr := cmd.Run()
+		timedOut := errors.Is(cmdCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		commandResult := SetupCommandResult{
+			Command:         expandedCommand,
+			ExitCode:        cmd.ProcessState.ExitCode(),
+			DurationSeconds: time.Since(start).Seconds(),
+			LogPath:         output.LogPath,
+		}
+		if runErr != nil {
+			commandResult.Error = runErr.Error()
+		}
+		p.result.SetupCommands = append(p.result.SetupCommands, commandResult)
+		p.audit(ctx, projectName, "run-setup-command", expandedCommand, runErr)
+		if err := output.Close(); err != nil {
+			return err
+		}
+		if output.LogPath != "" {
+			log.Info("captured command output", "command", expandedCommand, "path", output.LogPath)
+		}
+		if runErr != nil && timedOut {
+			return fmt.Errorf("setup command %q timed out after %v and was killed: %w", expandedCommand, timeout, runErr)
+		}
+		if runErr != nil {
+			if output.LogPath != "" {
+				return fmt.Errorf("error running setup command %q (output in %q): %w", expandedCommand, output.LogPath, runErr)
+			}
+			return fmt.Errorf("error running setup command %q: %w", expandedCommand, runErr)
 		}
 	}
 	log.Info("setup commands completed", "project", projectName)
 	return nil
 }
 
+// setupCommandEnv returns the environment for setup commands: our own environment, plus PROJECT_ID,
+// PROJECT_NUMBER and (if the caller's identity can be resolved) ACTOR_EMAIL.
+func (p *ProjectManager) setupCommandEnv(ctx context.Context, projectName string, projectNumber string) []string {
+	log := klog.FromContext(ctx)
+
+	env := os.Environ()
+	env = append(env, "PROJECT_ID="+projectName, "PROJECT_NUMBER="+projectNumber)
+	identity, err := p.getIdentityProvider()
+	var actorEmail string
+	if err == nil {
+		actorEmail, err = identity.CallerEmail(ctx)
+	}
+	if err != nil {
+		log.Error(err, "unable to resolve caller identity; ACTOR_EMAIL will not be set for setup commands")
+	} else {
+		log.Info("resolved caller identity for setup commands", "ACTOR_EMAIL", actorEmail)
+		env = append(env, "ACTOR_EMAIL="+actorEmail)
+	}
+	return env
+}
+
 func isNotFound(err error) bool {
 	if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusNotFound {
 		return true
@@ -356,19 +1772,211 @@ func isPermissionDenied(err error) bool {
 	return false
 }
 
+// isConflict returns true if err (or an error it wraps) is a 409 Conflict,
+// which is how etag mismatches (ABORTED) are reported.
+func isConflict(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusConflict {
+		return true
+	}
+	return false
+}
+
+// isBillingAccountPermissionDenied returns true if err is a permission denied error
+// caused by missing permissions on the billing account, rather than on the project.
+func isBillingAccountPermissionDenied(err error, billingAccount string) bool {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok || gerr.Code != http.StatusForbidden {
+		return false
+	}
+	text := gerr.Message + " " + gerr.Body
+	if strings.Contains(text, "billing.resourceAssociations.create") {
+		return true
+	}
+	if billingAccount != "" && strings.Contains(text, billingAccount) {
+		return true
+	}
+	return false
+}
+
 func loadConfig(path string) (*Config, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file %q: %w", path, err)
 	}
 	c := &Config{}
-	if err := yaml.Unmarshal(b, c); err != nil {
-		return nil, fmt.Errorf("error unmarshaling yaml from %q: %w", path, err)
+	switch filepath.Ext(path) {
+	case ".json":
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("error unmarshaling json from %q: %w", path, err)
+		}
+	default:
+		if err := yaml.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("error unmarshaling yaml from %q: %w", path, err)
+		}
 	}
 	return c, nil
 }
 
-func expandProjectName(pattern string) (string, error) {
+// applyEnvironment merges the named environment over the top-level config.
+// Scalar and list fields set in the environment replace the top-level values; map fields are merged.
+func applyEnvironment(c *Config, envName string) error {
+	raw, found := c.Environments[envName]
+	if !found {
+		var names []string
+		for name := range c.Environments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("environment %q not found (available environments: %v)", envName, names)
+	}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return fmt.Errorf("error parsing environment %q: %w", envName, err)
+	}
+	return nil
+}
+
+// validateConfig checks the config for values we know to be invalid,
+// so that we fail before making any API calls.
+func validateConfig(c *Config) error {
+	if len(c.Projects) != 0 && c.NamePattern != "" {
+		return fmt.Errorf("namePattern cannot be combined with projects; set namePattern on each project")
+	}
+	for i, project := range c.Projects {
+		if project.NamePattern == "" {
+			return fmt.Errorf("projects[%d].namePattern must be set", i)
+		}
+	}
+	if c.ProjectNumberHint != "" {
+		for _, r := range c.ProjectNumberHint {
+			if r < '0' || r > '9' {
+				return fmt.Errorf("projectNumberHint %q must be numeric", c.ProjectNumberHint)
+			}
+		}
+	}
+	for i := range c.ServiceGroups {
+		if err := c.ServiceGroups[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.ComputeProjectSettings.Validate(); err != nil {
+		return err
+	}
+	if err := c.TLS.Validate(); err != nil {
+		return err
+	}
+	if c.Proxy != "" {
+		if _, err := parseProxyURL(c.Proxy); err != nil {
+			return err
+		}
+	}
+	switch c.BillingLinkPolicy {
+	case "", BillingLinkPolicyEnsure, BillingLinkPolicySkipIfLinked, BillingLinkPolicyFailIfDifferent:
+	default:
+		return fmt.Errorf("billingLinkPolicy %q is not valid; must be one of %s, %s or %s", c.BillingLinkPolicy, BillingLinkPolicyEnsure, BillingLinkPolicySkipIfLinked, BillingLinkPolicyFailIfDifferent)
+	}
+	switch c.SetupCommandsPhase {
+	case "", SetupCommandsPhaseBeforeServices, SetupCommandsPhaseAfterServices, SetupCommandsPhaseAfterAll:
+	default:
+		return fmt.Errorf("setupCommandsPhase %q is not valid; must be one of %s, %s or %s", c.SetupCommandsPhase, SetupCommandsPhaseBeforeServices, SetupCommandsPhaseAfterServices, SetupCommandsPhaseAfterAll)
+	}
+	if err := validatePhases(c.Phases); err != nil {
+		return err
+	}
+	if c.SetupCommandTimeout != "" {
+		d, err := time.ParseDuration(c.SetupCommandTimeout)
+		if err != nil {
+			return fmt.Errorf("setupCommandTimeout: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("setupCommandTimeout must be positive, got %q", c.SetupCommandTimeout)
+		}
+	}
+	for i, binding := range c.IAMBindings {
+		if binding.Role == "" {
+			return fmt.Errorf("iamBindings[%d].role must be set", i)
+		}
+		if len(binding.Members) == 0 {
+			return fmt.Errorf("iamBindings[%d].members must be set", i)
+		}
+		if binding.Condition != nil {
+			if binding.Condition.Title == "" {
+				return fmt.Errorf("iamBindings[%d].condition.title must be set", i)
+			}
+			if strings.TrimSpace(binding.Condition.Expression) == "" {
+				return fmt.Errorf("iamBindings[%d].condition.expression must be set", i)
+			}
+		}
+	}
+	if c.SetupCommandsInitialDelay != "" {
+		d, err := time.ParseDuration(c.SetupCommandsInitialDelay)
+		if err != nil {
+			return fmt.Errorf("setupCommandsInitialDelay: %w", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("setupCommandsInitialDelay must not be negative, got %q", c.SetupCommandsInitialDelay)
+		}
+	}
+	if err := validateProjectOverrides(c.ProjectOverrides); err != nil {
+		return err
+	}
+	if err := validateTimeouts(c.Timeouts); err != nil {
+		return err
+	}
+	if len(c.Phases) != 0 && c.SetupCommandsPhase != "" {
+		return fmt.Errorf("setupCommandsPhase cannot be combined with phases; position %q within phases instead", PhaseSetup)
+	}
+	return nil
+}
+
+// expandProjectName expands the ${...} expressions in pattern, to produce a project ID.
+// ${today} is the current date in location.
+// If strictEnv is true, referencing an unset environment variable without a default is an error.
+func expandProjectName(pattern string, location *time.Location, strictEnv bool) (string, error) {
+	s, err := expandPatternWithOptions(pattern, location, strictEnv)
+	if err != nil {
+		return "", err
+	}
+	if s == "" {
+		return "", fmt.Errorf("project name pattern %q expanded to empty string", pattern)
+	}
+
+	// GCP project IDs must be lowercase.
+	s = strings.ToLower(s)
+	return s, nil
+}
+
+// validateProjectID checks that id satisfies GCP's rules for project IDs:
+// 6 to 30 characters of lowercase letters, digits and hyphens, starting with a letter and not ending with a hyphen.
+func validateProjectID(id string) error {
+	if len(id) < 6 || len(id) > 30 {
+		return fmt.Errorf("project ID %q must be 6 to 30 characters long, is %d", id, len(id))
+	}
+	if id[0] < 'a' || id[0] > 'z' {
+		return fmt.Errorf("project ID %q must start with a lowercase letter", id)
+	}
+	for _, r := range id {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return fmt.Errorf("project ID %q must contain only lowercase letters, digits and hyphens, found %q", id, r)
+		}
+	}
+	if strings.HasSuffix(id, "-") {
+		return fmt.Errorf("project ID %q must not end with a hyphen", id)
+	}
+	return nil
+}
+
+// expandPattern expands the ${...} expressions in pattern.
+// ${today} is the current date in location; ${env.NAME} is the value of the environment variable NAME,
+// and ${env.NAME:-default} is default if NAME is unset or empty;
+// ${random} and ${random:N} are random strings of lowercase letters and digits.
+func expandPattern(pattern string, location *time.Location) (string, error) {
+	return expandPatternWithOptions(pattern, location, false)
+}
+
+// expandPatternWithOptions expands the ${...} expressions in pattern, as for expandPattern.
+// If strictEnv is true, referencing an unset environment variable without a default is an error.
+func expandPatternWithOptions(pattern string, location *time.Location, strictEnv bool) (string, error) {
 	var out strings.Builder
 	in := pattern
 	for {
@@ -390,11 +1998,26 @@ func expandProjectName(pattern string) (string, error) {
 		var val string
 		switch expr {
 		case "today":
-			val = time.Now().Format("20060102")
+			val = timeNow().In(location).Format("20060102")
+		case "random":
+			val = randomSuffix(defaultRandomLength, out.Len() == 0)
 		default:
-			if strings.HasPrefix(expr, "env.") {
-				varName := strings.TrimPrefix(expr, "env.")
+			if lengthString, found := strings.CutPrefix(expr, "random:"); found {
+				n, err := strconv.Atoi(lengthString)
+				if err != nil || n < 1 || n > 30 {
+					return "", fmt.Errorf("invalid length in %q in pattern %q; must be between 1 and 30", expr, pattern)
+				}
+				val = randomSuffix(n, out.Len() == 0)
+			} else if strings.HasPrefix(expr, "env.") {
+				varName, defaultValue, hasDefault := strings.Cut(strings.TrimPrefix(expr, "env."), ":-")
 				val = os.Getenv(varName)
+				if val == "" && hasDefault {
+					val = defaultValue
+				} else if strictEnv {
+					if _, found := os.LookupEnv(varName); !found {
+						return "", fmt.Errorf("environment variable %q in pattern %q is not set (use ${env.%s:-default} to provide a default)", varName, pattern, varName)
+					}
+				}
 			} else {
 				return "", fmt.Errorf("unrecognized expression %q in pattern %q", expr, pattern)
 			}
@@ -402,15 +2025,30 @@ func expandProjectName(pattern string) (string, error) {
 		out.WriteString(val)
 	}
 
-	s := out.String()
-	if s == "" {
-		return "", fmt.Errorf("project name pattern %q expanded to empty string", pattern)
-	}
+	return out.String(), nil
+}
 
-	// GCP project IDs must be lowercase.
-	s = strings.ToLower(s)
-	// Note: We are not fully sanitizing the project ID here.
-	// The user is responsible for ensuring environment variables result in a valid GCP project ID.
-	// A valid ID contains lowercase letters, numbers, and hyphens.
-	return s, nil
+// timeNow returns the current time; it is a variable so that tests can fix the date used for ${today}.
+var timeNow = time.Now
+
+// defaultRandomLength is the length of the string generated by ${random}.
+const defaultRandomLength = 4
+
+const (
+	randomLetters = "abcdefghijklmnopqrstuvwxyz"
+	randomChars   = randomLetters + "0123456789"
+)
+
+// randomSuffix returns a random string of n lowercase letters and digits, valid in a project ID.
+// If atStart is true the string begins the project ID, which must start with a letter, so the first character is always a letter.
+func randomSuffix(n int, atStart bool) string {
+	b := make([]byte, n)
+	for i := range b {
+		if i == 0 && atStart {
+			b[i] = randomLetters[rand.IntN(len(randomLetters))]
+		} else {
+			b[i] = randomChars[rand.IntN(len(randomChars))]
+		}
+	}
+	return string(b)
 }
@@ -0,0 +1,765 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreatedByUs(t *testing.T) {
+	requested := &cloudresourcemanager.Project{
+		ProjectId: "abc-test-1",
+		Parent:    "folders/123",
+		Labels:    map[string]string{"team": "infra"},
+	}
+
+	grid := []struct {
+		name     string
+		existing *cloudresourcemanager.Project
+		want     bool
+	}{
+		{"not visible", nil, false},
+		{"same parent and labels", &cloudresourcemanager.Project{State: "ACTIVE", Parent: "folders/123", Labels: map[string]string{"team": "infra", "other": "x"}}, true},
+		{"different parent", &cloudresourcemanager.Project{State: "ACTIVE", Parent: "folders/456", Labels: map[string]string{"team": "infra"}}, false},
+		{"missing label", &cloudresourcemanager.Project{State: "ACTIVE", Parent: "folders/123"}, false},
+		{"pending deletion", &cloudresourcemanager.Project{State: "DELETE_REQUESTED", Parent: "folders/123", Labels: map[string]string{"team": "infra"}}, false},
+	}
+	for _, g := range grid {
+		if got := createdByUs(g.existing, requested); got != g.want {
+			t.Errorf("%s: got %v, want %v", g.name, got, g.want)
+		}
+	}
+}
+
+func TestWriteManifestSeparatorAcrossConfigs(t *testing.T) {
+	o := &runOptions{}
+	var out bytes.Buffer
+
+	// Two configs with one project each share the runOptions, as with -config-dir.
+	for _, manifest := range []string{"a: 1\n", "b: 2\n", "c: 3\n"} {
+		o.writeManifestSeparator(&out)
+		out.WriteString(manifest)
+	}
+
+	want := "a: 1\n---\nb: 2\n---\nc: 3\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestLoadConfigYAMLAndJSONAreEquivalent(t *testing.T) {
+	yamlConfig := `
+namePattern: "abc-${env.USER}-1"
+parent: folders/123
+billingAccount: 012345-6789AB-CDEF01
+services:
+- compute.googleapis.com
+- storage.googleapis.com
+labels:
+  team: infra
+timeouts:
+  services: 5m
+iamBindings:
+- role: roles/viewer
+  members:
+  - group:devs@example.com
+tls:
+  caFile: /etc/ssl/ca.pem
+projects:
+- namePattern: abc-other-1
+  services:
+  - pubsub.googleapis.com
+environments:
+  prod:
+    parent: folders/456
+`
+	jsonConfig := `{
+  "namePattern": "abc-${env.USER}-1",
+  "parent": "folders/123",
+  "billingAccount": "012345-6789AB-CDEF01",
+  "services": ["compute.googleapis.com", "storage.googleapis.com"],
+  "labels": {"team": "infra"},
+  "timeouts": {"services": "5m"},
+  "iamBindings": [{"role": "roles/viewer", "members": ["group:devs@example.com"]}],
+  "tls": {"caFile": "/etc/ssl/ca.pem"},
+  "projects": [{"namePattern": "abc-other-1", "services": ["pubsub.googleapis.com"]}],
+  "environments": {"prod": {"parent":"folders/456"}}
+}`
+
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "project.yaml")
+	jsonPath := filepath.Join(dir, "project.json")
+	if err := os.WriteFile(yamlPath, []byte(yamlConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonPath, []byte(jsonConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fromYAML, err := loadConfig(yamlPath)
+	if err != nil {
+		t.Fatalf("loading yaml: %v", err)
+	}
+	fromJSON, err := loadConfig(jsonPath)
+	if err != nil {
+		t.Fatalf("loading json: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("configs differ:\nyaml: %+v\njson: %+v", fromYAML, fromJSON)
+	}
+	if fromJSON.NamePattern != "abc-${env.USER}-1" || len(fromJSON.Projects) != 1 {
+		t.Errorf("unexpected config loaded from json: %+v", fromJSON)
+	}
+}
+
+func TestListConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.yml", "a.yaml", "c.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.yaml"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := listConfigFiles(dir)
+	if err != nil {
+		t.Fatalf("listConfigFiles: %v", err)
+	}
+	want := []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yml"), filepath.Join(dir, "c.json")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := listConfigFiles(t.TempDir()); err == nil {
+		t.Errorf("expected an error for a directory without configs")
+	}
+}
+
+func TestValidateConfigProjectNumberHint(t *testing.T) {
+	grid := []struct {
+		hint    string
+		wantErr bool
+	}{
+		{"", false},
+		{"123456789012", false},
+		{"12345-6789", true},
+		{"abc", true},
+		{" 123", true},
+	}
+	for _, g := range grid {
+		err := validateConfig(&Config{NamePattern: "abc-test-1", ProjectNumberHint: g.hint})
+		if (err != nil) != g.wantErr {
+			t.Errorf("projectNumberHint %q: got error %v, wantErr %v", g.hint, err, g.wantErr)
+		}
+	}
+}
+
+func TestLinkProjectToBillingAccountPolicies(t *testing.T) {
+	const (
+		configured = "billingAccounts/012345-6789AB-CDEF01"
+		other      = "billingAccounts/FEDCBA-987654-3210AB"
+	)
+
+	grid := []struct {
+		policy     string
+		current    string
+		wantUpdate bool
+		wantErr    bool
+		wantStatus string
+	}{
+		{"", other, true, false, BillingStatusLinked},
+		{BillingLinkPolicyEnsure, other, true, false, BillingStatusLinked},
+		{BillingLinkPolicyEnsure, "", true, false, BillingStatusLinked},
+		{BillingLinkPolicyEnsure, configured, false, false, BillingStatusAlreadyLinked},
+		{BillingLinkPolicySkipIfLinked, other, false, false, BillingStatusSkipped},
+		{BillingLinkPolicySkipIfLinked, "", true, false, BillingStatusLinked},
+		{BillingLinkPolicySkipIfLinked, configured, false, false, BillingStatusAlreadyLinked},
+		{BillingLinkPolicyFailIfDifferent, other, false, true, ""},
+		{BillingLinkPolicyFailIfDifferent, "", true, false, BillingStatusLinked},
+		{BillingLinkPolicyFailIfDifferent, configured, false, false, BillingStatusAlreadyLinked},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{
+			BillingAccountName: g.current,
+			BillingEnabled:     g.current != "",
+		}))
+		api.handle("PUT /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{
+			BillingAccountName: configured,
+			BillingEnabled:     true,
+		}))
+
+		p := newTestProjectManager(t, &Config{BillingAccount: configured, BillingLinkPolicy: g.policy}, api, nil)
+		p.assumeYes = true
+
+		err := p.LinkProjectToBillingAccount(context.Background(), "abc-test-1")
+		if (err != nil) != g.wantErr {
+			t.Errorf("policy %q, current %q: got error %v, wantErr %v", g.policy, g.current, err, g.wantErr)
+		}
+		updated := api.CallCount("PUT /v1/projects/abc-test-1/billingInfo") != 0
+		if updated != g.wantUpdate {
+			t.Errorf("policy %q, current %q: got update %v, want %v", g.policy, g.current, updated, g.wantUpdate)
+		}
+		if !g.wantErr && p.result.BillingStatus != g.wantStatus {
+			t.Errorf("policy %q, current %q: got billing status %q, want %q", g.policy, g.current, p.result.BillingStatus, g.wantStatus)
+		}
+	}
+}
+
+func TestCheckProjectIDAvailable(t *testing.T) {
+	grid := []struct {
+		name      string
+		handler   http.HandlerFunc
+		wantErr   bool
+		wantTaken bool
+	}{
+		{"not found", respondError(http.StatusNotFound, "NOT_FOUND", "not found"), false, false},
+		{"visible", respondJSON(&cloudresourcemanager.Project{ProjectId: "abc-test-1", State: "ACTIVE"}), true, true},
+		{"not accessible", respondError(http.StatusForbidden, "PERMISSION_DENIED", "permission denied"), true, true},
+		{"server error", respondError(http.StatusBadRequest, "INVALID_ARGUMENT", "bad request"), true, false},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET /v3/projects/abc-test-1", g.handler)
+		p := newTestProjectManager(t, &Config{}, api, nil)
+
+		err := p.checkProjectIDAvailable(context.Background(), "abc-test-1")
+		if (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+		if isProjectIDTaken(err) != g.wantTaken {
+			t.Errorf("%s: got isProjectIDTaken %v, want %v (error %v)", g.name, isProjectIDTaken(err), g.wantTaken, err)
+		}
+	}
+}
+
+func TestLinkProjectToBillingAccountStrictVerify(t *testing.T) {
+	const account = "billingAccounts/012345-6789AB-CDEF01"
+
+	for _, enabledAfterLink := range []bool{false, true} {
+		api := newFakeAPI(t)
+		reads := 0
+		api.handle("GET /v1/projects/abc-test-1/billingInfo", func(w http.ResponseWriter, r *http.Request) {
+			reads++
+			if reads == 1 {
+				writeJSON(w, &cloudbilling.ProjectBillingInfo{})
+				return
+			}
+			// The post-link read; the link "succeeded" but billing may still be disabled.
+			writeJSON(w, &cloudbilling.ProjectBillingInfo{BillingAccountName: account, BillingEnabled: enabledAfterLink})
+		})
+		api.handle("PUT /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{BillingAccountName: account, BillingEnabled: true}))
+
+		p := newTestProjectManager(t, &Config{BillingAccount: account}, api, nil)
+		p.strictBillingVerify = true
+
+		err := p.LinkProjectToBillingAccount(context.Background(), "abc-test-1")
+		if enabledAfterLink && err != nil {
+			t.Errorf("billing enabled after link: unexpected error %v", err)
+		}
+		if !enabledAfterLink && err == nil {
+			t.Errorf("billing disabled after link: expected an error")
+		}
+		if reads != 2 {
+			t.Errorf("got %d billing info reads, want 2 (before and after linking)", reads)
+		}
+	}
+}
+
+func TestEnvironmentSelection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project.yaml")
+	if err := os.WriteFile(path, []byte(`
+namePattern: abc-test-1
+parent: folders/123
+billingAccount: billingAccounts/012345-6789AB-CDEF01
+services:
+- compute.googleapis.com
+labels:
+  team: infra
+  tier: dev
+environments:
+  staging:
+    parent: folders/456
+    services:
+    - storage.googleapis.com
+    labels:
+      tier: staging
+  prod:
+    parent: folders/789
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadEffectiveConfig(path, "staging")
+	if err != nil {
+		t.Fatalf("loadEffectiveConfig: %v", err)
+	}
+	// Scalars and lists from the environment replace the top-level values.
+	if c.Parent != "folders/456" {
+		t.Errorf("got parent %q, want the environment's folders/456", c.Parent)
+	}
+	if !reflect.DeepEqual(c.Services, []string{"storage.googleapis.com"}) {
+		t.Errorf("got services %v, want the environment's list", c.Services)
+	}
+	// Fields not set in the environment keep the top-level values.
+	if c.NamePattern != "abc-test-1" || c.BillingAccount != "billingAccounts/012345-6789AB-CDEF01" {
+		t.Errorf("got namePattern %q billingAccount %q, want the top-level values", c.NamePattern, c.BillingAccount)
+	}
+	// Maps are merged, with the environment taking precedence.
+	if want := map[string]string{"team": "infra", "tier": "staging"}; !reflect.DeepEqual(c.Labels, want) {
+		t.Errorf("got labels %v, want %v", c.Labels, want)
+	}
+
+	c, err = loadEffectiveConfig(path, "prod")
+	if err != nil {
+		t.Fatalf("loadEffectiveConfig: %v", err)
+	}
+	if c.Parent != "folders/789" || !reflect.DeepEqual(c.Services, []string{"compute.googleapis.com"}) {
+		t.Errorf("prod: got parent %q services %v", c.Parent, c.Services)
+	}
+
+	if _, err := loadEffectiveConfig(path, "qa"); err == nil {
+		t.Errorf("expected an error for an unknown environment")
+	}
+}
+
+func TestEnableProjectServicesPrerequisitesFirst(t *testing.T) {
+	grid := []struct {
+		name      string
+		enabled   []string
+		enable    []string
+		wantCalls []string
+	}{
+		{
+			name:   "prerequisite missing",
+			enable: []string{"container.googleapis.com", "storage.googleapis.com"},
+			wantCalls: []string{
+				"BatchEnableServices compute.googleapis.com",
+				"BatchEnableServices container.googleapis.com,storage.googleapis.com",
+			},
+		},
+		{
+			name:      "prerequisite already enabled",
+			enabled:   []string{"compute.googleapis.com"},
+			enable:    []string{"container.googleapis.com"},
+			wantCalls: []string{"BatchEnableServices container.googleapis.com"},
+		},
+		{
+			name:      "prerequisite requested too",
+			enable:    []string{"compute.googleapis.com", "container.googleapis.com"},
+			wantCalls: []string{"BatchEnableServices compute.googleapis.com", "BatchEnableServices container.googleapis.com"},
+		},
+		{
+			name:      "no known prerequisites",
+			enable:    []string{"storage.googleapis.com"},
+			wantCalls: []string{"BatchEnableServices storage.googleapis.com"},
+		},
+	}
+	for _, g := range grid {
+		su, suClient := newFakeServiceUsage(t)
+		for _, service := range g.enabled {
+			su.enabled[service] = true
+		}
+		p := newTestProjectManager(t, &Config{}, nil, suClient)
+
+		if err := p.EnableProjectServices(context.Background(), "abc-test-1", g.enable); err != nil {
+			t.Errorf("%s: EnableProjectServices: %v", g.name, err)
+			continue
+		}
+		if got := su.CallsTo("BatchEnableServices"); !reflect.DeepEqual(got, g.wantCalls) {
+			t.Errorf("%s: got calls %v, want %v", g.name, got, g.wantCalls)
+		}
+	}
+}
+
+func TestExpandTodayAcrossTimezones(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+
+	loadLocation := func(name string) *time.Location {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skipf("timezone database not available: %v", err)
+		}
+		return location
+	}
+	newYork := loadLocation("America/New_York")
+	tokyo := loadLocation("Asia/Tokyo")
+
+	grid := []struct {
+		now      time.Time
+		location *time.Location
+		want     string
+	}{
+		// Just before midnight UTC: Tokyo is already on the next day.
+		{time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC), time.UTC, "abc-20260310"},
+		{time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC), tokyo, "abc-20260311"},
+		{time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC), newYork, "abc-20260310"},
+		// Just after midnight UTC: New York is still on the previous day.
+		{time.Date(2026, 3, 11, 0, 30, 0, 0, time.UTC), time.UTC, "abc-20260311"},
+		{time.Date(2026, 3, 11, 0, 30, 0, 0, time.UTC), newYork, "abc-20260310"},
+		{time.Date(2026, 3, 11, 0, 30, 0, 0, time.UTC), tokyo, "abc-20260311"},
+	}
+	for _, g := range grid {
+		timeNow = func() time.Time { return g.now }
+		got, err := expandProjectName("abc-${today}", g.location, false)
+		if err != nil {
+			t.Fatalf("expandProjectName: %v", err)
+		}
+		if got != g.want {
+			t.Errorf("at %v in %v: got %q, want %q", g.now, g.location, got, g.want)
+		}
+	}
+}
+
+func TestEnsureProjectExistsSoftDeleted(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{
+		Name:      "projects/123456789012",
+		ProjectId: "abc-test-1",
+		State:     "DELETE_REQUESTED",
+	}))
+	p := newTestProjectManager(t, &Config{}, api, nil)
+
+	err := p.EnsureProjectExists(context.Background(), "abc-test-1")
+	if err == nil {
+		t.Fatalf("expected an error for a project pending deletion")
+	}
+	if !strings.Contains(err.Error(), "pending deletion") || !strings.Contains(err.Error(), "undelete") {
+		t.Errorf("expected the error to explain the soft-deleted state and suggest undelete, got %v", err)
+	}
+	// We must not try to create the project (or change it) again.
+	if calls := api.Calls(); !reflect.DeepEqual(calls, []string{"GET /v3/projects/abc-test-1"}) {
+		t.Errorf("got calls %v, want only the read", calls)
+	}
+}
+
+func TestLinkProjectToBillingAccountPermissionDenied(t *testing.T) {
+	const account = "billingAccounts/012345-6789AB-CDEF01"
+
+	grid := []struct {
+		name            string
+		body            string
+		wantBillingHint bool
+	}{
+		{
+			name:            "missing permission on the billing account",
+			body:            `{"error":{"code":403,"message":"The caller does not have permission","status":"PERMISSION_DENIED","details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"IAM_PERMISSION_DENIED","metadata":{"permission":"billing.resourceAssociations.create"}}]}}`,
+			wantBillingHint: true,
+		},
+		{
+			name:            "billing account named in the message",
+			body:            `{"error":{"code":403,"message":"Permission denied on ` + account + `","status":"PERMISSION_DENIED"}}`,
+			wantBillingHint: true,
+		},
+		{
+			name:            "missing permission on the project",
+			body:            `{"error":{"code":403,"message":"Permission 'resourcemanager.projects.createBillingAssignment' denied on project abc-test-1","status":"PERMISSION_DENIED"}}`,
+			wantBillingHint: false,
+		},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{}))
+		api.handle("PUT /v1/projects/abc-test-1/billingInfo", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(g.body))
+		})
+		p := newTestProjectManager(t, &Config{BillingAccount: account}, api, nil)
+
+		err := p.LinkProjectToBillingAccount(context.Background(), "abc-test-1")
+		if err == nil {
+			t.Errorf("%s: expected an error", g.name)
+			continue
+		}
+		hint := strings.Contains(err.Error(), "roles/billing.user") && strings.Contains(err.Error(), account)
+		if hint != g.wantBillingHint {
+			t.Errorf("%s: got error %q, want billing account hint %v", g.name, err, g.wantBillingHint)
+		}
+		// A 403 is not transient, so it is not retried.
+		if n := api.CallCount("PUT /v1/projects/abc-test-1/billingInfo"); n != 1 {
+			t.Errorf("%s: got %d link attempts, want 1", g.name, n)
+		}
+	}
+}
+
+func TestExpandRandom(t *testing.T) {
+	grid := []struct {
+		pattern string
+		want    string
+	}{
+		{"abc-${random}", `^abc-[a-z0-9]{4}$`},
+		{"abc-${random:8}", `^abc-[a-z0-9]{8}$`},
+		// A project ID must start with a letter, so a leading ${random} always does.
+		{"${random:6}-test", `^[a-z][a-z0-9]{5}-test$`},
+		{"${random}", `^[a-z][a-z0-9]{3}$`},
+	}
+	for _, g := range grid {
+		// Expand repeatedly, so that an occasional leading digit would be caught.
+		for range 200 {
+			got, err := expandPattern(g.pattern, time.UTC)
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", g.pattern, err)
+			}
+			if !regexp.MustCompile(g.want).MatchString(got) {
+				t.Fatalf("%q: got %q, want match for %s", g.pattern, got, g.want)
+			}
+		}
+	}
+
+	for _, pattern := range []string{"abc-${random:0}", "abc-${random:31}", "abc-${random:x}"} {
+		if _, err := expandPattern(pattern, time.UTC); err == nil {
+			t.Errorf("%q: expected an error for an invalid length", pattern)
+		}
+	}
+}
+
+func TestAssertProjectServices(t *testing.T) {
+	grid := []struct {
+		name    string
+		enabled []string
+		wantErr string
+	}{
+		{"all present", []string{"compute.googleapis.com", "storage.googleapis.com", "pubsub.googleapis.com"}, ""},
+		{"drift detected", []string{"compute.googleapis.com"}, "storage.googleapis.com"},
+	}
+	for _, g := range grid {
+		su, suClient := newFakeServiceUsage(t)
+		for _, service := range g.enabled {
+			su.enabled[service] = true
+		}
+		p := newTestProjectManager(t, &Config{Services: []string{"compute.googleapis.com", "storage.googleapis.com"}}, nil, suClient)
+
+		err := p.AssertProjectServices(context.Background(), "abc-test-1")
+		if g.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", g.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), g.wantErr) {
+			t.Errorf("%s: got error %v, want an error naming %s", g.name, err, g.wantErr)
+		}
+
+		// The assertion is only an alarm; it never enables anything.
+		if calls := append(su.CallsTo("BatchEnableServices"), su.CallsTo("EnableService")...); len(calls) != 0 {
+			t.Errorf("%s: expected no enable calls, got %v", g.name, calls)
+		}
+	}
+}
+
+func TestValidateProjectID(t *testing.T) {
+	grid := []struct {
+		id      string
+		wantErr bool
+	}{
+		{"abc-test-1", false},
+		{"abcdef", false},
+		{"a23456789012345678901234567890", false},
+		{"abc12", true},
+		{"a234567890123456789012345678901", true},
+		{"1abc-test", true},
+		{"-abc-test", true},
+		{"abc-test-", true},
+		{"abc_test_1", true},
+		{"abc.test.1", true},
+		{"Abc-test-1", true},
+		{"", true},
+	}
+	for _, g := range grid {
+		if err := validateProjectID(g.id); (err != nil) != g.wantErr {
+			t.Errorf("%q: got error %v, wantErr %v", g.id, err, g.wantErr)
+		}
+	}
+}
+
+func TestExpandProjectNameFromEnv(t *testing.T) {
+	grid := []struct {
+		env     string
+		want    string
+		wantErr bool
+	}{
+		// Uppercase from the environment is lowercased, so it is valid.
+		{"FeatureX", "ci-featurex-1", false},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZ", "ci-abcdefghijklmnopqrstuvwxyz-1", true},
+		{"feature_x", "ci-feature_x-1", true},
+	}
+	for _, g := range grid {
+		t.Setenv("TEST_BRANCH", g.env)
+		got, err := expandProjectName("ci-${env.TEST_BRANCH}-1", time.UTC, false)
+		if err != nil {
+			t.Fatalf("%q: unexpected expansion error: %v", g.env, err)
+		}
+		if got != g.want {
+			t.Errorf("%q: got %q, want %q", g.env, got, g.want)
+		}
+		if err := validateProjectID(got); (err != nil) != g.wantErr {
+			t.Errorf("%q: got validation error %v, wantErr %v", g.env, err, g.wantErr)
+		}
+	}
+}
+
+func TestExpandEnvDefaults(t *testing.T) {
+	t.Setenv("TEST_CLUSTER", "prod")
+	t.Setenv("TEST_EMPTY", "")
+	t.Setenv("TEST_UNSET", "")
+	os.Unsetenv("TEST_UNSET")
+
+	grid := []struct {
+		pattern   string
+		strictEnv bool
+		want      string
+		wantErr   bool
+	}{
+		{"abc-${env.TEST_CLUSTER}", false, "abc-prod", false},
+		{"abc-${env.TEST_CLUSTER:-dev}", false, "abc-prod", false},
+		{"abc-${env.TEST_UNSET:-dev}", false, "abc-dev", false},
+		{"abc-${env.TEST_EMPTY:-dev}", false, "abc-dev", false},
+		// Without a default, unset and empty variables expand to the empty string...
+		{"abc-${env.TEST_UNSET}-1", false, "abc--1", false},
+		{"abc-${env.TEST_EMPTY}-1", false, "abc--1", false},
+		// ...unless strictEnv is set, when an unset variable is an error.
+		{"abc-${env.TEST_UNSET}-1", true, "", true},
+		{"abc-${env.TEST_EMPTY}-1", true, "abc--1", false},
+		{"abc-${env.TEST_UNSET:-dev}", true, "abc-dev", false},
+		{"abc-${env.TEST_CLUSTER}", true, "abc-prod", false},
+	}
+	for _, g := range grid {
+		got, err := expandPatternWithOptions(g.pattern, time.UTC, g.strictEnv)
+		if g.wantErr {
+			if err == nil {
+				t.Errorf("%q (strictEnv=%v): expected an error, got %q", g.pattern, g.strictEnv, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q (strictEnv=%v): unexpected error: %v", g.pattern, g.strictEnv, err)
+			continue
+		}
+		if got != g.want {
+			t.Errorf("%q (strictEnv=%v): got %q, want %q", g.pattern, g.strictEnv, got, g.want)
+		}
+	}
+}
+
+func TestEnableProjectServicesBatchesOf20(t *testing.T) {
+	var services []string
+	for i := range 45 {
+		services = append(services, fmt.Sprintf("service%02d.googleapis.com", i))
+	}
+
+	su, suClient := newFakeServiceUsage(t)
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+	if err := p.EnableProjectServices(context.Background(), "abc-test-1", services); err != nil {
+		t.Fatalf("EnableProjectServices: %v", err)
+	}
+
+	want := []string{
+		"BatchEnableServices " + strings.Join(services[0:20], ","),
+		"BatchEnableServices " + strings.Join(services[20:40], ","),
+		"BatchEnableServices " + strings.Join(services[40:45], ","),
+	}
+	if got := su.CallsTo("BatchEnableServices"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d batch calls %v, want 3 batches of 20, 20 and 5", len(got), got)
+	}
+	for _, service := range services {
+		if !su.Enabled(service) {
+			t.Errorf("expected %s to be enabled", service)
+		}
+	}
+}
+
+func TestEnableProjectServicesAggregatesBatchErrors(t *testing.T) {
+	var services []string
+	for i := range 45 {
+		services = append(services, fmt.Sprintf("service%02d.googleapis.com", i))
+	}
+
+	su, suClient := newFakeServiceUsage(t)
+	su.enableErr = func(batch []string) error {
+		if slices.Contains(batch, "service25.googleapis.com") {
+			return status.Error(codes.InvalidArgument, "service25.googleapis.com is not a valid service")
+		}
+		return nil
+	}
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+
+	err := p.EnableProjectServices(context.Background(), "abc-test-1", services)
+	if err == nil || !strings.Contains(err.Error(), "service25.googleapis.com") {
+		t.Fatalf("got error %v, want the failed batch reported", err)
+	}
+	// The failed middle batch does not stop the last one.
+	if got := len(su.CallsTo("BatchEnableServices")); got != 3 {
+		t.Errorf("got %d batch calls, want 3", got)
+	}
+	if !su.Enabled("service00.googleapis.com") || !su.Enabled("service44.googleapis.com") {
+		t.Errorf("expected the first and last batches to be enabled")
+	}
+	if su.Enabled("service20.googleapis.com") {
+		t.Errorf("expected the failed batch not to be enabled")
+	}
+}
+
+func TestEnableProjectServicesConcurrency(t *testing.T) {
+	var services []string
+	for i := range 45 {
+		services = append(services, fmt.Sprintf("service%02d.googleapis.com", i))
+	}
+
+	for _, concurrency := range []int{1, 2, 3} {
+		var mu sync.Mutex
+		inFlight, maxInFlight := 0, 0
+		su, suClient := newFakeServiceUsage(t)
+		su.enableErr = func(batch []string) error {
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			if slices.Contains(batch, "service25.googleapis.com") {
+				return status.Error(codes.InvalidArgument, "service25.googleapis.com is not a valid service")
+			}
+			return nil
+		}
+		p := newTestProjectManager(t, &Config{}, nil, suClient)
+		p.concurrency = concurrency
+
+		err := p.EnableProjectServices(context.Background(), "abc-test-1", services)
+		if err == nil || !strings.Contains(err.Error(), "service25.googleapis.com") {
+			t.Errorf("concurrency %d: got error %v, want the failed batch reported", concurrency, err)
+		}
+		if maxInFlight != concurrency {
+			t.Errorf("concurrency %d: got %d batches in flight at once, want %d", concurrency, maxInFlight, concurrency)
+		}
+		if got := len(su.CallsTo("BatchEnableServices")); got != 3 {
+			t.Errorf("concurrency %d: got %d batch calls, want 3", concurrency, got)
+		}
+		// Only the successful batches are recorded as enabled.
+		if got, want := len(p.result.ServicesEnabled), 25; got != want {
+			t.Errorf("concurrency %d: got %d services recorded as enabled, want %d", concurrency, got, want)
+		}
+		if !p.enabledServices["service44.googleapis.com"] || p.enabledServices["service20.googleapis.com"] {
+			t.Errorf("concurrency %d: expected only the successful batches in the enabled services", concurrency)
+		}
+	}
+}
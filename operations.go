@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+const (
+	// operationPollMaxDelay caps the delay between polls.
+	operationPollMaxDelay = 30 * time.Second
+	// operationTimeout is how long we wait for a resourcemanager operation before giving up, if the phase has no timeout.
+	operationTimeout = 10 * time.Minute
+)
+
+// operationPollInitialDelay is the delay before we first poll a resourcemanager operation; it doubles for each poll.
+// It is a variable so that tests can poll quickly.
+var operationPollInitialDelay = time.Second
+
+// operationsGetter reads the current state of a resourcemanager operation.
+type operationsGetter interface {
+	GetOperation(ctx context.Context, name string) (*cloudresourcemanager.Operation, error)
+}
+
+// crmOperations reads operations with the resourcemanager API.
+type crmOperations struct {
+	crmService *cloudresourcemanager.Service
+}
+
+// GetOperation implements operationsGetter.
+func (c *crmOperations) GetOperation(ctx context.Context, name string) (*cloudresourcemanager.Operation, error) {
+	return c.crmService.Operations.Get(name).Context(ctx).Do()
+}
+
+// getOperationsGetter returns the operations getter, built from the resourcemanager client on first use.
+func (p *ProjectManager) getOperationsGetter(ctx context.Context) (operationsGetter, error) {
+	if p.operations != nil {
+		return p.operations, nil
+	}
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.operations = &crmOperations{crmService: crmService}
+	return p.operations, nil
+}
+
+// waitForOperation polls the resourcemanager operation until it is done, returning the completed operation.
+// The caller should check the returned operation's Error.
+func (p *ProjectManager) waitForOperation(ctx context.Context, op *cloudresourcemanager.Operation) (*cloudresourcemanager.Operation, error) {
+	operations, err := p.getOperationsGetter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A phase timeout, if configured, takes precedence.
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, operationTimeout)
+		defer cancel()
+	}
+
+	delay := operationPollInitialDelay
+	for !op.Done {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for operation %q: %w", op.Name, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, operationPollMaxDelay)
+
+		name := op.Name
+		err = p.retryWithBackoff(ctx, func() error {
+			op, err = operations.GetOperation(ctx, name)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting status of operation %q: %w", name, err)
+		}
+	}
+	return op, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// fakeOperations is an operationsGetter whose operation is done after doneAfter polls.
+type fakeOperations struct {
+	doneAfter int
+
+	mu    sync.Mutex
+	polls int
+}
+
+func (f *fakeOperations) GetOperation(ctx context.Context, name string) (*cloudresourcemanager.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polls++
+	op := &cloudresourcemanager.Operation{Name: name}
+	if f.doneAfter > 0 && f.polls >= f.doneAfter {
+		op.Done = true
+	}
+	return op, nil
+}
+
+func (f *fakeOperations) Polls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.polls
+}
+
+func TestWaitForOperation(t *testing.T) {
+	defer func(d time.Duration) { operationPollInitialDelay = d }(operationPollInitialDelay)
+	operationPollInitialDelay = time.Millisecond
+
+	for _, doneAfter := range []int{1, 3, 5} {
+		fake := &fakeOperations{doneAfter: doneAfter}
+		p := newTestProjectManager(t, &Config{}, nil, nil)
+		p.operations = fake
+
+		op, err := p.waitForOperation(context.Background(), &cloudresourcemanager.Operation{Name: "operations/cp.123"})
+		if err != nil {
+			t.Fatalf("doneAfter %d: waitForOperation: %v", doneAfter, err)
+		}
+		if !op.Done {
+			t.Errorf("doneAfter %d: expected the returned operation to be done", doneAfter)
+		}
+		if got := fake.Polls(); got != doneAfter {
+			t.Errorf("doneAfter %d: got %d polls, want %d", doneAfter, got, doneAfter)
+		}
+	}
+}
+
+func TestWaitForOperationAlreadyDone(t *testing.T) {
+	fake := &fakeOperations{}
+	p := newTestProjectManager(t, &Config{}, nil, nil)
+	p.operations = fake
+
+	if _, err := p.waitForOperation(context.Background(), &cloudresourcemanager.Operation{Name: "operations/cp.123", Done: true}); err != nil {
+		t.Fatalf("waitForOperation: %v", err)
+	}
+	if got := fake.Polls(); got != 0 {
+		t.Errorf("expected no polls for a completed operation, got %d", got)
+	}
+}
+
+func TestWaitForOperationDeadline(t *testing.T) {
+	defer func(d time.Duration) { operationPollInitialDelay = d }(operationPollInitialDelay)
+	operationPollInitialDelay = time.Millisecond
+
+	// The operation never completes, so we must give up at the context deadline rather than poll forever.
+	fake := &fakeOperations{}
+	p := newTestProjectManager(t, &Config{}, nil, nil)
+	p.operations = fake
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := p.waitForOperation(ctx, &cloudresourcemanager.Operation{Name: "operations/cp.123"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+	// The delay doubles from 1ms, so 50ms allows only a handful of polls.
+	if got := fake.Polls(); got == 0 || got > 6 {
+		t.Errorf("got %d polls in 50ms, want a few with backoff", got)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"google.golang.org/api/orgpolicy/v2"
+	"k8s.io/klog/v2"
+)
+
+// restrictNonCmekServicesConstraint is the org policy constraint listing services that must use CMEK.
+const restrictNonCmekServicesConstraint = "gcp.restrictNonCmekServices"
+
+func (p *ProjectManager) getOrgPolicyClient(ctx context.Context) (*orgpolicy.Service, error) {
+	if p.orgPolicyService != nil {
+		return p.orgPolicyService, nil
+	}
+	opts, err := p.clientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgPolicyService, err := orgpolicy.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating orgpolicy client: %w", err)
+	}
+	p.orgPolicyService = orgPolicyService
+	return orgPolicyService, nil
+}
+
+// buildRestrictNonCmekServicesPolicy builds the project policy requiring CMEK for the given services.
+// For this constraint, services in the denied list are the ones that may not create resources without CMEK.
+func buildRestrictNonCmekServicesPolicy(projectName string, services []string) *orgpolicy.GoogleCloudOrgpolicyV2Policy {
+	deniedValues := slices.Clone(services)
+	sort.Strings(deniedValues)
+	return &orgpolicy.GoogleCloudOrgpolicyV2Policy{
+		Name: "projects/" + projectName + "/policies/" + restrictNonCmekServicesConstraint,
+		Spec: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{
+			Rules: []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{
+				{
+					Values: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRuleStringValues{
+						DeniedValues: deniedValues,
+					},
+				},
+			},
+		},
+	}
+}
+
+// policySpecMatches returns true if the existing policy has the same rules as the desired policy.
+func policySpecMatches(existing, desired *orgpolicy.GoogleCloudOrgpolicyV2Policy) bool {
+	if existing.Spec == nil || existing.Spec.InheritFromParent || existing.Spec.Reset {
+		return false
+	}
+	if len(existing.Spec.Rules) != 1 {
+		return false
+	}
+	rule := existing.Spec.Rules[0]
+	if rule.AllowAll || rule.DenyAll || rule.Condition != nil || rule.Values == nil || len(rule.Values.AllowedValues) != 0 {
+		return false
+	}
+	existingValues := slices.Clone(rule.Values.DeniedValues)
+	sort.Strings(existingValues)
+	return slices.Equal(existingValues, desired.Spec.Rules[0].Values.DeniedValues)
+}
+
+// EnsureCMEKPolicy sets the gcp.restrictNonCmekServices org policy on the project
+// so that the configured services require customer-managed encryption keys.
+func (p *ProjectManager) EnsureCMEKPolicy(ctx context.Context, projectName string) error {
+	log := klog.FromContext(ctx)
+
+	if len(p.config.CMEKRequiredServices) == 0 {
+		return nil
+	}
+
+	if err := p.EnableProjectServices(ctx, projectName, []string{"orgpolicy.googleapis.com"}); err != nil {
+		return err
+	}
+
+	if p.dryRunServiceNotEnabled(ctx, projectName, "orgpolicy.googleapis.com", "set org policy "+restrictNonCmekServicesConstraint) {
+		return nil
+	}
+
+	orgPolicyService, err := p.getOrgPolicyClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	desired := buildRestrictNonCmekServicesPolicy(projectName, p.config.CMEKRequiredServices)
+
+	existing, err := orgPolicyService.Projects.Policies.Get(desired.Name).Context(ctx).Do()
+	if err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("error getting org policy %q: %w", desired.Name, err)
+		}
+		if p.dryRun {
+			log.Info("dry-run: would create org policy", "project", projectName, "constraint", restrictNonCmekServicesConstraint, "services", desired.Spec.Rules[0].Values.DeniedValues)
+			return nil
+		}
+		log.Info("creating org policy", "project", projectName, "constraint", restrictNonCmekServicesConstraint, "services", desired.Spec.Rules[0].Values.DeniedValues)
+		_, err := orgPolicyService.Projects.Policies.Create("projects/"+projectName, desired).Context(ctx).Do()
+		p.audit(ctx, projectName, "create-org-policy", desired.Name, err)
+		if err != nil {
+			return fmt.Errorf("error creating org policy %q: %w", desired.Name, err)
+		}
+		return nil
+	}
+
+	if policySpecMatches(existing, desired) {
+		log.Info("org policy already up to date", "project", projectName, "constraint", restrictNonCmekServicesConstraint)
+		return nil
+	}
+
+	if p.dryRun {
+		log.Info("dry-run: would update org policy", "project", projectName, "constraint", restrictNonCmekServicesConstraint, "services", desired.Spec.Rules[0].Values.DeniedValues)
+		return nil
+	}
+	log.Info("updating org policy", "project", projectName, "constraint", restrictNonCmekServicesConstraint, "services", desired.Spec.Rules[0].Values.DeniedValues)
+	desired.Etag = existing.Etag
+	_, err = orgPolicyService.Projects.Policies.Patch(desired.Name, desired).Context(ctx).Do()
+	p.audit(ctx, projectName, "update-org-policy", desired.Name, err)
+	if err != nil {
+		return fmt.Errorf("error updating org policy %q: %w", desired.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/orgpolicy/v2"
+)
+
+func TestEnsureCMEKPolicy(t *testing.T) {
+	const policyPath = "/v2/projects/abc-test-1/policies/gcp.restrictNonCmekServices"
+	existingPolicy := func(deniedValues ...string) *orgpolicy.GoogleCloudOrgpolicyV2Policy {
+		return &orgpolicy.GoogleCloudOrgpolicyV2Policy{
+			Name: "projects/abc-test-1/policies/gcp.restrictNonCmekServices",
+			Etag: "etag-1",
+			Spec: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpec{
+				Rules: []*orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRule{
+					{Values: &orgpolicy.GoogleCloudOrgpolicyV2PolicySpecPolicyRuleStringValues{DeniedValues: deniedValues}},
+				},
+			},
+		}
+	}
+
+	grid := []struct {
+		name      string
+		existing  http.HandlerFunc
+		wantWrite string
+		wantEtag  string
+	}{
+		{"missing", respondError(http.StatusNotFound, "NOT_FOUND", "policy not found"), "POST /v2/projects/abc-test-1/policies", ""},
+		{"different", respondJSON(existingPolicy("storage.googleapis.com")), "PATCH " + policyPath, "etag-1"},
+		{"up to date", respondJSON(existingPolicy("storage.googleapis.com", "bigquery.googleapis.com")), "", ""},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET "+policyPath, g.existing)
+		api.handle("POST /v2/projects/abc-test-1/policies", respondJSON(&orgpolicy.GoogleCloudOrgpolicyV2Policy{}))
+		api.handle("PATCH "+policyPath, respondJSON(&orgpolicy.GoogleCloudOrgpolicyV2Policy{}))
+		su, suClient := newFakeServiceUsage(t)
+		su.enabled["orgpolicy.googleapis.com"] = true
+
+		p := newTestProjectManager(t, &Config{CMEKRequiredServices: []string{"storage.googleapis.com", "bigquery.googleapis.com"}}, api, suClient)
+		if err := p.EnsureCMEKPolicy(context.Background(), "abc-test-1"); err != nil {
+			t.Errorf("%s: EnsureCMEKPolicy: %v", g.name, err)
+			continue
+		}
+
+		var writes []fakeRequest
+		for _, r := range api.Requests() {
+			if r.Call != "GET "+policyPath {
+				writes = append(writes, r)
+			}
+		}
+		if g.wantWrite == "" {
+			if len(writes) != 0 {
+				t.Errorf("%s: expected no writes, got %v", g.name, api.Calls())
+			}
+			continue
+		}
+		if len(writes) != 1 || writes[0].Call != g.wantWrite {
+			t.Errorf("%s: got calls %v, want one %s", g.name, api.Calls(), g.wantWrite)
+			continue
+		}
+
+		var payload orgpolicy.GoogleCloudOrgpolicyV2Policy
+		decodeBody(t, writes[0], &payload)
+		if payload.Name != "projects/abc-test-1/policies/gcp.restrictNonCmekServices" {
+			t.Errorf("%s: got policy name %q", g.name, payload.Name)
+		}
+		if payload.Etag != g.wantEtag {
+			t.Errorf("%s: got etag %q, want %q", g.name, payload.Etag, g.wantEtag)
+		}
+		if payload.Spec == nil || len(payload.Spec.Rules) != 1 || payload.Spec.Rules[0].Values == nil {
+			t.Fatalf("%s: got policy spec %+v", g.name, payload.Spec)
+		}
+		// Services in the denied list are the ones that require CMEK.
+		if got, want := payload.Spec.Rules[0].Values.DeniedValues, []string{"bigquery.googleapis.com", "storage.googleapis.com"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got denied values %v, want %v", g.name, got, want)
+		}
+		if len(payload.Spec.Rules[0].Values.AllowedValues) != 0 {
+			t.Errorf("%s: expected no allowed values, got %v", g.name, payload.Spec.Rules[0].Values.AllowedValues)
+		}
+	}
+}
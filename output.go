@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Supported values of the -output flag.
+const (
+	OutputShell = "shell"
+	OutputJSON  = "json"
+)
+
+// projectOutputData returns the details of the project that we share with other tools,
+// keyed by the environment variable names we use for them.
+func (p *ProjectManager) projectOutputData(ctx context.Context, projectName string) (map[string]string, error) {
+	project, err := p.getProject(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project %q not found", projectName)
+	}
+
+	billingService, err := p.getCloudBillingClient(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	billingInfo, err := billingService.Projects.GetBillingInfo("projects/" + projectName).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error getting billing info for project %q: %w", projectName, err)
+	}
+
+	return map[string]string{
+		"PROJECT_ID":      projectName,
+		"PROJECT_NUMBER":  strings.TrimPrefix(project.Name, "projects/"),
+		"BILLING_ACCOUNT": billingInfo.BillingAccountName,
+	}, nil
+}
+
+// WriteShellExports writes the project details as export statements, suitable for eval "$(...)".
+func (p *ProjectManager) WriteShellExports(ctx context.Context, projectName string, w io.Writer) error {
+	data, err := p.projectOutputData(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, renderShellExports(data)); err != nil {
+		return fmt.Errorf("error writing shell exports: %w", err)
+	}
+	return nil
+}
+
+// renderShellExports renders data as export statements, sorted by name.
+func renderShellExports(data map[string]string) string {
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "export %s=%s\n", k, shellQuote(data[k]))
+	}
+	return b.String()
+}
+
+// shellQuote quotes s for POSIX shells, using single quotes (which disable all expansion).
+// An embedded single quote closes the quoting, adds an escaped quote, and reopens it.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
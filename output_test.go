@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestRenderShellExports(t *testing.T) {
+	data := map[string]string{
+		"PROJECT_NUMBER":  "123456789012",
+		"PROJECT_ID":      "abc-test-1",
+		"BILLING_ACCOUNT": "billingAccounts/012345-6789AB-CDEF01",
+	}
+	want := "export BILLING_ACCOUNT='billingAccounts/012345-6789AB-CDEF01'\n" +
+		"export PROJECT_ID='abc-test-1'\n" +
+		"export PROJECT_NUMBER='123456789012'\n"
+	if got := renderShellExports(data); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	grid := []struct {
+		in   string
+		want string
+	}{
+		{"", `''`},
+		{"abc-test-1", `'abc-test-1'`},
+		{"it's", `'it'\''s'`},
+		{"$(rm -rf /) `id` $HOME", "'$(rm -rf /) `id` $HOME'"},
+		{"a\nb", "'a\nb'"},
+	}
+	for _, g := range grid {
+		if got := shellQuote(g.in); got != g.want {
+			t.Errorf("shellQuote(%q): got %q, want %q", g.in, got, g.want)
+		}
+	}
+
+	// The real test of the escaping: a shell must read the value back unchanged.
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skipf("sh not available: %v", err)
+	}
+	for _, g := range grid {
+		script := renderShellExports(map[string]string{"VALUE": g.in}) + `printf '%s' "$VALUE"`
+		out, err := exec.Command(sh, "-c", script).Output()
+		if err != nil {
+			t.Errorf("%q: error running sh: %v", g.in, err)
+			continue
+		}
+		if string(out) != g.in {
+			t.Errorf("%q: sh read back %q", g.in, out)
+		}
+	}
+}
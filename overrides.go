@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// managedProjectFields are the fields of the Project that the tool sets itself, so cannot be overridden.
+var managedProjectFields = []string{"name", "projectId", "parent", "state"}
+
+// validateProjectOverrides checks that the overrides only set fields of the Project that we do not manage.
+// Only fields known to the cloudresourcemanager client library can be sent, so other keys are rejected.
+func validateProjectOverrides(overrides map[string]any) error {
+	known := projectJSONFields()
+	for key := range overrides {
+		for _, managed := range managedProjectFields {
+			if key == managed {
+				return fmt.Errorf("projectOverrides cannot set %q, which is managed by the tool", key)
+			}
+		}
+		if !known[key] {
+			return fmt.Errorf("projectOverrides: %q is not a field of the Project known to this version of the tool", key)
+		}
+	}
+	return nil
+}
+
+// projectJSONFields returns the JSON field names of cloudresourcemanager.Project.
+func projectJSONFields() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(cloudresourcemanager.Project{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// applyProjectOverrides merges the overrides into the project as a JSON merge patch (RFC 7386):
+// objects are merged recursively, and a null value removes the field.
+func applyProjectOverrides(project *cloudresourcemanager.Project, overrides map[string]any) (*cloudresourcemanager.Project, error) {
+	if len(overrides) == 0 {
+		return project, nil
+	}
+	b, err := json.Marshal(project)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling project: %w", err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, fmt.Errorf("error unmarshaling project: %w", err)
+	}
+
+	mergePatch(body, overrides)
+
+	b, err = json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling project with overrides: %w", err)
+	}
+	merged := &cloudresourcemanager.Project{}
+	if err := json.Unmarshal(b, merged); err != nil {
+		return nil, fmt.Errorf("error applying projectOverrides: %w", err)
+	}
+	return merged, nil
+}
+
+// mergePatch applies patch to target in place, with JSON merge patch semantics.
+func mergePatch(target map[string]any, patch map[string]any) {
+	for k, v := range patch {
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+		patchObject, isObject := v.(map[string]any)
+		targetObject, targetIsObject := target[k].(map[string]any)
+		if isObject && targetIsObject {
+			mergePatch(targetObject, patchObject)
+			continue
+		}
+		target[k] = v
+	}
+}
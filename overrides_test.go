@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestMergePatch(t *testing.T) {
+	target := map[string]any{
+		"displayName": "abc-test-1",
+		"labels":      map[string]any{"env": "dev", "team": "infra"},
+		"etag":        "x",
+	}
+	patch := map[string]any{
+		"displayName": "ABC Test",
+		"labels":      map[string]any{"env": "prod", "cost-center": "42"},
+		"etag":        nil,
+		"tags":        map[string]any{"123/env": "prod"},
+	}
+	mergePatch(target, patch)
+
+	want := map[string]any{
+		"displayName": "ABC Test",
+		"labels":      map[string]any{"env": "prod", "team": "infra", "cost-center": "42"},
+		"tags":        map[string]any{"123/env": "prod"},
+	}
+	if !reflect.DeepEqual(target, want) {
+		t.Errorf("got %v, want %v", target, want)
+	}
+}
+
+func TestValidateProjectOverrides(t *testing.T) {
+	grid := []struct {
+		name      string
+		overrides map[string]any
+		wantErr   bool
+	}{
+		{"unmanaged fields", map[string]any{"displayName": "x", "tags": map[string]any{"123/env": "prod"}}, false},
+		{"project ID", map[string]any{"projectId": "other-project"}, true},
+		{"parent", map[string]any{"parent": "folders/123"}, true},
+		{"unknown field", map[string]any{"favouriteColour": "blue"}, true},
+	}
+	for _, g := range grid {
+		if err := validateProjectOverrides(g.overrides); (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+	}
+}
+
+func TestCreateProjectWithOverrides(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("POST /v3/projects", respondJSON(&cloudresourcemanager.Operation{Name: "operations/cp.123", Done: true}))
+	p := newTestProjectManager(t, &Config{
+		Parent: "folders/123",
+		Labels: map[string]string{"env": "dev", "team": "infra"},
+		ProjectOverrides: map[string]any{
+			"displayName": "ABC Test",
+			"labels":      map[string]any{"env": "prod"},
+			"tags":        map[string]any{"123/env": "prod"},
+		},
+	}, api, nil)
+
+	if err := p.createProject(context.Background(), "abc-test-1"); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+
+	requests := api.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("got requests %v, want a single create", api.Calls())
+	}
+	var body map[string]any
+	decodeBody(t, requests[0], &body)
+	want := map[string]any{
+		"projectId":   "abc-test-1",
+		"parent":      "folders/123",
+		"displayName": "ABC Test",
+		"labels":      map[string]any{"env": "prod", "team": "infra"},
+		"tags":        map[string]any{"123/env": "prod"},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("got create body %v, want %v", body, want)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"k8s.io/klog/v2"
+)
+
+// organizationDomainPrefix is the parent prefix for looking up an organization by its domain, e.g. organization:example.com
+const organizationDomainPrefix = "organization:"
+
+// effectiveParent picks the parent for new projects, in order of precedence:
+// the -parent flag, the environment variable named by parentFrom, then parent from the config.
+// GCPX_PARENT has already replaced parent (and cleared parentFrom) by the time we are called.
+// It returns the parent and a description of where it came from.
+// A parent from the config is expanded like the project name; an empty result means the project has no parent.
+func effectiveParent(flagParent string, c *Config, location *time.Location) (string, string, error) {
+	parent, source := "", ""
+	if flagParent != "" {
+		parent, source = flagParent, "-parent flag"
+	} else if v := os.Getenv(c.ParentFrom); c.ParentFrom != "" && v != "" {
+		parent, source = v, "environment variable "+c.ParentFrom
+	} else if c.Parent != "" {
+		expanded, err := expandPattern(c.Parent, location)
+		if err != nil {
+			return "", "", fmt.Errorf("error expanding parent: %w", err)
+		}
+		parent, source = expanded, "config"
+	}
+	if err := validateParent(parent); err != nil {
+		return "", "", fmt.Errorf("invalid parent from %s: %w", source, err)
+	}
+	return parent, source, nil
+}
+
+// validateParent checks that parent is empty, folders/<id>, organizations/<id> or organization:<domain>.
+func validateParent(parent string) error {
+	if parent == "" {
+		return nil
+	}
+	if domain, found := strings.CutPrefix(parent, organizationDomainPrefix); found {
+		if domain == "" || strings.Contains(domain, "/") {
+			return fmt.Errorf("parent %q must be of the form %s<domain>", parent, organizationDomainPrefix)
+		}
+		return nil
+	}
+	for _, prefix := range []string{"folders/", "organizations/"} {
+		if id, found := strings.CutPrefix(parent, prefix); found {
+			if id == "" || strings.Trim(id, "0123456789") != "" {
+				return fmt.Errorf("parent %q must have a numeric ID after %s", parent, prefix)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("parent %q must be folders/<id>, organizations/<id> or %s<domain>", parent, organizationDomainPrefix)
+}
+
+// resolveParent returns the parent for new projects.
+// A parent of the form organization:<domain> is resolved to organizations/<id>; the result is cached.
+func (p *ProjectManager) resolveParent(ctx context.Context) (string, error) {
+	parent := p.config.Parent
+	domain, isDomain := strings.CutPrefix(parent, organizationDomainPrefix)
+	if !isDomain {
+		return parent, nil
+	}
+
+	if p.resolvedParent != "" {
+		return p.resolvedParent, nil
+	}
+
+	log := klog.FromContext(ctx)
+
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	if err := crmService.Organizations.Search().Query("domain:"+domain).Pages(ctx, func(resp *cloudresourcemanager.SearchOrganizationsResponse) error {
+		for _, org := range resp.Organizations {
+			matches = append(matches, org.Name)
+		}
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("error searching for organization with domain %q: %w", domain, err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no organization found for domain %q (or the caller cannot view it)", domain)
+	case 1:
+		log.Info("resolved organization from domain", "domain", domain, "organization", matches[0])
+		p.resolvedParent = matches[0]
+		return p.resolvedParent, nil
+	default:
+		return "", fmt.Errorf("found multiple organizations for domain %q: %v; specify the parent as organizations/<id>", domain, matches)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestResolveParentFromDomain(t *testing.T) {
+	orgs := map[string][]*cloudresourcemanager.Organization{
+		"domain:example.com": {{Name: "organizations/123", DisplayName: "example.com"}},
+		"domain:shared.com":  {{Name: "organizations/456"}, {Name: "organizations/789"}},
+	}
+
+	grid := []struct {
+		parent  string
+		want    string
+		wantErr bool
+	}{
+		{"organization:example.com", "organizations/123", false},
+		{"organization:unknown.com", "", true},
+		{"organization:shared.com", "", true},
+		{"organizations/123", "organizations/123", false},
+		{"folders/456", "folders/456", false},
+	}
+	for _, g := range grid {
+		api := newFakeAPI(t)
+		api.handle("GET /v3/organizations:search", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, &cloudresourcemanager.SearchOrganizationsResponse{Organizations: orgs[r.URL.Query().Get("query")]})
+		})
+		p := newTestProjectManager(t, &Config{Parent: g.parent}, api, nil)
+
+		got, err := p.resolveParent(context.Background())
+		if (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.parent, err, g.wantErr)
+			continue
+		}
+		if got != g.want {
+			t.Errorf("%s: got %q, want %q", g.parent, got, g.want)
+		}
+
+		// The resolution is cached.
+		if _, err := p.resolveParent(context.Background()); err == nil && g.parent == "organization:example.com" {
+			if n := api.CallCount("GET /v3/organizations:search"); n != 1 {
+				t.Errorf("%s: got %d searches, want 1", g.parent, n)
+			}
+		}
+	}
+}
+
+func TestValidateParent(t *testing.T) {
+	grid := map[string]bool{
+		"":                         false,
+		"folders/123":              false,
+		"organizations/456":        false,
+		"organization:example.com": false,
+		"folders/":                 true,
+		"folders/abc":              true,
+		"organization:":            true,
+		"organization:a/b":         true,
+		"projects/123":             true,
+	}
+	for parent, wantErr := range grid {
+		if err := validateParent(parent); (err != nil) != wantErr {
+			t.Errorf("validateParent(%q): got error %v, wantErr %v", parent, err, wantErr)
+		}
+	}
+}
+
+func TestEffectiveParentPrecedence(t *testing.T) {
+	t.Setenv("TEST_PARENT", "folders/222")
+	t.Setenv("TEST_PARENT_UNSET", "")
+	t.Setenv("TEST_FOLDER", "333")
+
+	grid := []struct {
+		name       string
+		flagParent string
+		config     Config
+		want       string
+		wantSource string
+		wantErr    bool
+	}{
+		{"flag wins", "folders/111", Config{ParentFrom: "TEST_PARENT", Parent: "folders/444"}, "folders/111", "-parent flag", false},
+		{"parentFrom over config", "", Config{ParentFrom: "TEST_PARENT", Parent: "folders/444"}, "folders/222", "environment variable TEST_PARENT", false},
+		{"parentFrom unset falls through", "", Config{ParentFrom: "TEST_PARENT_UNSET", Parent: "folders/444"}, "folders/444", "config", false},
+		{"config with env expression", "", Config{Parent: "folders/${env.TEST_FOLDER}"}, "folders/333", "config", false},
+		{"nothing set", "", Config{}, "", "", false},
+		{"invalid flag", "folder/111", Config{Parent: "folders/444"}, "", "", true},
+		{"invalid parentFrom", "", Config{ParentFrom: "TEST_FOLDER"}, "", "", true},
+	}
+	for _, g := range grid {
+		got, source, err := effectiveParent(g.flagParent, &g.config, time.UTC)
+		if g.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %q", g.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", g.name, err)
+			continue
+		}
+		if got != g.want || source != g.wantSource {
+			t.Errorf("%s: got %q from %q, want %q from %q", g.name, got, source, g.want, g.wantSource)
+		}
+	}
+}
+
+func TestEffectiveParentFromGCPXParent(t *testing.T) {
+	// GCPX_PARENT overrides both config.parent and parentFrom, which are from the file, but not the flag.
+	t.Setenv("GCPX_PARENT", "folders/555")
+	t.Setenv("TEST_PARENT", "folders/222")
+
+	c := &Config{Parent: "folders/444"}
+	if err := applyEnvOverrides(c); err != nil {
+		t.Fatalf("applyEnvOverrides: %v", err)
+	}
+	if got, _, _ := effectiveParent("", c, time.UTC); got != "folders/555" {
+		t.Errorf("got %q, want GCPX_PARENT to override config.parent", got)
+	}
+
+	c = &Config{Parent: "folders/444", ParentFrom: "TEST_PARENT"}
+	if err := applyEnvOverrides(c); err != nil {
+		t.Fatalf("applyEnvOverrides: %v", err)
+	}
+	if got, _, _ := effectiveParent("", c, time.UTC); got != "folders/555" {
+		t.Errorf("got %q, want GCPX_PARENT to take precedence over parentFrom", got)
+	}
+	if got, _, _ := effectiveParent("folders/111", c, time.UTC); got != "folders/111" {
+		t.Errorf("got %q, want the flag to take precedence over everything", got)
+	}
+}
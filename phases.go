@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// PhaseCreate creates the project if it does not exist.
+	PhaseCreate = "create"
+	// PhaseBilling links the project to the billing account.
+	PhaseBilling = "billing"
+	// PhaseServices enables the configured services.
+	PhaseServices = "services"
+	// PhaseOrgPolicy applies the configured org policies to the project.
+	PhaseOrgPolicy = "orgpolicy"
+	// PhaseIAM provisions service accounts and their role bindings, and the configured IAM bindings.
+	PhaseIAM = "iam"
+	// PhaseCompute applies compute project settings and the Shared VPC attachment.
+	PhaseCompute = "compute"
+	// PhaseSetup runs the setup commands.
+	PhaseSetup = "setup"
+)
+
+// allPhases lists the valid phase names.
+var allPhases = []string{PhaseCreate, PhaseBilling, PhaseServices, PhaseOrgPolicy, PhaseIAM, PhaseCompute, PhaseSetup}
+
+// validatePhases checks that phases only contains known phase names, each at most once.
+func validatePhases(phases []string) error {
+	for i, phase := range phases {
+		if !slices.Contains(allPhases, phase) {
+			return fmt.Errorf("phase %q is not valid; must be one of %v", phase, allPhases)
+		}
+		if slices.Contains(phases[:i], phase) {
+			return fmt.Errorf("phase %q is listed more than once", phase)
+		}
+	}
+	return nil
+}
+
+// defaultTimeoutKey is the key in Timeouts for the timeout of phases that are not listed.
+const defaultTimeoutKey = "default"
+
+// validateTimeouts checks that timeouts are keyed by phase names (or default) and are positive durations.
+func validateTimeouts(timeouts map[string]string) error {
+	for key, value := range timeouts {
+		if key != defaultTimeoutKey && !slices.Contains(allPhases, key) {
+			return fmt.Errorf("timeouts: %q is not valid; must be %s or one of %v", key, defaultTimeoutKey, allPhases)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("timeouts: %s: %w", key, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeouts: %s must be positive, got %q", key, value)
+		}
+	}
+	return nil
+}
+
+// PhaseTimeout returns the configured timeout for the phase, falling back to the default timeout.
+// It returns 0 if neither is set.
+func (c *Config) PhaseTimeout(phase string) time.Duration {
+	value, found := c.Timeouts[phase]
+	if !found {
+		value, found = c.Timeouts[defaultTimeoutKey]
+	}
+	if !found {
+		return 0
+	}
+	// The value was checked by validateTimeouts.
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// EffectivePhases returns the phases to run, in order.
+// If Phases is not set, the default order is used, with setup positioned according to SetupCommandsPhase.
+func (c *Config) EffectivePhases() []string {
+	if len(c.Phases) != 0 {
+		return c.Phases
+	}
+	switch c.SetupCommandsPhase {
+	case SetupCommandsPhaseBeforeServices:
+		return []string{PhaseCreate, PhaseBilling, PhaseSetup, PhaseServices, PhaseOrgPolicy, PhaseIAM, PhaseCompute}
+	case SetupCommandsPhaseAfterServices:
+		return []string{PhaseCreate, PhaseBilling, PhaseServices, PhaseSetup, PhaseOrgPolicy, PhaseIAM, PhaseCompute}
+	default:
+		return []string{PhaseCreate, PhaseBilling, PhaseServices, PhaseOrgPolicy, PhaseIAM, PhaseCompute, PhaseSetup}
+	}
+}
+
+// SetupCommandsSkipReason returns why the configured setup commands will not run, or "" if they will (or there are none).
+func (c *Config) SetupCommandsSkipReason() string {
+	if len(c.SetupCommands) == 0 || slices.Contains(c.EffectivePhases(), PhaseSetup) {
+		return ""
+	}
+	return "the setup phase is not listed in phases"
+}
+
+// RunPhase runs a single phase of the reconciliation for the project.
+func (p *ProjectManager) RunPhase(ctx context.Context, projectName string, phase string) error {
+	log := klog.FromContext(ctx)
+	log.V(2).Info("running phase", "phase", phase, "project", projectName)
+
+	if p.dryRunProjectMissing && phase != PhaseCreate {
+		p.previewPhaseForMissingProject(ctx, projectName, phase)
+		return nil
+	}
+
+	timeout := p.config.PhaseTimeout(phase)
+	if timeout <= 0 {
+		return p.runPhase(ctx, projectName, phase)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := p.runPhase(ctx, projectName, phase)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("phase %q timed out after %v: %w", phase, timeout, err)
+	}
+	return err
+}
+
+// runPhase does the work of RunPhase.
+func (p *ProjectManager) runPhase(ctx context.Context, projectName string, phase string) error {
+	switch phase {
+	case PhaseCreate:
+		return p.EnsureProjectExists(ctx, projectName)
+
+	case PhaseBilling:
+		if skip, reason := p.skipBillingReason(); skip {
+			log := klog.FromContext(ctx)
+			log.Info("skipping billing link", "reason", reason, "project", projectName)
+			p.explainf(projectName, "%s -> skip billing", reason)
+			p.result.BillingStatus = BillingStatusSkipped
+			return nil
+		}
+		// Ensure cloudbilling.googleapis.com is enabled first so we can set up billing
+		if err := p.EnableProjectServices(ctx, projectName, []string{"cloudbilling.googleapis.com"}); err != nil {
+			return err
+		}
+		return p.LinkProjectToBillingAccount(ctx, projectName)
+
+	case PhaseServices:
+		if p.dryRunServices {
+			if err := p.PreviewProjectServices(ctx, projectName, p.config.Services); err != nil {
+				return err
+			}
+			for _, group := range p.config.ServiceGroups {
+				if err := p.PreviewProjectServices(ctx, projectName, group.Services); err != nil {
+					return err
+				}
+			}
+			if p.pruneServices {
+				return p.PruneProjectServices(ctx, projectName)
+			}
+			return nil
+		}
+		if err := p.EnableProjectServices(ctx, projectName, p.config.Services); err != nil {
+			return err
+		}
+		for _, group := range p.config.ServiceGroups {
+			if err := p.EnableServiceGroup(ctx, projectName, group); err != nil {
+				return err
+			}
+		}
+		if p.pruneServices {
+			return p.PruneProjectServices(ctx, projectName)
+		}
+		return nil
+
+	case PhaseOrgPolicy:
+		return p.EnsureCMEKPolicy(ctx, projectName)
+
+	case PhaseIAM:
+		emails, err := p.EnsureServiceAccounts(ctx, projectName)
+		if err != nil {
+			return err
+		}
+		p.result.ServiceAccounts = emails
+		return p.EnsureIAMBindings(ctx, projectName)
+
+	case PhaseCompute:
+		if err := p.EnsureComputeProjectSettings(ctx, projectName); err != nil {
+			return err
+		}
+		return p.EnsureSharedVPCAttachment(ctx, projectName)
+
+	case PhaseSetup:
+		return p.RunSetupCommands(ctx, projectName)
+
+	default:
+		return fmt.Errorf("unknown phase %q", phase)
+	}
+}
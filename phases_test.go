@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestEffectivePhasesSetupCommandsPhase(t *testing.T) {
+	grid := []struct {
+		setupCommandsPhase string
+		want               []string
+	}{
+		{"", []string{PhaseCreate, PhaseBilling, PhaseServices, PhaseOrgPolicy, PhaseIAM, PhaseCompute, PhaseSetup}},
+		{SetupCommandsPhaseAfterAll, []string{PhaseCreate, PhaseBilling, PhaseServices, PhaseOrgPolicy, PhaseIAM, PhaseCompute, PhaseSetup}},
+		{SetupCommandsPhaseAfterServices, []string{PhaseCreate, PhaseBilling, PhaseServices, PhaseSetup, PhaseOrgPolicy, PhaseIAM, PhaseCompute}},
+		{SetupCommandsPhaseBeforeServices, []string{PhaseCreate, PhaseBilling, PhaseSetup, PhaseServices, PhaseOrgPolicy, PhaseIAM, PhaseCompute}},
+	}
+	for _, g := range grid {
+		c := &Config{NamePattern: "abc-test-1", SetupCommandsPhase: g.setupCommandsPhase}
+		if err := validateConfig(c); err != nil {
+			t.Errorf("setupCommandsPhase %q: unexpected validation error: %v", g.setupCommandsPhase, err)
+		}
+		if got := c.EffectivePhases(); !reflect.DeepEqual(got, g.want) {
+			t.Errorf("setupCommandsPhase %q: got phases %v, want %v", g.setupCommandsPhase, got, g.want)
+		}
+	}
+
+	if err := validateConfig(&Config{NamePattern: "abc-test-1", SetupCommandsPhase: "before-billing"}); err == nil {
+		t.Errorf("expected an error for an unknown setupCommandsPhase")
+	}
+}
+
+func TestCustomPhaseList(t *testing.T) {
+	c := &Config{NamePattern: "abc-test-1", Phases: []string{PhaseCreate, PhaseServices, PhaseSetup, PhaseIAM}}
+	if err := validateConfig(c); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	// The listed phases run in the listed order; absent phases are skipped.
+	if got, want := c.EffectivePhases(), []string{PhaseCreate, PhaseServices, PhaseSetup, PhaseIAM}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got phases %v, want %v", got, want)
+	}
+
+	grid := []struct {
+		name   string
+		config Config
+	}{
+		{"unknown phase", Config{NamePattern: "abc-test-1", Phases: []string{PhaseCreate, "network"}}},
+		{"duplicate phase", Config{NamePattern: "abc-test-1", Phases: []string{PhaseCreate, PhaseServices, PhaseCreate}}},
+		{"with setupCommandsPhase", Config{NamePattern: "abc-test-1", Phases: []string{PhaseCreate, PhaseSetup}, SetupCommandsPhase: SetupCommandsPhaseAfterAll}},
+	}
+	for _, g := range grid {
+		if err := validateConfig(&g.config); err == nil {
+			t.Errorf("%s: expected a validation error", g.name)
+		}
+	}
+}
+
+func TestSkipBillingOverridesPhases(t *testing.T) {
+	p := NewProjectManager(&Config{BillingAccount: "billingAccounts/012345-6789AB-CDEF01", Phases: []string{PhaseCreate, PhaseBilling}})
+	if skip, _ := p.skipBillingReason(); skip {
+		t.Errorf("expected billing to run when it is listed and a billing account is configured")
+	}
+	p.skipBilling = true
+	if skip, _ := p.skipBillingReason(); !skip {
+		t.Errorf("expected -skip-billing to skip the billing phase even when it is listed")
+	}
+}
+
+func TestDryRunServicesMakesNoChanges(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["compute.googleapis.com"] = true
+	su.enabled["pubsub.googleapis.com"] = true
+
+	p := newTestProjectManager(t, &Config{
+		Services:      []string{"compute.googleapis.com", "storage.googleapis.com"},
+		ServiceGroups: []ServiceGroupConfig{{Name: "functions", Services: []string{"cloudfunctions.googleapis.com"}}},
+	}, nil, suClient)
+	p.dryRunServices = true
+	p.pruneServices = true
+
+	if err := p.RunPhase(context.Background(), "abc-test-1", PhaseServices); err != nil {
+		t.Fatalf("RunPhase: %v", err)
+	}
+	for _, method := range []string{"BatchEnableServices", "EnableService", "DisableService"} {
+		if calls := su.CallsTo(method); len(calls) != 0 {
+			t.Errorf("expected no %s calls with -dry-run-services, got %v", method, calls)
+		}
+	}
+	if !su.Enabled("pubsub.googleapis.com") {
+		t.Errorf("expected pubsub.googleapis.com to be left enabled")
+	}
+}
+
+func TestPhaseTimeoutApplied(t *testing.T) {
+	defer func(d time.Duration) { operationPollInitialDelay = d }(operationPollInitialDelay)
+	operationPollInitialDelay = time.Millisecond
+
+	grid := []struct {
+		name     string
+		timeouts map[string]string
+	}{
+		{"phase timeout", map[string]string{PhaseCreate: "100ms", PhaseServices: "10m"}},
+		{"default timeout", map[string]string{defaultTimeoutKey: "100ms", PhaseServices: "10m"}},
+	}
+	for _, g := range grid {
+		config := &Config{NamePattern: "abc-test-1", Timeouts: g.timeouts}
+		if err := validateConfig(config); err != nil {
+			t.Fatalf("%s: unexpected validation error: %v", g.name, err)
+		}
+
+		// The create operation never completes, so only the phase timeout stops the wait.
+		api := newFakeAPI(t)
+		api.handle("GET /v3/projects/abc-test-1", respondError(http.StatusNotFound, "NOT_FOUND", "project not found"))
+		api.handle("POST /v3/projects", respondJSON(&cloudresourcemanager.Operation{Name: "operations/cp.123"}))
+		p := newTestProjectManager(t, config, api, nil)
+		p.operations = &fakeOperations{}
+
+		start := time.Now()
+		err := p.RunPhase(context.Background(), "abc-test-1", PhaseCreate)
+		if err == nil || !strings.Contains(err.Error(), `phase "create" timed out after 100ms`) {
+			t.Errorf("%s: got error %v, want the create phase to time out", g.name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: took %v, want the 100ms timeout to apply", g.name, elapsed)
+		}
+	}
+}
+
+func TestPhaseTimeout(t *testing.T) {
+	c := &Config{Timeouts: map[string]string{PhaseCreate: "3m", defaultTimeoutKey: "1m"}}
+	if got, want := c.PhaseTimeout(PhaseCreate), 3*time.Minute; got != want {
+		t.Errorf("create: got %v, want %v", got, want)
+	}
+	if got, want := c.PhaseTimeout(PhaseServices), time.Minute; got != want {
+		t.Errorf("services: got %v, want the default %v", got, want)
+	}
+	if got := (&Config{}).PhaseTimeout(PhaseServices); got != 0 {
+		t.Errorf("unset: got %v, want 0", got)
+	}
+
+	for _, timeouts := range []map[string]string{
+		{PhaseCreate: "soon"},
+		{PhaseCreate: "-1m"},
+		{"network": "1m"},
+	} {
+		if err := validateConfig(&Config{NamePattern: "abc-test-1", Timeouts: timeouts}); err == nil {
+			t.Errorf("%v: expected a validation error", timeouts)
+		}
+	}
+}
+
+func TestSetupCommandsSkipReason(t *testing.T) {
+	grid := []struct {
+		name   string
+		config Config
+		want   bool
+	}{
+		{"default phases", Config{SetupCommands: []string{"true"}}, false},
+		{"setup listed", Config{SetupCommands: []string{"true"}, Phases: []string{PhaseCreate, PhaseSetup}}, false},
+		{"setup not listed", Config{SetupCommands: []string{"true"}, Phases: []string{PhaseCreate, PhaseServices}}, true},
+		{"no setup commands", Config{Phases: []string{PhaseCreate}}, false},
+	}
+	for _, g := range grid {
+		if got := g.config.SetupCommandsSkipReason() != ""; got != g.want {
+			t.Errorf("%s: got skipped %v, want %v", g.name, got, g.want)
+		}
+	}
+}
+
+func TestFailOnSkip(t *testing.T) {
+	config := &Config{
+		NamePattern:   "abc-test-1",
+		Phases:        []string{PhaseCreate, PhaseServices},
+		SetupCommands: []string{"./bootstrap.sh"},
+	}
+	o := &runOptions{location: time.UTC, failOnSkip: true, result: &Result{}}
+
+	// The run fails before any API call is made.
+	err := reconcileConfig(context.Background(), config, "", o)
+	if err == nil || !strings.Contains(err.Error(), "-fail-on-skip") {
+		t.Fatalf("got error %v, want the skipped setup commands to fail the run", err)
+	}
+	if len(o.result.Projects) != 1 || o.result.Projects[0].SetupCommandsSkipped == "" {
+		t.Errorf("expected the skip reason in the result, got %+v", o.result.Projects)
+	}
+}
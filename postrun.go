@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// RunPostRunCommands runs the config's postRunCommands once, after all projects have been reconciled.
+// runErr is the outcome of the run; if it failed, the commands are skipped unless postRunCommandsOnFailure is set.
+// The IDs of the projects that were reconciled are passed in $PROJECT_IDS, separated by spaces,
+// and $RUN_RESULT is success or failure. Each command has the same timeout as a setup command, and is audited.
+// The returned error includes runErr.
+func (p *ProjectManager) RunPostRunCommands(ctx context.Context, projectIDs []string, runErr error) error {
+	log := klog.FromContext(ctx)
+
+	if len(p.config.PostRunCommands) == 0 {
+		return runErr
+	}
+	if runErr != nil && !p.config.PostRunCommandsOnFailure {
+		log.Info("run failed, skipping post-run commands")
+		return runErr
+	}
+
+	runResult := "success"
+	if runErr != nil {
+		runResult = "failure"
+	}
+	env := append(os.Environ(), "PROJECT_IDS="+strings.Join(projectIDs, " "), "RUN_RESULT="+runResult)
+	timeout := p.setupCommandTimeoutOrDefault()
+	// The audit entries are not for a single project, so they list all of them.
+	auditProject := strings.Join(projectIDs, ",")
+
+	log.Info("running post-run commands", "projects", projectIDs, "result", runResult)
+	for _, command := range p.config.PostRunCommands {
+		log.Info("running post-run command", "command", command)
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(cmdCtx, "bash", "-c", command)
+		cmd.Env = env
+		// Stdout is reserved for -output, so the commands' output goes to stderr.
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		killProcessGroupOnCancel(cmd)
+		err := cmd.Run()
+		timedOut := errors.Is(cmdCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		p.audit(ctx, auditProject, "run-post-run-command", command, err)
+		if err != nil && timedOut {
+			return errors.Join(runErr, fmt.Errorf("post-run command %q timed out after %v and was killed: %w", command, timeout, err))
+		}
+		if err != nil {
+			return errors.Join(runErr, fmt.Errorf("error running post-run command %q: %w", command, err))
+		}
+	}
+	log.Info("post-run commands completed")
+	return runErr
+}
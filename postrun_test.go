@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunPostRunCommands(t *testing.T) {
+	runErr := errors.New("error creating project")
+
+	grid := []struct {
+		name      string
+		onFailure bool
+		runErr    error
+		want      string
+	}{
+		{"success", false, nil, "success: abc-test-1 abc-test-2\n"},
+		{"failure", false, runErr, ""},
+		{"failure with postRunCommandsOnFailure", true, runErr, "failure: abc-test-1 abc-test-2\n"},
+	}
+	for _, g := range grid {
+		outPath := filepath.Join(t.TempDir(), "out.txt")
+		config := &Config{
+			PostRunCommands:          []string{`echo "${RUN_RESULT}: ${PROJECT_IDS}" > ` + outPath},
+			PostRunCommandsOnFailure: g.onFailure,
+		}
+
+		err := NewProjectManager(config).RunPostRunCommands(context.Background(), []string{"abc-test-1", "abc-test-2"}, g.runErr)
+		if err != g.runErr {
+			t.Errorf("%s: got error %v, want the run's error %v", g.name, err, g.runErr)
+		}
+		b, err := os.ReadFile(outPath)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if got := string(b); got != g.want {
+			t.Errorf("%s: got output %q, want %q", g.name, got, g.want)
+		}
+	}
+}
+
+func TestRunPostRunCommandsFails(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "out.txt")
+	config := &Config{PostRunCommands: []string{"exit 3", "touch " + outPath}}
+
+	if err := NewProjectManager(config).RunPostRunCommands(context.Background(), []string{"abc-test-1"}, nil); err == nil {
+		t.Errorf("expected an error from the failed post-run command")
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Errorf("expected the commands after the failed one not to run")
+	}
+}
+
+func TestRunPostRunCommandsTimeout(t *testing.T) {
+	p := NewProjectManager(&Config{PostRunCommands: []string{"sleep 10"}})
+	p.setupCommandTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err := p.RunPostRunCommands(context.Background(), []string{"abc-test-1"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v, want the command killed after the timeout", elapsed)
+	}
+}
+
+func TestRunPostRunCommandsAudited(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := openAuditLog(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProjectManager(&Config{PostRunCommands: []string{"true", "exit 3"}})
+	p.auditLog = auditLog
+
+	if err := p.RunPostRunCommands(context.Background(), []string{"abc-test-1", "abc-test-2"}, nil); err == nil {
+		t.Errorf("expected an error from the failed post-run command")
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("audit line %q is not valid JSON: %v", line, err)
+		}
+		got = append(got, entry)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d audit entries, want 2: %s", len(got), b)
+	}
+	for i, want := range []struct{ Target, Outcome string }{{"true", "success"}, {"exit 3", "failure"}} {
+		if got[i].Action != "run-post-run-command" || got[i].Target != want.Target || got[i].Outcome != want.Outcome || got[i].Project != "abc-test-1,abc-test-2" {
+			t.Errorf("got audit entry %+v, want %s with outcome %s", got[i], want.Target, want.Outcome)
+		}
+	}
+}
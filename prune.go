@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
+	"k8s.io/klog/v2"
+)
+
+// wantedServices returns the services that pruning must leave enabled:
+// the configured services, their prerequisites, and the services the tool itself uses for the configured features.
+func (p *ProjectManager) wantedServices() map[string]bool {
+	wanted := map[string]bool{
+		"cloudbilling.googleapis.com":         true,
+		"cloudresourcemanager.googleapis.com": true,
+		"serviceusage.googleapis.com":         true,
+	}
+	services := slices.Clone(p.config.Services)
+	for _, group := range p.config.ServiceGroups {
+		services = append(services, group.Services...)
+	}
+	for _, serviceID := range services {
+		wanted[serviceID] = true
+		for _, prerequisite := range servicePrerequisites[serviceID] {
+			wanted[prerequisite] = true
+		}
+	}
+	if p.config.ComputeProjectSettings.IsSet() || p.config.SharedVPC.HostProject != "" {
+		wanted["compute.googleapis.com"] = true
+	}
+	if len(p.config.CMEKRequiredServices) != 0 {
+		wanted["orgpolicy.googleapis.com"] = true
+	}
+	if len(p.config.ServiceAccounts) != 0 {
+		wanted["iam.googleapis.com"] = true
+	}
+	return wanted
+}
+
+// PruneProjectServices disables the services that are enabled on the project but not wanted by the config.
+// Services that other enabled services depend on cannot be disabled; the API refuses, and we report the error
+// after trying the other services.
+func (p *ProjectManager) PruneProjectServices(ctx context.Context, projectName string) error {
+	log := klog.FromContext(ctx)
+
+	enabledServices, err := p.getEnabledServices(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	wanted := p.wantedServices()
+	var extras []string
+	for serviceID, enabled := range enabledServices {
+		if enabled && !wanted[serviceID] {
+			extras = append(extras, serviceID)
+		}
+	}
+	slices.Sort(extras)
+
+	if len(extras) == 0 {
+		log.Info("no services to prune", "project", projectName)
+		return nil
+	}
+
+	action := fmt.Sprintf("disable services %v on project %q", extras, projectName)
+	if err := p.checkProjectAge(ctx, projectName, action); err != nil {
+		return err
+	}
+	if p.dryRun || p.dryRunServices {
+		log.Info("dry-run: would disable services not in config", "services", extras, "project", projectName)
+		return nil
+	}
+	if err := p.confirmDestructive(ctx, action); err != nil {
+		return err
+	}
+
+	suClient, err := p.getServiceUsageClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if p.servicesCacheTTL > 0 {
+		p.invalidateServicesCache(ctx, projectName)
+	}
+
+	var errs []error
+	for _, serviceID := range extras {
+		log.Info("disabling service not in config", "service", serviceID, "project", projectName)
+		req := &serviceusagepb.DisableServiceRequest{
+			Name: fmt.Sprintf("projects/%s/services/%s", projectName, serviceID),
+		}
+		op, err := suClient.DisableService(ctx, req)
+		if err == nil {
+			_, err = op.Wait(ctx)
+		}
+		p.audit(ctx, projectName, "disable-service", serviceID, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error disabling service %q: %w", serviceID, err))
+			continue
+		}
+		delete(p.enabledServices, serviceID)
+	}
+	return errors.Join(errs...)
+}
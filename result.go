@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Billing link statuses reported in ProjectResult.
+const (
+	BillingStatusLinked        = "linked"
+	BillingStatusAlreadyLinked = "already-linked"
+	BillingStatusSkipped       = "skipped"
+)
+
+// Result describes the outcome of a run, for -output json.
+type Result struct {
+	// Projects are the results for each project, in the order they were reconciled.
+	Projects []*ProjectResult `json:"projects"`
+	// DryRun is true if no changes were made because of -dry-run.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Error is the error that stopped the run, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// ProjectResult describes what a run did to one project.
+type ProjectResult struct {
+	ProjectID string `json:"projectID"`
+	// ProjectNumber is the number GCP assigned to the project, if it was read.
+	ProjectNumber string `json:"projectNumber,omitempty"`
+	// Created is true if the project was created by this run, false if it already existed.
+	Created bool `json:"created"`
+	// ServicesEnabled are the services enabled by this run.
+	ServicesEnabled []string `json:"servicesEnabled,omitempty"`
+	// ServicesBlockedByOrgPolicy are the services that were skipped because org policy denies them.
+	ServicesBlockedByOrgPolicy []string `json:"servicesBlockedByOrgPolicy,omitempty"`
+	// BillingAccount is the billing account the project should be linked to.
+	BillingAccount string `json:"billingAccount,omitempty"`
+	// BillingStatus is one of linked, already-linked or skipped; empty if the billing phase did not run.
+	BillingStatus string `json:"billingStatus,omitempty"`
+	// ServiceAccounts are the emails of the configured service accounts.
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	// SetupCommands are the results of the setup commands that were run.
+	SetupCommands []SetupCommandResult `json:"setupCommands,omitempty"`
+	// SetupCommandsSkipped is the reason the configured setup commands were not run, if they were skipped.
+	SetupCommandsSkipped string `json:"setupCommandsSkipped,omitempty"`
+}
+
+// SetupCommandResult describes the outcome of a setup command.
+type SetupCommandResult struct {
+	Command         string  `json:"command"`
+	ExitCode        int     `json:"exitCode"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+	// LogPath is the file the command's output was captured to, with -setup-log-dir.
+	LogPath string `json:"logPath,omitempty"`
+}
+
+// writeResultJSON writes the result as an indented JSON document.
+func writeResultJSON(w io.Writer, result *Result) error {
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling result: %w", err)
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("error writing result: %w", err)
+	}
+	return nil
+}
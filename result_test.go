@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWriteResultJSON(t *testing.T) {
+	result := &Result{
+		Projects: []*ProjectResult{
+			{
+				ProjectID:       "abc-test-1",
+				ProjectNumber:   "123456789012",
+				Created:         true,
+				ServicesEnabled: []string{"compute.googleapis.com"},
+				BillingStatus:   BillingStatusLinked,
+				ServiceAccounts: []string{"ci@abc-test-1.iam.gserviceaccount.com"},
+				SetupCommands: []SetupCommandResult{
+					{Command: "true", ExitCode: 0, LogPath: "logs/setup-000.log"},
+				},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := writeResultJSON(&out, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out.String())
+	}
+	project := got["projects"].([]any)[0].(map[string]any)
+	for key, want := range map[string]any{
+		"projectID":       "abc-test-1",
+		"projectNumber":   "123456789012",
+		"created":         true,
+		"billingStatus":   "linked",
+		"serviceAccounts": []any{"ci@abc-test-1.iam.gserviceaccount.com"},
+	} {
+		if !reflect.DeepEqual(project[key], want) {
+			t.Errorf("%s: got %v, want %v", key, project[key], want)
+		}
+	}
+	command := project["setupCommands"].([]any)[0].(map[string]any)
+	if command["logPath"] != "logs/setup-000.log" {
+		t.Errorf("got logPath %v, want logs/setup-000.log", command["logPath"])
+	}
+	if _, found := got["error"]; found {
+		t.Errorf("error should be omitted when empty")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// retryWithBackoff calls fn until it succeeds, returns a non-retryable error, or we run out of attempts.
+// The delay between attempts doubles each time (starting at retryBaseDelay), with jitter.
+func (p *ProjectManager) retryWithBackoff(ctx context.Context, fn func() error) error {
+	return p.retryWithBackoffIf(ctx, isRetryable, fn)
+}
+
+// retryWithBackoffIf is retryWithBackoff, with retryable deciding which errors are retried.
+// It only needs the retry options, so it is also used for calls that are not made by a ProjectManager.
+func (p *projectManagerOptions) retryWithBackoffIf(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	log := klog.FromContext(ctx)
+
+	delay := p.retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !retryable(err) || attempt >= p.retryMaxAttempts {
+			return err
+		}
+
+		// Full jitter in [delay/2, delay), so that concurrent clients spread out.
+		wait := delay/2 + rand.N(delay/2+1)
+		log.Info("transient API error, retrying", "attempt", attempt, "maxAttempts", p.retryMaxAttempts, "delay", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// isRetryable returns true if err is a transient server-side error (rate limiting or unavailability).
+func isRetryable(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+			return true
+		}
+		return false
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.ResourceExhausted, codes.Internal, codes.Unavailable:
+			return true
+		}
+	}
+	return false
+}
+
+// isTransientCreateConflict returns true if err is a 409 Conflict from Projects.Create that is worth retrying.
+// A 409 is returned both when the project ID is genuinely taken (status ALREADY_EXISTS), which we must not retry,
+// and for concurrency conflicts (status ABORTED), which happen transiently when an ID is reused in quick succession.
+func isTransientCreateConflict(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusConflict {
+		return false
+	}
+	return googleapiErrorStatus(gerr) == "ABORTED"
+}
+
+// isAlreadyExists returns true if err is a 409 Conflict with status ALREADY_EXISTS.
+func isAlreadyExists(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusConflict {
+		return false
+	}
+	return googleapiErrorStatus(gerr) == "ALREADY_EXISTS"
+}
+
+// googleapiErrorStatus returns the canonical status (e.g. ABORTED) from the body of a googleapi error, if present.
+func googleapiErrorStatus(gerr *googleapi.Error) string {
+	var body struct {
+		Error struct {
+			Status string `json:"status"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(gerr.Body), &body); err != nil {
+		return ""
+	}
+	return body.Error.Status
+}
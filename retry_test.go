@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsTransientCreateConflict(t *testing.T) {
+	conflict := func(status string) error {
+		return &googleapi.Error{Code: http.StatusConflict, Body: `{"error":{"code":409,"status":"` + status + `"}}`}
+	}
+	grid := []struct {
+		name              string
+		err               error
+		wantTransient     bool
+		wantAlreadyExists bool
+	}{
+		{"aborted", conflict("ABORTED"), true, false},
+		{"already exists", conflict("ALREADY_EXISTS"), false, true},
+		{"wrapped aborted", fmt.Errorf("creating: %w", conflict("ABORTED")), true, false},
+		{"409 without a status", &googleapi.Error{Code: http.StatusConflict}, false, false},
+		{"not a conflict", &googleapi.Error{Code: http.StatusBadRequest, Body: `{"error":{"status":"ABORTED"}}`}, false, false},
+		{"not a googleapi error", errors.New("ABORTED"), false, false},
+	}
+	for _, g := range grid {
+		if got := isTransientCreateConflict(g.err); got != g.wantTransient {
+			t.Errorf("%s: isTransientCreateConflict = %v, want %v", g.name, got, g.wantTransient)
+		}
+		if got := isAlreadyExists(g.err); got != g.wantAlreadyExists {
+			t.Errorf("%s: isAlreadyExists = %v, want %v", g.name, got, g.wantAlreadyExists)
+		}
+	}
+}
+
+func TestCreateProjectRetriesTransientConflict(t *testing.T) {
+	grid := []struct {
+		name         string
+		status       string
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"transient conflict is retried", "ABORTED", false, 2},
+		{"already exists is not retried", "ALREADY_EXISTS", true, 1},
+	}
+	for _, g := range grid {
+		var attempts atomic.Int32
+		api := newFakeAPI(t)
+		api.handle("POST /v3/projects", func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				writeAPIError(w, http.StatusConflict, g.status, "conflict creating project")
+				return
+			}
+			writeJSON(w, &cloudresourcemanager.Operation{Name: "operations/cp.123", Done: true})
+		})
+		p := newTestProjectManager(t, &Config{}, api, nil)
+
+		err := p.createProject(context.Background(), "abc-test-1")
+		if (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+		if got := int(attempts.Load()); got != g.wantAttempts {
+			t.Errorf("%s: got %d create attempts, want %d", g.name, got, g.wantAttempts)
+		}
+		if g.wantErr {
+			var taken *projectIDTakenError
+			if !errors.As(err, &taken) {
+				t.Errorf("%s: expected a projectIDTakenError, got %v", g.name, err)
+			}
+		} else if !p.result.Created {
+			t.Errorf("%s: expected the project to be recorded as created", g.name)
+		}
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	grid := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{"429", &googleapi.Error{Code: http.StatusTooManyRequests}, 3},
+		{"500", &googleapi.Error{Code: http.StatusInternalServerError}, 3},
+		{"502", &googleapi.Error{Code: http.StatusBadGateway}, 3},
+		{"503", &googleapi.Error{Code: http.StatusServiceUnavailable}, 3},
+		{"grpc unavailable", status.Error(codes.Unavailable, "unavailable"), 3},
+		{"grpc resource exhausted", status.Error(codes.ResourceExhausted, "quota"), 3},
+		{"403", &googleapi.Error{Code: http.StatusForbidden}, 1},
+		{"404", &googleapi.Error{Code: http.StatusNotFound}, 1},
+		{"grpc permission denied", status.Error(codes.PermissionDenied, "denied"), 1},
+		{"other error", errors.New("boom"), 1},
+	}
+	for _, g := range grid {
+		p := newTestProjectManager(t, &Config{}, nil, nil)
+		attempts := 0
+		err := p.retryWithBackoff(context.Background(), func() error {
+			attempts++
+			return g.err
+		})
+		if err != g.err {
+			t.Errorf("%s: got error %v, want the last error %v", g.name, err, g.err)
+		}
+		if attempts != g.wantAttempts {
+			t.Errorf("%s: got %d attempts, want %d", g.name, attempts, g.wantAttempts)
+		}
+	}
+}
+
+func TestRetryWithBackoffSucceeds(t *testing.T) {
+	p := newTestProjectManager(t, &Config{}, nil, nil)
+	attempts := 0
+	err := p.retryWithBackoff(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return &googleapi.Error{Code: http.StatusServiceUnavailable}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("got error %v after %d attempts, want success on the third", err, attempts)
+	}
+}
+
+func TestCreateProjectAlreadyExistsAfterRetry(t *testing.T) {
+	grid := []struct {
+		name     string
+		existing *cloudresourcemanager.Project
+		wantErr  bool
+	}{
+		{
+			// The first attempt created the project before failing, so the retry finds it.
+			name:     "created by the earlier attempt",
+			existing: &cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1", Parent: "folders/123", Labels: map[string]string{"team": "infra"}},
+			wantErr:  false,
+		},
+		{
+			name:     "owned by someone else",
+			existing: &cloudresourcemanager.Project{Name: "projects/999999999999", ProjectId: "abc-test-1", Parent: "folders/999"},
+			wantErr:  true,
+		},
+	}
+	for _, g := range grid {
+		var attempts atomic.Int32
+		api := newFakeAPI(t)
+		api.handle("POST /v3/projects", func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				writeAPIError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "backend unavailable")
+				return
+			}
+			writeAPIError(w, http.StatusConflict, "ALREADY_EXISTS", "project already exists")
+		})
+		api.handle("GET /v3/projects/abc-test-1", respondJSON(g.existing))
+		p := newTestProjectManager(t, &Config{Parent: "folders/123", Labels: map[string]string{"team": "infra"}}, api, nil)
+
+		err := p.createProject(context.Background(), "abc-test-1")
+		if (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+		if p.result.Created == g.wantErr {
+			t.Errorf("%s: got created %v, want %v", g.name, p.result.Created, !g.wantErr)
+		}
+	}
+}
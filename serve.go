@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// maxProvisionRequestBytes limits the size of the config accepted by POST /provision.
+const maxProvisionRequestBytes = 1 << 20
+
+// serveOptions are the settings for -serve.
+type serveOptions struct {
+	// addr is the address to listen on, e.g. :8080.
+	addr string
+	// token is the shared token that clients must send as "Authorization: Bearer <token>".
+	token string
+	// maxConcurrent is the number of provision requests we run at once; further requests are rejected.
+	maxConcurrent int
+	// requestTimeout bounds how long a provision request may run.
+	requestTimeout time.Duration
+	// allowSetupCommands accepts configs with setup commands, which run as the server's user.
+	allowSetupCommands bool
+}
+
+// readServeToken reads the shared token from path, ignoring surrounding whitespace.
+func readServeToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading token file %q: %w", path, err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file %q is empty", path)
+	}
+	return token, nil
+}
+
+// serve runs an HTTP server exposing POST /provision until ctx is cancelled or we are signalled to stop.
+// On stopping, requests in progress are given up to the request timeout to finish.
+func serve(ctx context.Context, so serveOptions, o *runOptions) error {
+	log := klog.FromContext(ctx)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /provision", &provisionHandler{
+		serveOptions: so,
+		runOptions:   o,
+		slots:        make(chan struct{}, so.maxConcurrent),
+	})
+
+	server := &http.Server{
+		Addr:              so.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Info("serving", "addr", so.addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("error serving on %q: %w", so.addr, err)
+	case <-ctx.Done():
+	}
+
+	log.Info("shutting down, waiting for requests in progress")
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), so.requestTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down server: %w", err)
+	}
+	return nil
+}
+
+// provisionHandler handles POST /provision: the body is a config (JSON, or YAML), which is reconciled
+// as if it were passed with -config. The response is the JSON result, as for -output json.
+type provisionHandler struct {
+	serveOptions
+	runOptions *runOptions
+
+	// slots holds a value for each request in progress.
+	slots chan struct{}
+}
+
+func (h *provisionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := klog.FromContext(r.Context()).WithValues("remote", r.RemoteAddr)
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		log.Info("rejecting unauthorized provision request")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+		defer func() { <-h.slots }()
+	default:
+		http.Error(w, "too many provision requests in progress", http.StatusTooManyRequests)
+		return
+	}
+
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProvisionRequestBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing config: %v", err), http.StatusBadRequest)
+		return
+	}
+	if h.runOptions.envName != "" {
+		if err := applyEnvironment(config, h.runOptions.envName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// We deliberately do not apply the GCPX_* overrides: the server's environment should not change requests.
+	if err := checkRequestConfig(config, h.allowSetupCommands); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := validateConfig(config); err != nil {
+		http.Error(w, fmt.Sprintf("invalid config: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// The pipeline is idempotent, but we don't want a client disconnecting to abandon it halfway.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), h.requestTimeout)
+	defer cancel()
+	ctx = klog.NewContext(ctx, log)
+
+	o := *h.runOptions
+	o.result = &Result{Projects: []*ProjectResult{}, DryRun: o.projectManager.dryRun}
+	log.Info("provisioning")
+	status := http.StatusOK
+	if err := reconcileConfig(ctx, config, "", &o); err != nil {
+		log.Error(err, "provisioning failed")
+		o.result.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := writeResultJSON(w, o.result); err != nil {
+		log.Error(err, "error writing response")
+	}
+}
+
+// checkRequestConfig rejects the parts of a config posted to /provision that would let a client reach
+// beyond the GCP project: reading the server's environment (${env.*}, parentFrom), reading or writing
+// files on the server (tls, serviceAccounts[].keyFile), or running commands (setupCommands and postRunCommands, unless allowed).
+func checkRequestConfig(config *Config, allowSetupCommands bool) error {
+	// Checking the serialized config catches ${env.*} in every field, including createWhen.
+	b, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error marshaling config: %w", err)
+	}
+	if strings.Contains(string(b), "${env.") {
+		return fmt.Errorf("${env.*} expressions are not allowed in configs posted to /provision")
+	}
+
+	if config.ParentFrom != "" {
+		return fmt.Errorf("parentFrom is not allowed in configs posted to /provision")
+	}
+	if config.TLS.IsSet() {
+		return fmt.Errorf("tls is not allowed in configs posted to /provision")
+	}
+	if (len(config.PostRunCommands) != 0 || config.PostRunCommandsOnFailure) && !allowSetupCommands {
+		return fmt.Errorf("postRunCommands are not allowed (see -serve-allow-setup-commands)")
+	}
+	for _, projectConfig := range config.ProjectConfigs() {
+		for _, sa := range projectConfig.ServiceAccounts {
+			if sa.KeyFile != "" {
+				return fmt.Errorf("serviceAccounts[].keyFile is not allowed in configs posted to /provision")
+			}
+		}
+		if len(projectConfig.SetupCommands) != 0 && !allowSetupCommands {
+			return fmt.Errorf("setupCommands are not allowed (see -serve-allow-setup-commands)")
+		}
+	}
+	return nil
+}
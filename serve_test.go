@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProvisionHandler() *provisionHandler {
+	return &provisionHandler{
+		serveOptions: serveOptions{
+			token:          "secret",
+			maxConcurrent:  1,
+			requestTimeout: time.Minute,
+		},
+		runOptions: &runOptions{location: time.UTC},
+		slots:      make(chan struct{}, 1),
+	}
+}
+
+func postProvision(t *testing.T, h http.Handler, token string, body string) *http.Response {
+	t.Helper()
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/provision", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("error calling provision: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestProvisionRejectsBadToken(t *testing.T) {
+	h := newTestProvisionHandler()
+	for _, token := range []string{"", "wrong"} {
+		resp := postProvision(t, h, token, `{"namePattern": "abc-test-1"}`)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: got status %v, want %v", token, resp.Status, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestProvisionConcurrencyLimit(t *testing.T) {
+	h := newTestProvisionHandler()
+	h.slots <- struct{}{}
+
+	resp := postProvision(t, h, "secret", `{"namePattern": "abc-test-1"}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %v, want %v", resp.Status, http.StatusTooManyRequests)
+	}
+}
+
+func TestProvisionRejectsUnsafeConfigs(t *testing.T) {
+	grid := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"env in namePattern", `{"namePattern": "abc-${env.USER}"}`, http.StatusForbidden},
+		{"env in labels", `{"namePattern": "abc-test-1", "labels": {"owner": "${env.USER}"}}`, http.StatusForbidden},
+		{"env in createWhen", `{"namePattern": "abc-test-1", "createWhen": "${env.SECRET} == guess"}`, http.StatusForbidden},
+		{"parentFrom", `{"namePattern": "abc-test-1", "parentFrom": "PARENT"}`, http.StatusForbidden},
+		{"tls", `{"namePattern": "abc-test-1", "tls": {"caFile": "/etc/passwd"}}`, http.StatusForbidden},
+		{"keyFile", `{"namePattern": "abc-test-1", "serviceAccounts": [{"accountID": "ci", "keyFile": "/tmp/key.json"}]}`, http.StatusForbidden},
+		{"setupCommands", `{"namePattern": "abc-test-1", "setupCommands": ["id"]}`, http.StatusForbidden},
+		{"postRunCommands", `{"namePattern": "abc-test-1", "postRunCommands": ["id"]}`, http.StatusForbidden},
+		{"postRunCommandsOnFailure", `{"namePattern": "abc-test-1", "postRunCommandsOnFailure": true}`, http.StatusForbidden},
+		{"not a config", `[1, 2, 3]`, http.StatusBadRequest},
+		{"invalid config", `{"namePattern": "abc-test-1", "billingLinkPolicy": "sometimes"}`, http.StatusBadRequest},
+	}
+
+	for _, g := range grid {
+		t.Run(g.name, func(t *testing.T) {
+			resp := postProvision(t, newTestProvisionHandler(), "secret", g.body)
+			if resp.StatusCode != g.wantStatus {
+				t.Errorf("got status %v, want %v", resp.Status, g.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProvisionIgnoresEnvOverrides(t *testing.T) {
+	t.Setenv("GCPX_NAME_PATTERN", "abc-from-server-env")
+
+	// The project ID is invalid, so the run fails before any API call, but the result names the ID that was used.
+	resp := postProvision(t, newTestProvisionHandler(), "secret", `{"namePattern": "x"}`)
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got status %v, want %v", resp.Status, http.StatusInternalServerError)
+	}
+	var result Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding result: %v", err)
+	}
+	if !strings.Contains(result.Error, `"x"`) {
+		t.Errorf("expected the error to name the project ID from the request, got %q", result.Error)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/iam/v1"
+	"k8s.io/klog/v2"
+)
+
+// ServiceAccountConfig describes a service account to create in the project.
+// ${PROJECT_ID} is substituted in all fields.
+type ServiceAccountConfig struct {
+	AccountID   string   `yaml:"accountID" json:"accountID"`
+	DisplayName string   `yaml:"displayName" json:"displayName"`
+	Roles       []string `yaml:"roles" json:"roles"`
+
+	// KeyFile, if set, is a path where a JSON key for the service account is written.
+	// Prefer Workload Identity where possible; keys are long-lived credentials.
+	KeyFile string `yaml:"keyFile" json:"keyFile"`
+}
+
+func (p *ProjectManager) getIAMClient(ctx context.Context) (*iam.Service, error) {
+	if p.iamService != nil {
+		return p.iamService, nil
+	}
+	opts, err := p.clientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	iamService, err := iam.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating iam client: %w", err)
+	}
+	p.iamService = iamService
+	return iamService, nil
+}
+
+// EnsureServiceAccounts creates the configured service accounts if they do not exist,
+// and grants them their roles on the project. It returns the emails of the service accounts.
+func (p *ProjectManager) EnsureServiceAccounts(ctx context.Context, projectName string) ([]string, error) {
+	log := klog.FromContext(ctx)
+
+	if len(p.config.ServiceAccounts) == 0 {
+		return nil, nil
+	}
+
+	if err := p.EnableProjectServices(ctx, projectName, []string{"iam.googleapis.com"}); err != nil {
+		return nil, err
+	}
+
+	if p.dryRunServiceNotEnabled(ctx, projectName, "iam.googleapis.com", "create service accounts") {
+		return nil, nil
+	}
+
+	iamService, err := p.getIAMClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var emails []string
+	roleMembers := make(map[iamRoleKey][]string)
+	for _, sa := range p.config.ServiceAccounts {
+		accountID := strings.ReplaceAll(sa.AccountID, "${PROJECT_ID}", projectName)
+		displayName := strings.ReplaceAll(sa.DisplayName, "${PROJECT_ID}", projectName)
+		email := accountID + "@" + projectName + ".iam.gserviceaccount.com"
+
+		_, err := iamService.Projects.ServiceAccounts.Get("projects/" + projectName + "/serviceAccounts/" + email).Context(ctx).Do()
+		if err == nil {
+			log.Info("service account already exists", "project", projectName, "email", email)
+		} else if isNotFound(err) && p.dryRun {
+			log.Info("dry-run: would create service account", "project", projectName, "email", email)
+		} else if isNotFound(err) {
+			log.Info("creating service account", "project", projectName, "email", email)
+			req := &iam.CreateServiceAccountRequest{
+				AccountId: accountID,
+				ServiceAccount: &iam.ServiceAccount{
+					DisplayName: displayName,
+				},
+			}
+			_, err := iamService.Projects.ServiceAccounts.Create("projects/"+projectName, req).Context(ctx).Do()
+			p.audit(ctx, projectName, "create-service-account", email, err)
+			if err != nil {
+				return nil, fmt.Errorf("error creating service account %q: %w", email, err)
+			}
+			log.Info("service account created", "project", projectName, "email", email)
+		} else {
+			return nil, fmt.Errorf("error getting service account %q: %w", email, err)
+		}
+
+		if sa.KeyFile != "" {
+			keyFile := strings.ReplaceAll(sa.KeyFile, "${PROJECT_ID}", projectName)
+			if err := p.ensureServiceAccountKey(ctx, projectName, email, keyFile); err != nil {
+				return nil, err
+			}
+		}
+
+		emails = append(emails, email)
+		for _, role := range sa.Roles {
+			role = strings.ReplaceAll(role, "${PROJECT_ID}", projectName)
+			key := iamRoleKey{role: role}
+			roleMembers[key] = append(roleMembers[key], "serviceAccount:"+email)
+		}
+	}
+
+	if len(roleMembers) != 0 {
+		if err := p.ensureProjectRoleMembers(ctx, projectName, roleMembers); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("service accounts ready", "project", projectName, "emails", emails)
+	return emails, nil
+}
+
+// ensureServiceAccountKey writes a JSON key for the service account to keyFile,
+// unless keyFile already holds a key for the service account that still exists.
+func (p *ProjectManager) ensureServiceAccountKey(ctx context.Context, projectName string, email string, keyFile string) error {
+	log := klog.FromContext(ctx)
+
+	iamService, err := p.getIAMClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	valid, err := p.isValidServiceAccountKeyFile(ctx, projectName, email, keyFile)
+	if err != nil {
+		return err
+	}
+	if valid {
+		log.Info("service account key file already exists", "email", email, "keyFile", keyFile)
+		return nil
+	}
+
+	if p.dryRun {
+		log.Info("dry-run: would create service account key", "email", email, "keyFile", keyFile)
+		return nil
+	}
+
+	log.Info("WARNING: creating a long-lived service account key; store it securely, rotate it regularly and prefer Workload Identity where possible", "email", email, "keyFile", keyFile)
+	key, err := iamService.Projects.ServiceAccounts.Keys.Create("projects/"+projectName+"/serviceAccounts/"+email, &iam.CreateServiceAccountKeyRequest{}).Context(ctx).Do()
+	p.audit(ctx, projectName, "create-service-account-key", email, err)
+	if err != nil {
+		return fmt.Errorf("error creating key for service account %q: %w", email, err)
+	}
+	keyData, err := base64.StdEncoding.DecodeString(key.PrivateKeyData)
+	if err != nil {
+		return fmt.Errorf("error decoding key for service account %q: %w", email, err)
+	}
+
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating key file %q: %w", keyFile, err)
+	}
+	// OpenFile does not change the permissions of an existing file.
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return fmt.Errorf("error setting permissions on key file %q: %w", keyFile, err)
+	}
+	if _, err := f.Write(keyData); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing key file %q: %w", keyFile, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing key file %q: %w", keyFile, err)
+	}
+	log.Info("wrote service account key", "email", email, "keyFile", keyFile)
+	return nil
+}
+
+// isValidServiceAccountKeyFile returns true if keyFile holds a key for the service account, and that key has not been deleted.
+func (p *ProjectManager) isValidServiceAccountKeyFile(ctx context.Context, projectName string, email string, keyFile string) (bool, error) {
+	log := klog.FromContext(ctx)
+
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error reading key file %q: %w", keyFile, err)
+	}
+
+	var existing struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKeyID string `json:"private_key_id"`
+	}
+	if err := json.Unmarshal(b, &existing); err != nil {
+		log.Info("existing key file is not valid json, will replace", "keyFile", keyFile, "error", err)
+		return false, nil
+	}
+	if existing.Type != "service_account" || existing.ClientEmail != email || existing.PrivateKeyID == "" {
+		log.Info("existing key file is not a key for the service account, will replace", "keyFile", keyFile, "email", email)
+		return false, nil
+	}
+
+	iamService, err := p.getIAMClient(ctx)
+	if err != nil {
+		return false, err
+	}
+	if _, err := iamService.Projects.ServiceAccounts.Keys.Get("projects/" + projectName + "/serviceAccounts/" + email + "/keys/" + existing.PrivateKeyID).Context(ctx).Do(); err != nil {
+		if isNotFound(err) {
+			log.Info("existing key file refers to a deleted key, will replace", "keyFile", keyFile, "keyID", existing.PrivateKeyID)
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting key %q for service account %q: %w", existing.PrivateKeyID, email, err)
+	}
+	return true, nil
+}
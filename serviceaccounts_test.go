@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/iam/v1"
+)
+
+// handleServiceAccounts serves the service accounts of the project from a fakeAPI, starting with the existing emails.
+// It returns a func listing the account IDs created.
+func handleServiceAccounts(t *testing.T, api *fakeAPI, projectName string, existing ...string) func() []string {
+	var created []string
+	api.handle("GET /v1/projects/"+projectName+"/serviceAccounts/{email}", func(w http.ResponseWriter, r *http.Request) {
+		email := r.PathValue("email")
+		if !slices.Contains(existing, email) {
+			writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "service account not found")
+			return
+		}
+		writeJSON(w, &iam.ServiceAccount{Email: email})
+	})
+	api.handle("POST /v1/projects/"+projectName+"/serviceAccounts", func(w http.ResponseWriter, r *http.Request) {
+		var req iam.CreateServiceAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding create service account request: %v", err)
+		}
+		created = append(created, req.AccountId)
+		email := req.AccountId + "@" + projectName + ".iam.gserviceaccount.com"
+		existing = append(existing, email)
+		writeJSON(w, &iam.ServiceAccount{Email: email, DisplayName: req.ServiceAccount.DisplayName})
+	})
+	return func() []string { return created }
+}
+
+func TestEnsureServiceAccounts(t *testing.T) {
+	api := newFakeAPI(t)
+	created := handleServiceAccounts(t, api, "abc-test-1", "existing@abc-test-1.iam.gserviceaccount.com")
+	policy := api.handleIAMPolicy("abc-test-1", &cloudresourcemanager.Policy{
+		Bindings: []*cloudresourcemanager.Binding{{Role: "roles/viewer", Members: []string{"user:admin@example.com"}}},
+	})
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["iam.googleapis.com"] = true
+
+	p := newTestProjectManager(t, &Config{ServiceAccounts: []ServiceAccountConfig{
+		{AccountID: "existing", Roles: []string{"roles/viewer"}},
+		{AccountID: "deployer", DisplayName: "Deployer for ${PROJECT_ID}", Roles: []string{"roles/viewer", "roles/storage.admin"}},
+	}}, api, suClient)
+
+	emails, err := p.EnsureServiceAccounts(context.Background(), "abc-test-1")
+	if err != nil {
+		t.Fatalf("EnsureServiceAccounts: %v", err)
+	}
+
+	wantEmails := []string{"existing@abc-test-1.iam.gserviceaccount.com", "deployer@abc-test-1.iam.gserviceaccount.com"}
+	if !reflect.DeepEqual(emails, wantEmails) {
+		t.Errorf("got emails %v, want %v", emails, wantEmails)
+	}
+	if got := created(); !reflect.DeepEqual(got, []string{"deployer"}) {
+		t.Errorf("got created service accounts %v, want only the missing one", got)
+	}
+
+	wantViewers := []string{"user:admin@example.com", "serviceAccount:existing@abc-test-1.iam.gserviceaccount.com", "serviceAccount:deployer@abc-test-1.iam.gserviceaccount.com"}
+	if got := policy.Members("roles/viewer"); !reflect.DeepEqual(got, wantViewers) {
+		t.Errorf("got roles/viewer members %v, want %v", got, wantViewers)
+	}
+	if got := policy.Members("roles/storage.admin"); !reflect.DeepEqual(got, []string{"serviceAccount:deployer@abc-test-1.iam.gserviceaccount.com"}) {
+		t.Errorf("got roles/storage.admin members %v", got)
+	}
+
+	// A second run finds everything in place and writes nothing.
+	if _, err := p.EnsureServiceAccounts(context.Background(), "abc-test-1"); err != nil {
+		t.Fatalf("EnsureServiceAccounts (second run): %v", err)
+	}
+	if len(created()) != 1 || policy.writes != 1 {
+		t.Errorf("expected the second run to make no changes, got created %v and %d policy writes", created(), policy.writes)
+	}
+}
+
+func TestEnsureServiceAccountKey(t *testing.T) {
+	const email = "deployer@abc-test-1.iam.gserviceaccount.com"
+	keyJSON := `{"type":"service_account","client_email":"` + email + `","private_key_id":"key-1"}`
+
+	api := newFakeAPI(t)
+	api.handle("POST /v1/projects/abc-test-1/serviceAccounts/"+email+"/keys", respondJSON(&iam.ServiceAccountKey{
+		Name:           "projects/abc-test-1/serviceAccounts/" + email + "/keys/key-1",
+		PrivateKeyData: base64.StdEncoding.EncodeToString([]byte(keyJSON)),
+	}))
+	api.handle("GET /v1/projects/abc-test-1/serviceAccounts/"+email+"/keys/key-1", respondJSON(&iam.ServiceAccountKey{
+		Name: "projects/abc-test-1/serviceAccounts/" + email + "/keys/key-1",
+	}))
+	p := newTestProjectManager(t, &Config{}, api, nil)
+
+	// An existing file that is not a key is replaced, and its permissions are tightened.
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ensureServiceAccountKey(context.Background(), "abc-test-1", email, keyFile); err != nil {
+		t.Fatalf("ensureServiceAccountKey: %v", err)
+	}
+
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != keyJSON {
+		t.Errorf("got key file %q, want %q", b, keyJSON)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("got key file mode %v, want 0600", mode)
+	}
+
+	// The key file is now valid, so a second run does not create another key.
+	if err := p.ensureServiceAccountKey(context.Background(), "abc-test-1", email, keyFile); err != nil {
+		t.Fatalf("ensureServiceAccountKey (second run): %v", err)
+	}
+	if n := api.CallCount("POST /v1/projects/abc-test-1/serviceAccounts/" + email + "/keys"); n != 1 {
+		t.Errorf("got %d key creations, want 1", n)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
+	"k8s.io/klog/v2"
+)
+
+// ServiceGroupConfig is a set of services that must be enabled together:
+// if enabling one of them fails, we disable the ones we enabled, so the group is all-or-nothing.
+type ServiceGroupConfig struct {
+	// Name identifies the group in logs and errors.
+	Name string `yaml:"name" json:"name"`
+	// Services are the services in the group, enabled in order.
+	Services []string `yaml:"services" json:"services"`
+}
+
+// Validate checks the group for values we know to be invalid.
+func (c *ServiceGroupConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("serviceGroups: name must be set")
+	}
+	if len(c.Services) == 0 {
+		return fmt.Errorf("serviceGroups[%s]: services must be set", c.Name)
+	}
+	return nil
+}
+
+// EnableServiceGroup enables the services in the group, one at a time.
+// If a service fails to enable, or is blocked by org policy (even with skipServicesBlockedByOrgPolicy),
+// the services that we enabled for the group, including their prerequisites, are disabled again (best-effort),
+// and the error is returned.
+func (p *ProjectManager) EnableServiceGroup(ctx context.Context, projectName string, group ServiceGroupConfig) error {
+	log := klog.FromContext(ctx)
+
+	enabledServices, err := p.getEnabledServices(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	missing := p.missingServices(ctx, projectName, enabledServices, group.Services)
+	if len(missing) == 0 {
+		log.Info("all services in group already enabled", "group", group.Name, "project", projectName)
+		return nil
+	}
+	if p.dryRun {
+		log.Info("dry-run: would enable service group", "group", group.Name, "services", missing, "project", projectName)
+		return nil
+	}
+
+	log.Info("enabling service group", "group", group.Name, "services", missing, "project", projectName)
+	// The services we enable are appended to the result in order, prerequisites first, so the ones after
+	// enabledBefore are those to roll back.
+	enabledBefore := len(p.result.ServicesEnabled)
+	for _, serviceID := range missing {
+		err := p.enableSingleService(ctx, projectName, serviceID)
+		if err == nil && !p.enabledServices[serviceID] {
+			// The service was skipped as blocked by org policy, but the group cannot be partially enabled.
+			err = fmt.Errorf("service is blocked by org policy (%s)", serviceUsageConstraint)
+		}
+		if err != nil {
+			p.rollbackServiceGroup(ctx, projectName, group, slices.Clone(p.result.ServicesEnabled[enabledBefore:]))
+			return fmt.Errorf("error enabling service %q of group %q (rolled back): %w", serviceID, group.Name, err)
+		}
+	}
+	log.Info("service group enabled", "group", group.Name, "project", projectName)
+	return nil
+}
+
+// rollbackServiceGroup disables the services we enabled for a group, in reverse order.
+// Failures are logged rather than returned, as we are already handling an error.
+func (p *ProjectManager) rollbackServiceGroup(ctx context.Context, projectName string, group ServiceGroupConfig, enabled []string) {
+	log := klog.FromContext(ctx)
+
+	if len(enabled) == 0 {
+		return
+	}
+
+	suClient, err := p.getServiceUsageClient(ctx)
+	if err != nil {
+		log.Error(err, "cannot roll back service group", "group", group.Name, "services", enabled, "project", projectName)
+		return
+	}
+
+	if p.servicesCacheTTL > 0 {
+		p.invalidateServicesCache(ctx, projectName)
+	}
+
+	for _, serviceID := range slices.Backward(enabled) {
+		log.Info("rolling back: disabling service", "group", group.Name, "service", serviceID, "project", projectName)
+		req := &serviceusagepb.DisableServiceRequest{
+			Name: fmt.Sprintf("projects/%s/services/%s", projectName, serviceID),
+		}
+		op, err := suClient.DisableService(ctx, req)
+		if err == nil {
+			_, err = op.Wait(ctx)
+		}
+		p.audit(ctx, projectName, "disable-service", serviceID, err)
+		if err != nil {
+			log.Error(err, "error disabling service during rollback", "group", group.Name, "service", serviceID, "project", projectName)
+			continue
+		}
+		delete(p.enabledServices, serviceID)
+	}
+}
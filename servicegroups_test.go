@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEnableServiceGroupRollsBack(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	su.enableErr = func(services []string) error {
+		if slices.Contains(services, "storage.googleapis.com") {
+			return status.Error(codes.FailedPrecondition, "storage.googleapis.com cannot be enabled")
+		}
+		return nil
+	}
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+
+	group := ServiceGroupConfig{Name: "data", Services: []string{"pubsub.googleapis.com", "storage.googleapis.com", "bigquery.googleapis.com"}}
+	if err := p.EnableServiceGroup(context.Background(), "abc-test-1", group); err == nil {
+		t.Fatalf("expected an error when a service in the group fails to enable")
+	}
+
+	// The first service was enabled, then disabled again when the second failed; the third was never tried.
+	want := []string{
+		"BatchEnableServices pubsub.googleapis.com",
+		"BatchEnableServices storage.googleapis.com",
+		"DisableService pubsub.googleapis.com",
+	}
+	var got []string
+	for _, call := range su.Calls() {
+		if call != "ListServices" {
+			got = append(got, call)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+	if su.Enabled("pubsub.googleapis.com") {
+		t.Errorf("expected pubsub.googleapis.com to be rolled back")
+	}
+}
+
+func TestEnableServiceGroupAllEnabled(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+
+	group := ServiceGroupConfig{Name: "data", Services: []string{"pubsub.googleapis.com", "storage.googleapis.com"}}
+	if err := p.EnableServiceGroup(context.Background(), "abc-test-1", group); err != nil {
+		t.Fatalf("EnableServiceGroup: %v", err)
+	}
+	for _, service := range group.Services {
+		if !su.Enabled(service) {
+			t.Errorf("expected %s to be enabled", service)
+		}
+	}
+	if calls := su.CallsTo("DisableService"); len(calls) != 0 {
+		t.Errorf("expected no rollback, got %v", calls)
+	}
+}
+
+func TestEnableServiceGroupTimesOutSlowService(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	su.enableErr = slowService(t, "cloudscheduler.googleapis.com")
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+	p.serviceEnableTimeout = 100 * time.Millisecond
+
+	group := ServiceGroupConfig{Name: "pubsub-with-scheduler", Services: []string{"pubsub.googleapis.com", "cloudscheduler.googleapis.com"}}
+	err := p.EnableServiceGroup(context.Background(), "abc-test-1", group)
+	if err == nil || !strings.Contains(err.Error(), `timed out after 100ms enabling service "cloudscheduler.googleapis.com"`) {
+		t.Fatalf("got error %v, want the slow service reported", err)
+	}
+	// The group is rolled back.
+	if su.Enabled("pubsub.googleapis.com") {
+		t.Errorf("expected pubsub.googleapis.com to be rolled back")
+	}
+}
+
+func TestEnableServiceGroupBlockedMemberFailsGroup(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	su.enableErr = func(services []string) error {
+		if slices.Contains(services, "bigquery.googleapis.com") {
+			return status.Error(codes.FailedPrecondition, "Constraint constraints/serviceuser.services violated for projects/abc-test-1 attempting to enable service bigquery.googleapis.com")
+		}
+		return nil
+	}
+	p := newTestProjectManager(t, &Config{SkipServicesBlockedByOrgPolicy: true}, nil, suClient)
+
+	group := ServiceGroupConfig{Name: "analytics", Services: []string{"pubsub.googleapis.com", "bigquery.googleapis.com", "storage.googleapis.com"}}
+	err := p.EnableServiceGroup(context.Background(), "abc-test-1", group)
+	if err == nil || !strings.Contains(err.Error(), "blocked by org policy") {
+		t.Fatalf("got error %v, want the blocked service to fail the group", err)
+	}
+	if su.Enabled("pubsub.googleapis.com") {
+		t.Errorf("expected pubsub.googleapis.com to be rolled back")
+	}
+	if len(su.CallsTo("BatchEnableServices")) != 2 {
+		t.Errorf("expected the services after the blocked one not to be tried, got %v", su.CallsTo("BatchEnableServices"))
+	}
+}
+
+func TestEnableServiceGroupRollsBackPrerequisites(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	su.enableErr = func(services []string) error {
+		if slices.Contains(services, "storage.googleapis.com") {
+			return status.Error(codes.FailedPrecondition, "storage.googleapis.com cannot be enabled")
+		}
+		return nil
+	}
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+
+	// container.googleapis.com has compute.googleapis.com as a prerequisite.
+	group := ServiceGroupConfig{Name: "gke", Services: []string{"container.googleapis.com", "storage.googleapis.com"}}
+	if err := p.EnableServiceGroup(context.Background(), "abc-test-1", group); err == nil {
+		t.Fatalf("expected an error when a service in the group fails to enable")
+	}
+
+	// The prerequisite is rolled back too, after the service that needed it.
+	want := []string{"DisableService container.googleapis.com", "DisableService compute.googleapis.com"}
+	if got := su.CallsTo("DisableService"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got rollback calls %v, want %v", got, want)
+	}
+	for _, service := range []string{"compute.googleapis.com", "container.googleapis.com"} {
+		if su.Enabled(service) {
+			t.Errorf("expected %s to be rolled back", service)
+		}
+	}
+}
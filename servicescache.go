@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// servicesCacheEntry is the on-disk record of the enabled services we last observed for a project.
+type servicesCacheEntry struct {
+	FetchedAt       time.Time `json:"fetchedAt"`
+	EnabledServices []string  `json:"enabledServices"`
+}
+
+// servicesCachePath returns the path of the cache file for the project.
+func servicesCachePath(projectName string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding user cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "gcpx-testproject", "services", projectName+".json"), nil
+}
+
+// readServicesCache returns the cached enabled services for the project, or nil if there is no entry younger than the TTL.
+func (p *ProjectManager) readServicesCache(ctx context.Context, projectName string) map[string]bool {
+	log := klog.FromContext(ctx)
+
+	cachePath, err := servicesCachePath(projectName)
+	if err != nil {
+		log.Info("unable to read services cache", "error", err)
+		return nil
+	}
+	b, err := os.ReadFile(cachePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Info("unable to read services cache", "path", cachePath, "error", err)
+		}
+		return nil
+	}
+	entry := &servicesCacheEntry{}
+	if err := json.Unmarshal(b, entry); err != nil {
+		log.Info("ignoring invalid services cache", "path", cachePath, "error", err)
+		return nil
+	}
+	age := time.Since(entry.FetchedAt)
+	if age > p.servicesCacheTTL {
+		log.V(2).Info("services cache expired", "project", projectName, "age", age)
+		return nil
+	}
+
+	enabledServices := make(map[string]bool)
+	for _, service := range entry.EnabledServices {
+		enabledServices[service] = true
+	}
+	log.Info("using cached enabled services", "project", projectName, "count", len(enabledServices), "age", age.Round(time.Second))
+	return enabledServices
+}
+
+// writeServicesCache records the enabled services for the project.
+func (p *ProjectManager) writeServicesCache(ctx context.Context, projectName string, enabledServices map[string]bool) {
+	log := klog.FromContext(ctx)
+
+	cachePath, err := servicesCachePath(projectName)
+	if err != nil {
+		log.Info("unable to write services cache", "error", err)
+		return
+	}
+	entry := &servicesCacheEntry{FetchedAt: time.Now()}
+	for service, enabled := range enabledServices {
+		if enabled {
+			entry.EnabledServices = append(entry.EnabledServices, service)
+		}
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		log.Info("unable to write services cache", "error", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		log.Info("unable to write services cache", "path", cachePath, "error", err)
+		return
+	}
+	if err := os.WriteFile(cachePath, b, 0644); err != nil {
+		log.Info("unable to write services cache", "path", cachePath, "error", err)
+	}
+}
+
+// invalidateServicesCache removes the cached enabled services for the project, after we change them.
+func (p *ProjectManager) invalidateServicesCache(ctx context.Context, projectName string) {
+	log := klog.FromContext(ctx)
+
+	cachePath, err := servicesCachePath(projectName)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(cachePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Info("unable to remove services cache", "path", cachePath, "error", err)
+	}
+}
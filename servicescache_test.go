@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServicesCacheHitAndMiss(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ctx := context.Background()
+
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["compute.googleapis.com"] = true
+
+	newManager := func() *ProjectManager {
+		p := newTestProjectManager(t, &Config{}, nil, suClient)
+		p.servicesCacheTTL = time.Hour
+		return p
+	}
+
+	// Miss: nothing cached, so we list the services and cache them.
+	enabled, err := newManager().getEnabledServices(ctx, "abc-test-1")
+	if err != nil {
+		t.Fatalf("getEnabledServices: %v", err)
+	}
+	if !enabled["compute.googleapis.com"] {
+		t.Errorf("got enabled services %v", enabled)
+	}
+	if n := len(su.CallsTo("ListServices")); n != 1 {
+		t.Fatalf("got %d ListServices calls on a cache miss, want 1", n)
+	}
+
+	// Hit: a new run within the TTL trusts the cache.
+	enabled, err = newManager().getEnabledServices(ctx, "abc-test-1")
+	if err != nil {
+		t.Fatalf("getEnabledServices: %v", err)
+	}
+	if !enabled["compute.googleapis.com"] {
+		t.Errorf("got cached enabled services %v", enabled)
+	}
+	if n := len(su.CallsTo("ListServices")); n != 1 {
+		t.Errorf("got %d ListServices calls after a cache hit, want 1", n)
+	}
+
+	// Enabling a service invalidates the cache, so the next run lists the services again.
+	if err := newManager().EnableProjectServices(ctx, "abc-test-1", []string{"storage.googleapis.com"}); err != nil {
+		t.Fatalf("EnableProjectServices: %v", err)
+	}
+	listCalls := len(su.CallsTo("ListServices"))
+	enabled, err = newManager().getEnabledServices(ctx, "abc-test-1")
+	if err != nil {
+		t.Fatalf("getEnabledServices: %v", err)
+	}
+	if !enabled["storage.googleapis.com"] {
+		t.Errorf("expected the newly enabled service after invalidation, got %v", enabled)
+	}
+	if n := len(su.CallsTo("ListServices")); n != listCalls+1 {
+		t.Errorf("expected a ListServices call after invalidation")
+	}
+}
+
+func TestServicesCacheExpired(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ctx := context.Background()
+
+	cachePath, err := servicesCachePath("abc-test-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(&servicesCacheEntry{FetchedAt: time.Now().Add(-2 * time.Hour), EnabledServices: []string{"stale.googleapis.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProjectManager(&Config{})
+	p.servicesCacheTTL = time.Hour
+	if got := p.readServicesCache(ctx, "abc-test-1"); got != nil {
+		t.Errorf("expected an expired entry to be ignored, got %v", got)
+	}
+
+	p.servicesCacheTTL = 3 * time.Hour
+	if got := p.readServicesCache(ctx, "abc-test-1"); !got["stale.googleapis.com"] {
+		t.Errorf("expected an entry within the TTL to be used, got %v", got)
+	}
+}
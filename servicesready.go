@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	serviceusage "cloud.google.com/go/serviceusage/apiv1"
+	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// servicesReadyPollInterval is the delay between polls of the state of newly enabled services.
+// It is a variable so that tests can poll quickly.
+var servicesReadyPollInterval = 5 * time.Second
+
+// maxServicesPerBatchGet is the maximum number of services BatchGetServices accepts in one request.
+const maxServicesPerBatchGet = 30
+
+// waitUntilServicesReady polls until all the services report state ENABLED, or servicesReadyTimeout passes.
+// The enable operation can complete before the service is usable, which makes the setup commands that follow flaky.
+func (p *ProjectManager) waitUntilServicesReady(ctx context.Context, suClient *serviceusage.Client, projectName string, services []string) error {
+	log := klog.FromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, p.servicesReadyTimeout)
+	defer cancel()
+
+	// pending is filtered in place, so must not share the caller's slice.
+	pending := slices.Clone(services)
+	for {
+		states, err := p.getServiceStates(ctx, suClient, projectName, pending)
+		if err != nil {
+			// The gRPC deadline can fire just before ctx reports it.
+			if ctx.Err() != nil || status.Code(err) == codes.DeadlineExceeded {
+				return fmt.Errorf("timed out after %v waiting for services %v to be ready: %w", p.servicesReadyTimeout, pending, err)
+			}
+			return err
+		}
+		for _, serviceID := range pending {
+			log.V(2).Info("service state", "service", serviceID, "state", states[serviceID], "project", projectName)
+		}
+		pending = slices.DeleteFunc(pending, func(serviceID string) bool {
+			return states[serviceID] == serviceusagepb.State_ENABLED
+		})
+		if len(pending) == 0 {
+			log.Info("services ready", "services", services, "project", projectName)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v waiting for services %v to be ready: %w", p.servicesReadyTimeout, pending, ctx.Err())
+		case <-time.After(servicesReadyPollInterval):
+		}
+	}
+}
+
+// getServiceStates returns the state of each of the services.
+func (p *ProjectManager) getServiceStates(ctx context.Context, suClient *serviceusage.Client, projectName string, services []string) (map[string]serviceusagepb.State, error) {
+	states := make(map[string]serviceusagepb.State)
+	for batch := range slices.Chunk(services, maxServicesPerBatchGet) {
+		req := &serviceusagepb.BatchGetServicesRequest{
+			Parent: fmt.Sprintf("projects/%s", projectName),
+		}
+		for _, serviceID := range batch {
+			req.Names = append(req.Names, fmt.Sprintf("projects/%s/services/%s", projectName, serviceID))
+		}
+
+		var response *serviceusagepb.BatchGetServicesResponse
+		err := p.retryWithBackoff(ctx, func() error {
+			var err error
+			response, err = suClient.BatchGetServices(ctx, req)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting state of services for project %q: %w", projectName, err)
+		}
+		for _, service := range response.GetServices() {
+			states[service.GetConfig().GetName()] = service.GetState()
+		}
+	}
+	return states, nil
+}
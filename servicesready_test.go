@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitUntilServicesReady(t *testing.T) {
+	defer func(d time.Duration) { servicesReadyPollInterval = d }(servicesReadyPollInterval)
+	servicesReadyPollInterval = time.Millisecond
+
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["compute.googleapis.com"] = true
+	su.enabled["pubsub.googleapis.com"] = true
+	// pubsub only reports ENABLED on the third read.
+	su.notReady["pubsub.googleapis.com"] = 2
+
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+	p.servicesReadyTimeout = 5 * time.Second
+
+	services := []string{"compute.googleapis.com", "pubsub.googleapis.com"}
+	if err := p.waitUntilServicesReady(context.Background(), suClient, "abc-test-1", services); err != nil {
+		t.Fatalf("waitUntilServicesReady: %v", err)
+	}
+	if got := len(su.CallsTo("BatchGetServices")); got != 3 {
+		t.Errorf("got %d polls, want 3", got)
+	}
+	// The caller's slice is not modified.
+	if want := []string{"compute.googleapis.com", "pubsub.googleapis.com"}; !slices.Equal(services, want) {
+		t.Errorf("services were modified to %q, want %q", services, want)
+	}
+}
+
+func TestWaitUntilServicesReadyTimesOut(t *testing.T) {
+	defer func(d time.Duration) { servicesReadyPollInterval = d }(servicesReadyPollInterval)
+	servicesReadyPollInterval = time.Millisecond
+
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["pubsub.googleapis.com"] = true
+	su.notReady["pubsub.googleapis.com"] = 1 << 20
+
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+	p.servicesReadyTimeout = 50 * time.Millisecond
+
+	err := p.waitUntilServicesReady(context.Background(), suClient, "abc-test-1", []string{"pubsub.googleapis.com"})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") || !strings.Contains(err.Error(), "pubsub.googleapis.com") {
+		t.Errorf("got error %v, want a timeout naming the pending service", err)
+	}
+}
+
+func TestEnableProjectServicesWaitsForReady(t *testing.T) {
+	defer func(d time.Duration) { servicesReadyPollInterval = d }(servicesReadyPollInterval)
+	servicesReadyPollInterval = time.Millisecond
+
+	su, suClient := newFakeServiceUsage(t)
+	su.notReady["pubsub.googleapis.com"] = 1
+
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+	p.waitForServicesReady = true
+	p.servicesReadyTimeout = 5 * time.Second
+
+	services := []string{"compute.googleapis.com", "pubsub.googleapis.com", "storage.googleapis.com"}
+	if err := p.EnableProjectServices(context.Background(), "abc-test-1", services); err != nil {
+		t.Fatalf("EnableProjectServices: %v", err)
+	}
+	// The batch passed to the wait is the one recorded afterwards.
+	got := slices.Sorted(slices.Values(p.result.ServicesEnabled))
+	if !slices.Equal(got, services) {
+		t.Errorf("got services enabled %q, want %q", got, services)
+	}
+	for _, service := range services {
+		if !p.enabledServices[service] {
+			t.Errorf("expected %s to be recorded as enabled", service)
+		}
+	}
+}
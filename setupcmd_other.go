@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killProcessGroupOnCancel relies on the default behaviour of killing only cmd's own process,
+// as process groups are not available on this platform.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = 10 * time.Second
+}
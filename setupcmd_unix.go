@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killProcessGroupOnCancel runs cmd in its own process group, and kills the whole group when cmd's context is done,
+// so that processes started by the shell (e.g. gcloud) are killed along with it.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Don't wait forever for output from any process that escaped the group.
+	cmd.WaitDelay = 10 * time.Second
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// setupCommandOutput holds the writers for a single setup command's output.
+type setupCommandOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// LogPath is the file the output is captured to, if capture is enabled.
+	LogPath string
+
+	logFile *os.File
+}
+
+// Close closes the capture file, if any.
+func (o *setupCommandOutput) Close() error {
+	if o.logFile == nil {
+		return nil
+	}
+	if err := o.logFile.Close(); err != nil {
+		return fmt.Errorf("error closing %q: %w", o.LogPath, err)
+	}
+	return nil
+}
+
+// newSetupCommandOutput builds the output writers for the setup command with the given index.
+// If setupLogDir is set, the complete output is also written to a per-command log file.
+// If setupOutputLimit is positive, the output streamed to our stdout/stderr is truncated after that many bytes.
+func (p *ProjectManager) newSetupCommandOutput(index int) (*setupCommandOutput, error) {
+	out := &setupCommandOutput{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if p.setupOutputLimit > 0 {
+		out.Stdout = &limitWriter{w: out.Stdout, remaining: p.setupOutputLimit}
+		out.Stderr = &limitWriter{w: out.Stderr, remaining: p.setupOutputLimit}
+	}
+
+	if p.setupLogDir != "" {
+		if err := os.MkdirAll(p.setupLogDir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating setup log directory %q: %w", p.setupLogDir, err)
+		}
+		out.LogPath = filepath.Join(p.setupLogDir, fmt.Sprintf("setup-%03d.log", index))
+		f, err := os.Create(out.LogPath)
+		if err != nil {
+			return nil, fmt.Errorf("error creating setup log file: %w", err)
+		}
+		out.logFile = f
+		out.Stdout = io.MultiWriter(out.Stdout, f)
+		out.Stderr = io.MultiWriter(out.Stderr, f)
+	}
+	return out, nil
+}
+
+// limitWriter passes through up to remaining bytes, then discards the rest.
+// It never returns an error for discarded data, so the command is not interrupted.
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+	truncated bool
+}
+
+func (l *limitWriter) Write(b []byte) (int, error) {
+	if l.remaining <= 0 {
+		if !l.truncated {
+			l.truncated = true
+			fmt.Fprintf(l.w, "\n... output truncated ...\n")
+		}
+		return len(b), nil
+	}
+	n := len(b)
+	if int64(len(b)) > l.remaining {
+		b = b[:l.remaining]
+	}
+	written, err := l.w.Write(b)
+	l.remaining -= int64(written)
+	if err != nil {
+		return written, err
+	}
+	if written < n && !l.truncated {
+		l.truncated = true
+		fmt.Fprintf(l.w, "\n... output truncated ...\n")
+	}
+	return n, nil
+}
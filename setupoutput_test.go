@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestRunSetupCommandsCapturesOutputToFile(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1"}))
+
+	p := newTestProjectManager(t, &Config{SetupCommands: []string{
+		"echo stdout-$PROJECT_ID; echo stderr-$PROJECT_NUMBER >&2",
+		"echo second",
+	}}, api, nil)
+	p.identity = &fakeIdentity{email: "ci@example.com"}
+	p.setupLogDir = filepath.Join(t.TempDir(), "logs")
+
+	if err := p.RunSetupCommands(context.Background(), "abc-test-1"); err != nil {
+		t.Fatalf("RunSetupCommands: %v", err)
+	}
+
+	if len(p.result.SetupCommands) != 2 {
+		t.Fatalf("got %d setup command results, want 2", len(p.result.SetupCommands))
+	}
+	wantLogs := []struct {
+		name     string
+		contains []string
+	}{
+		{"setup-000.log", []string{"stdout-abc-test-1", "stderr-123456789012"}},
+		{"setup-001.log", []string{"second"}},
+	}
+	for i, want := range wantLogs {
+		logPath := p.result.SetupCommands[i].LogPath
+		if logPath != filepath.Join(p.setupLogDir, want.name) {
+			t.Errorf("command %d: got log path %q, want %q", i, logPath, filepath.Join(p.setupLogDir, want.name))
+		}
+		b, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatalf("command %d: error reading log: %v", i, err)
+		}
+		for _, s := range want.contains {
+			if !strings.Contains(string(b), s) {
+				t.Errorf("command %d: expected %q in log, got %q", i, s, b)
+			}
+		}
+	}
+}
+
+func TestLimitWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &limitWriter{w: &out, remaining: 10}
+
+	for _, s := range []string{"hello ", "world", "!!!"} {
+		n, err := w.Write([]byte(s))
+		if err != nil || n != len(s) {
+			t.Errorf("Write(%q) = %d, %v; want %d, nil", s, n, err, len(s))
+		}
+	}
+
+	want := "hello worl\n... output truncated ...\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
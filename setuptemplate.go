@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// setupCommandTemplateData is the context available to setup commands rendered as Go templates.
+type setupCommandTemplateData struct {
+	ProjectID      string
+	ProjectNumber  string
+	Parent         string
+	BillingAccount string
+	Labels         map[string]string
+	Env            map[string]string
+}
+
+// buildSetupCommandTemplateData reads the project and builds the context for templated setup commands.
+func (p *ProjectManager) buildSetupCommandTemplateData(ctx context.Context, projectName string) (*setupCommandTemplateData, error) {
+	project, err := p.getProject(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project %q not found", projectName)
+	}
+
+	data := &setupCommandTemplateData{
+		ProjectID:      projectName,
+		ProjectNumber:  strings.TrimPrefix(project.Name, "projects/"),
+		Parent:         project.Parent,
+		BillingAccount: p.config.BillingAccount,
+		Labels:         project.Labels,
+		Env:            make(map[string]string),
+	}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		data.Env[k] = v
+	}
+	return data, nil
+}
+
+// setupCommandTemplateDataIfEnabled returns the template context if setup commands are templated, otherwise nil.
+func (p *ProjectManager) setupCommandTemplateDataIfEnabled(ctx context.Context, projectName string) (*setupCommandTemplateData, error) {
+	if !p.config.SetupCommandsTemplate {
+		return nil, nil
+	}
+	return p.buildSetupCommandTemplateData(ctx, projectName)
+}
+
+// expandSetupCommand renders the command as a template if templateData is set,
+// otherwise it substitutes ${PROJECT_ID} and ${PROJECT_NUMBER}.
+func expandSetupCommand(command string, projectName string, projectNumber string, templateData *setupCommandTemplateData) (string, error) {
+	if templateData != nil {
+		return renderSetupCommandTemplate(command, templateData)
+	}
+	command = strings.ReplaceAll(command, "${PROJECT_ID}", projectName)
+	command = strings.ReplaceAll(command, "${PROJECT_NUMBER}", projectNumber)
+	return command, nil
+}
+
+// maxProjectNumberReads bounds how many times we read a freshly created project waiting for its number.
+const maxProjectNumberReads = 5
+
+// projectNumberReadDelay is the delay between reads of a project waiting for its number.
+// It is a variable so that tests can re-read quickly.
+var projectNumberReadDelay = 2 * time.Second
+
+// getProjectNumber reads the project to find its number, which is assigned by GCP on creation.
+// Just after creation the number may not be populated yet, so we re-read the project until it is.
+func (p *ProjectManager) getProjectNumber(ctx context.Context, projectName string) (string, error) {
+	for attempt := 1; ; attempt++ {
+		project, err := p.getProject(ctx, projectName)
+		if err != nil {
+			return "", err
+		}
+		if project == nil {
+			return "", fmt.Errorf("project %q not found", projectName)
+		}
+		projectNumber := strings.TrimPrefix(project.Name, "projects/")
+		if projectNumber != "" {
+			p.result.ProjectNumber = projectNumber
+			return projectNumber, nil
+		}
+		if attempt >= maxProjectNumberReads {
+			return "", fmt.Errorf("project %q has no project number after %d reads", projectName, attempt)
+		}
+		klog.FromContext(ctx).Info("project number not yet populated, re-reading project", "project", projectName, "attempt", attempt)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(projectNumberReadDelay):
+		}
+	}
+}
+
+// renderSetupCommandTemplate renders a setup command as a Go template.
+// Missing keys are an error, so that typos do not silently produce broken commands.
+func renderSetupCommandTemplate(command string, data *setupCommandTemplateData) (string, error) {
+	tmpl, err := template.New("setupCommand").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return "", fmt.Errorf("error parsing setup command template %q: %w", command, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("error rendering setup command template %q: %w", command, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestExpandSetupCommandTemplate(t *testing.T) {
+	t.Setenv("DEPLOY_REGION", "us-central1")
+
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{
+		Name:      "projects/123456789012",
+		ProjectId: "abc-test-1",
+		Parent:    "folders/123",
+		Labels:    map[string]string{"env": "prod", "team": "infra"},
+	}))
+	p := newTestProjectManager(t, &Config{SetupCommandsTemplate: true, BillingAccount: "billingAccounts/012345-6789AB-CDEF01"}, api, nil)
+
+	data, err := p.setupCommandTemplateDataIfEnabled(context.Background(), "abc-test-1")
+	if err != nil {
+		t.Fatalf("setupCommandTemplateDataIfEnabled: %v", err)
+	}
+
+	grid := []struct {
+		command string
+		want    string
+	}{
+		{"gcloud config set project {{.ProjectID}}", "gcloud config set project abc-test-1"},
+		{"echo {{.ProjectNumber}} {{.Parent}} {{.BillingAccount}}", "echo 123456789012 folders/123 billingAccounts/012345-6789AB-CDEF01"},
+		{`{{if eq .Labels.env "prod"}}enable-alerts{{else}}skip{{end}}`, "enable-alerts"},
+		{`{{range $k, $v := .Labels}}--label={{$k}}={{$v}} {{end}}`, "--label=env=prod --label=team=infra "},
+		{"deploy --region={{.Env.DEPLOY_REGION}}", "deploy --region=us-central1"},
+		// The simple substitution is not applied to templates.
+		{"echo ${PROJECT_ID}", "echo ${PROJECT_ID}"},
+	}
+	for _, g := range grid {
+		got, err := expandSetupCommand(g.command, "abc-test-1", "123456789012", data)
+		if err != nil {
+			t.Errorf("expandSetupCommand(%q): %v", g.command, err)
+			continue
+		}
+		if got != g.want {
+			t.Errorf("expandSetupCommand(%q) = %q, want %q", g.command, got, g.want)
+		}
+	}
+
+	for _, command := range []string{"echo {{.Missing}}", "echo {{.ProjectID"} {
+		if _, err := expandSetupCommand(command, "abc-test-1", "123456789012", data); err == nil {
+			t.Errorf("expandSetupCommand(%q): expected an error", command)
+		}
+	}
+}
+
+func TestExpandSetupCommandWithoutTemplate(t *testing.T) {
+	p := NewProjectManager(&Config{})
+	data, err := p.setupCommandTemplateDataIfEnabled(context.Background(), "abc-test-1")
+	if err != nil || data != nil {
+		t.Fatalf("expected no template data when templates are disabled, got %v, %v", data, err)
+	}
+
+	got, err := expandSetupCommand("echo ${PROJECT_ID} {{.ProjectID}}", "abc-test-1", "123456789012", nil)
+	if err != nil {
+		t.Fatalf("expandSetupCommand: %v", err)
+	}
+	if want := "echo abc-test-1 {{.ProjectID}}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunSetupCommandsProjectNumber(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{Name: "projects/123456789012", ProjectId: "abc-test-1"}))
+
+	outPath := filepath.Join(t.TempDir(), "out.txt")
+	p := newTestProjectManager(t, &Config{
+		// ${PROJECT_NUMBER} is substituted by us; $PROJECT_NUMBER is expanded by the shell from the environment.
+		SetupCommands: []string{`echo "${PROJECT_ID} ${PROJECT_NUMBER} $PROJECT_NUMBER" > ` + outPath},
+	}, api, nil)
+	p.identity = &fakeIdentity{email: "ci@example.iam.gserviceaccount.com"}
+
+	if err := p.RunSetupCommands(context.Background(), "abc-test-1"); err != nil {
+		t.Fatalf("RunSetupCommands: %v", err)
+	}
+	b, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "abc-test-1 123456789012 123456789012\n"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+	// The number is also reported in the JSON output.
+	if got := p.result.ProjectNumber; got != "123456789012" {
+		t.Errorf("got result project number %q, want 123456789012", got)
+	}
+}
+
+func TestGetProjectNumberRereadsNewProject(t *testing.T) {
+	defer func(d time.Duration) { projectNumberReadDelay = d }(projectNumberReadDelay)
+	projectNumberReadDelay = time.Millisecond
+
+	// Just after creation the project has no number yet.
+	var reads atomic.Int32
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", func(w http.ResponseWriter, r *http.Request) {
+		project := &cloudresourcemanager.Project{ProjectId: "abc-test-1"}
+		if reads.Add(1) > 2 {
+			project.Name = "projects/123456789012"
+		}
+		writeJSON(w, project)
+	})
+	outPath := filepath.Join(t.TempDir(), "out.txt")
+	p := newTestProjectManager(t, &Config{SetupCommands: []string{"echo ${PROJECT_NUMBER} > " + outPath}}, api, nil)
+	p.identity = &fakeIdentity{email: "ci@example.iam.gserviceaccount.com"}
+
+	if err := p.RunSetupCommands(context.Background(), "abc-test-1"); err != nil {
+		t.Fatalf("RunSetupCommands: %v", err)
+	}
+	if got := reads.Load(); got != 3 {
+		t.Errorf("got %d project reads, want 3", got)
+	}
+	b, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "123456789012\n"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+}
+
+func TestGetProjectNumberGivesUp(t *testing.T) {
+	defer func(d time.Duration) { projectNumberReadDelay = d }(projectNumberReadDelay)
+	projectNumberReadDelay = time.Millisecond
+
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{ProjectId: "abc-test-1"}))
+	p := newTestProjectManager(t, &Config{}, api, nil)
+
+	if _, err := p.getProjectNumber(context.Background(), "abc-test-1"); err == nil {
+		t.Errorf("expected an error when the project number is never populated")
+	}
+	if got := api.CallCount("GET /v3/projects/abc-test-1"); got != maxProjectNumberReads {
+		t.Errorf("got %d reads, want %d", got, maxProjectNumberReads)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// defaultSetupCommandTimeout is how long a setup command may run if no timeout is configured.
+const defaultSetupCommandTimeout = 10 * time.Minute
+
+// setupCommandTimeoutOrDefault returns the timeout for each setup command:
+// the -command-timeout flag, then setupCommandTimeout from the config, then the default.
+func (p *ProjectManager) setupCommandTimeoutOrDefault() time.Duration {
+	if p.setupCommandTimeout > 0 {
+		return p.setupCommandTimeout
+	}
+	if p.config.SetupCommandTimeout != "" {
+		// The value was checked by validateConfig.
+		d, _ := time.ParseDuration(p.config.SetupCommandTimeout)
+		return d
+	}
+	return defaultSetupCommandTimeout
+}
+
+// waitBeforeSetupCommands sleeps for SetupCommandsInitialDelay, if the project was created by this run.
+func (p *ProjectManager) waitBeforeSetupCommands(ctx context.Context, projectName string) error {
+	if p.config.SetupCommandsInitialDelay == "" || !p.result.Created {
+		return nil
+	}
+	// The value was checked by validateConfig.
+	delay, _ := time.ParseDuration(p.config.SetupCommandsInitialDelay)
+	if delay <= 0 {
+		return nil
+	}
+
+	log := klog.FromContext(ctx)
+	log.Info("project was just created, waiting before running setup commands", "delay", delay, "project", projectName)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitBeforeSetupCommandsOnlyOnCreate(t *testing.T) {
+	const delay = 200 * time.Millisecond
+
+	grid := []struct {
+		name      string
+		created   bool
+		wantDelay bool
+	}{
+		{"created by this run", true, true},
+		{"already existed", false, false},
+	}
+	for _, g := range grid {
+		p := NewProjectManager(&Config{SetupCommandsInitialDelay: delay.String()})
+		p.result.Created = g.created
+
+		start := time.Now()
+		if err := p.waitBeforeSetupCommands(context.Background(), "abc-test-1"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", g.name, err)
+		}
+		elapsed := time.Since(start)
+		if g.wantDelay && elapsed < delay {
+			t.Errorf("%s: waited %v, want at least %v", g.name, elapsed, delay)
+		}
+		if !g.wantDelay && elapsed >= delay {
+			t.Errorf("%s: waited %v, want no delay", g.name, elapsed)
+		}
+	}
+}
+
+func TestWaitBeforeSetupCommandsCancelled(t *testing.T) {
+	p := NewProjectManager(&Config{SetupCommandsInitialDelay: "1h"})
+	p.result.Created = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.waitBeforeSetupCommands(ctx, "abc-test-1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"k8s.io/klog/v2"
+)
+
+// ProjectSnapshot is the observed state of a project, recorded for auditing.
+type ProjectSnapshot struct {
+	Timestamp       time.Time                    `json:"timestamp"`
+	ProjectID       string                       `json:"projectId"`
+	ProjectNumber   string                       `json:"projectNumber,omitempty"`
+	State           string                       `json:"state,omitempty"`
+	Parent          string                       `json:"parent,omitempty"`
+	Labels          map[string]string            `json:"labels,omitempty"`
+	BillingAccount  string                       `json:"billingAccount,omitempty"`
+	BillingEnabled  bool                         `json:"billingEnabled"`
+	EnabledServices []string                     `json:"enabledServices"`
+	IAMPolicy       *cloudresourcemanager.Policy `json:"iamPolicy,omitempty"`
+}
+
+// ReadSnapshot reads the current state of the project from the GCP APIs.
+func (p *ProjectManager) ReadSnapshot(ctx context.Context, projectName string) (*ProjectSnapshot, error) {
+	snapshot := &ProjectSnapshot{
+		Timestamp: time.Now().UTC(),
+		ProjectID: projectName,
+	}
+
+	project, err := p.getProject(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project %q not found", projectName)
+	}
+	snapshot.ProjectNumber = strings.TrimPrefix(project.Name, "projects/")
+	snapshot.State = project.State
+	snapshot.Parent = project.Parent
+	snapshot.Labels = project.Labels
+
+	billingService, err := p.getCloudBillingClient(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	billingInfo, err := billingService.Projects.GetBillingInfo("projects/" + projectName).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error getting billing info for project %q: %w", projectName, err)
+	}
+	snapshot.BillingAccount = billingInfo.BillingAccountName
+	snapshot.BillingEnabled = billingInfo.BillingEnabled
+
+	enabledServices, err := p.getEnabledServices(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.EnabledServices = []string{}
+	for service, enabled := range enabledServices {
+		if enabled {
+			snapshot.EnabledServices = append(snapshot.EnabledServices, service)
+		}
+	}
+	sort.Strings(snapshot.EnabledServices)
+
+	crmService, err := p.getCloudResourceManagerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := crmService.Projects.GetIamPolicy("projects/"+projectName, getIAMPolicyRequest()).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error getting iam policy for project %q: %w", projectName, err)
+	}
+	snapshot.IAMPolicy = policy
+
+	return snapshot, nil
+}
+
+// WriteSnapshot reads the project state and writes it as JSON.
+// The timestamp is inserted into the file name, so that repeated runs keep a history.
+func (p *ProjectManager) WriteSnapshot(ctx context.Context, projectName string, basePath string) error {
+	log := klog.FromContext(ctx)
+
+	snapshot, err := p.ReadSnapshot(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling snapshot: %w", err)
+	}
+
+	ext := filepath.Ext(basePath)
+	if ext == "" {
+		ext = ".json"
+	}
+	snapshotPath := strings.TrimSuffix(basePath, filepath.Ext(basePath)) + "-" + snapshot.Timestamp.Format("20060102T150405Z") + ext
+	if err := os.WriteFile(snapshotPath, b, 0644); err != nil {
+		return fmt.Errorf("error writing snapshot to %q: %w", snapshotPath, err)
+	}
+	log.Info("wrote project snapshot", "project", projectName, "path", snapshotPath)
+	return nil
+}
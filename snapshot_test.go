@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func TestWriteSnapshot(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1", respondJSON(&cloudresourcemanager.Project{
+		Name:      "projects/123456789012",
+		ProjectId: "abc-test-1",
+		State:     "ACTIVE",
+		Parent:    "folders/123",
+		Labels:    map[string]string{"team": "infra"},
+	}))
+	api.handle("GET /v1/projects/abc-test-1/billingInfo", respondJSON(&cloudbilling.ProjectBillingInfo{
+		BillingAccountName: "billingAccounts/012345-6789AB-CDEF01",
+		BillingEnabled:     true,
+	}))
+	api.handle("POST /v3/projects/abc-test-1:getIamPolicy", respondJSON(&cloudresourcemanager.Policy{
+		Version:  3,
+		Etag:     "BwX=",
+		Bindings: []*cloudresourcemanager.Binding{{Role: "roles/owner", Members: []string{"user:admin@example.com"}}},
+	}))
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["storage.googleapis.com"] = true
+	su.enabled["compute.googleapis.com"] = true
+
+	p := newTestProjectManager(t, &Config{}, api, suClient)
+
+	basePath := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := p.WriteSnapshot(context.Background(), "abc-test-1", basePath); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+
+	// The timestamp is inserted into the file name.
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(basePath), "snapshot-*Z.json"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected one timestamped snapshot file, got %v (err %v)", matches, err)
+	}
+	b, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot ProjectSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		t.Fatalf("error parsing snapshot: %v", err)
+	}
+
+	if snapshot.ProjectID != "abc-test-1" || snapshot.ProjectNumber != "123456789012" {
+		t.Errorf("got project %q number %q", snapshot.ProjectID, snapshot.ProjectNumber)
+	}
+	if snapshot.State != "ACTIVE" || snapshot.Parent != "folders/123" {
+		t.Errorf("got state %q parent %q", snapshot.State, snapshot.Parent)
+	}
+	if !reflect.DeepEqual(snapshot.Labels, map[string]string{"team": "infra"}) {
+		t.Errorf("got labels %v", snapshot.Labels)
+	}
+	if snapshot.BillingAccount != "billingAccounts/012345-6789AB-CDEF01" || !snapshot.BillingEnabled {
+		t.Errorf("got billing account %q enabled %v", snapshot.BillingAccount, snapshot.BillingEnabled)
+	}
+	if want := []string{"compute.googleapis.com", "storage.googleapis.com"}; !reflect.DeepEqual(snapshot.EnabledServices, want) {
+		t.Errorf("got enabled services %v, want %v", snapshot.EnabledServices, want)
+	}
+	if snapshot.IAMPolicy == nil || len(snapshot.IAMPolicy.Bindings) != 1 || snapshot.IAMPolicy.Bindings[0].Role != "roles/owner" {
+		t.Errorf("got iam policy %+v", snapshot.IAMPolicy)
+	}
+	if snapshot.Timestamp.IsZero() {
+		t.Errorf("expected the snapshot to be timestamped")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/proxy"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+	"google.golang.org/grpc"
+)
+
+// TLSConfig configures the TLS settings used for outbound API calls,
+// for environments that egress through a proxy with a custom CA or require client certificates.
+//
+// This applies to the HTTP-based clients (resource manager, billing, IAM, ...).
+// The serviceusage client uses gRPC and is not affected, except that an https proxy is dialed with these settings.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of additional CA certificates to trust.
+	CAFile string `yaml:"caFile" json:"caFile"`
+	// CertFile and KeyFile are a PEM client certificate and key to present.
+	CertFile string `yaml:"certFile" json:"certFile"`
+	KeyFile  string `yaml:"keyFile" json:"keyFile"`
+}
+
+// IsSet returns true if any custom TLS settings are configured.
+func (c *TLSConfig) IsSet() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.KeyFile != ""
+}
+
+// Validate checks that the TLS settings are consistent and the files exist.
+func (c *TLSConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("tls.certFile and tls.keyFile must be specified together")
+	}
+	for _, f := range []string{c.CAFile, c.CertFile, c.KeyFile} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			return fmt.Errorf("error reading tls file: %w", err)
+		}
+	}
+	return nil
+}
+
+// buildTLSConfig loads the configured certificates into a tls.Config.
+func (c *TLSConfig) buildTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("error loading system cert pool: %w", err)
+		}
+		b, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca file %q: %w", c.CAFile, err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in ca file %q", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate %q / %q: %w", c.CertFile, c.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// parseProxyURL parses and validates the proxy URL from the config.
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing proxy %q: %w", s, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy %q must have scheme http, https or socks5", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q must include a host", s)
+	}
+	return u, nil
+}
+
+// clientOptions returns the options for building HTTP-based API clients.
+// If a custom transport is configured, the returned options carry an authenticated http.Client using it;
+// because option.WithHTTPClient overrides all other options, any extra options are applied to that client.
+func (p *ProjectManager) clientOptions(ctx context.Context, extra ...option.ClientOption) ([]option.ClientOption, error) {
+	if !p.config.TLS.IsSet() && p.config.Proxy == "" && !p.dumpRequests {
+		return extra, nil
+	}
+
+	base, err := p.baseTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := append([]option.ClientOption{option.WithScopes("https://www.googleapis.com/auth/cloud-platform")}, extra...)
+	transport, err := htransport.NewTransport(ctx, base, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error building http transport: %w", err)
+	}
+	if p.dumpRequests {
+		transport = &dumpingRoundTripper{next: transport}
+	}
+	return []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: transport})}, nil
+}
+
+// baseTransport returns an unauthenticated transport with the configured TLS settings and proxy.
+func (p *ProjectManager) baseTransport() (*http.Transport, error) {
+	// The default transport uses the proxy from the environment (HTTPS_PROXY etc.)
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if p.config.TLS.IsSet() {
+		tlsConfig, err := p.config.TLS.buildTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		base.TLSClientConfig = tlsConfig
+	}
+	if p.config.Proxy != "" {
+		proxyURL, err := parseProxyURL(p.config.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		base.Proxy = http.ProxyURL(proxyURL)
+	}
+	return base, nil
+}
+
+// grpcProxyDialOption returns a dial option that routes gRPC connections through the configured proxy,
+// or nil if no proxy is configured (gRPC then uses the proxy from the environment).
+func (p *ProjectManager) grpcProxyDialOption() (grpc.DialOption, error) {
+	if p.config.Proxy == "" {
+		return nil, nil
+	}
+	proxyURL, err := parseProxyURL(p.config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if p.config.TLS.IsSet() {
+		tlsConfig, err = p.config.TLS.buildTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialThroughProxy(ctx, proxyURL, tlsConfig, addr)
+	}), nil
+}
+
+// dialThroughProxy opens a connection to addr through the proxy,
+// using HTTP CONNECT for http and https proxies, and SOCKS5 for socks5 proxies.
+// tlsConfig, if non-nil, is used for the connection to an https proxy.
+func dialThroughProxy(ctx context.Context, proxyURL *url.URL, tlsConfig *tls.Config, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+
+	if proxyURL.Scheme == "socks5" {
+		d, err := proxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, fmt.Errorf("error building socks5 dialer for %q: %w", proxyURL.Host, err)
+		}
+		conn, err := d.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("error dialing %q through proxy %q: %w", addr, proxyURL.Host, err)
+		}
+		return conn, nil
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error dialing proxy %q: %w", proxyAddr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if proxyURL.Scheme == "https" {
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		cfg.ServerName = proxyURL.Hostname()
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error in tls handshake with proxy %q: %w", proxyAddr, err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error sending CONNECT to proxy %q: %w", proxyAddr, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading CONNECT response from proxy %q: %w", proxyAddr, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %q refused CONNECT to %q: %s", proxyAddr, addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn that first returns any bytes the proxy sent after its CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
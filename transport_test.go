@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/serviceusage/apiv1/serviceusagepb"
+	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/option"
+)
+
+// connectProxy is a minimal HTTP CONNECT proxy that records the targets it tunnels to.
+type connectProxy struct {
+	addr string
+
+	mu      sync.Mutex
+	targets []string
+	auth    []string
+}
+
+func startConnectProxy(t *testing.T) *connectProxy {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	p := &connectProxy{addr: lis.Addr().String()}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *connectProxy) serve(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil || req.Method != http.MethodConnect {
+		io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return
+	}
+	p.mu.Lock()
+	p.targets = append(p.targets, req.Host)
+	p.auth = append(p.auth, req.Header.Get("Proxy-Authorization"))
+	p.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer upstream.Close()
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	go io.Copy(upstream, br)
+	io.Copy(conn, upstream)
+}
+
+func (p *connectProxy) Targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.targets...)
+}
+
+func TestServiceUsageClientUsesConfiguredProxy(t *testing.T) {
+	proxy := startConnectProxy(t)
+
+	p := NewProjectManager(&Config{Proxy: "http://" + proxy.addr})
+	dialOption, err := p.grpcProxyDialOption()
+	if err != nil {
+		t.Fatalf("grpcProxyDialOption: %v", err)
+	}
+	if dialOption == nil {
+		t.Fatalf("expected a dial option when proxy is set")
+	}
+
+	fake, client := newFakeServiceUsage(t, option.WithGRPCDialOption(dialOption))
+	fake.enabled["compute.googleapis.com"] = true
+
+	it := client.ListServices(context.Background(), &serviceusagepb.ListServicesRequest{Parent: "projects/abc-test-1"})
+	if _, err := it.Next(); err != nil {
+		t.Fatalf("ListServices through proxy: %v", err)
+	}
+
+	if targets := proxy.Targets(); len(targets) == 0 {
+		t.Errorf("expected the gRPC connection to be tunneled through the proxy")
+	}
+}
+
+func TestGRPCProxyDialOptionUnset(t *testing.T) {
+	p := NewProjectManager(&Config{})
+	dialOption, err := p.grpcProxyDialOption()
+	if err != nil {
+		t.Fatalf("grpcProxyDialOption: %v", err)
+	}
+	if dialOption != nil {
+		t.Errorf("expected no dial option when proxy is unset")
+	}
+}
+
+func TestDialThroughProxy(t *testing.T) {
+	proxy := startConnectProxy(t)
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	proxyURL := &url.URL{Scheme: "http", Host: proxy.addr, User: url.UserPassword("user", "secret")}
+	conn, err := dialThroughProxy(context.Background(), proxyURL, nil, echo.Addr().String())
+	if err != nil {
+		t.Fatalf("dialThroughProxy: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "ping"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("got %q through the tunnel, want %q", buf, "ping")
+	}
+
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	if len(proxy.targets) != 1 || proxy.targets[0] != echo.Addr().String() {
+		t.Errorf("got CONNECT targets %v, want [%s]", proxy.targets, echo.Addr())
+	}
+	if want := "Basic dXNlcjpzZWNyZXQ="; proxy.auth[0] != want {
+		t.Errorf("got Proxy-Authorization %q, want %q", proxy.auth[0], want)
+	}
+}
+
+func TestDialThroughProxyRefused(t *testing.T) {
+	proxy := startConnectProxy(t)
+
+	// Nothing listens on the target, so the proxy answers 502.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	target := lis.Addr().String()
+	lis.Close()
+
+	proxyURL := &url.URL{Scheme: "http", Host: proxy.addr}
+	if _, err := dialThroughProxy(context.Background(), proxyURL, nil, target); err == nil {
+		t.Errorf("expected an error when the proxy refuses the CONNECT")
+	}
+}
+
+func TestClientOptionsUseCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(respondJSON(&cloudresourcemanager.Project{ProjectId: "abc-test-1"}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	getProject := func(p *ProjectManager) error {
+		opts, err := p.clientOptions(ctx, option.WithoutAuthentication())
+		if err != nil {
+			return err
+		}
+		crmService, err := cloudresourcemanager.NewService(ctx, append(opts, option.WithEndpoint(server.URL+"/"))...)
+		if err != nil {
+			return err
+		}
+		_, err = crmService.Projects.Get("projects/abc-test-1").Context(ctx).Do()
+		return err
+	}
+
+	// The test server's certificate is self-signed, so the default client does not trust it.
+	if err := getProject(NewProjectManager(&Config{})); err == nil {
+		t.Errorf("expected an error without the custom CA")
+	}
+
+	if err := getProject(NewProjectManager(&Config{TLS: TLSConfig{CAFile: caFile}})); err != nil {
+		t.Errorf("expected the custom CA to be used for resource manager calls, got %v", err)
+	}
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(existing, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	grid := []struct {
+		name    string
+		config  TLSConfig
+		wantErr bool
+	}{
+		{"unset", TLSConfig{}, false},
+		{"ca only", TLSConfig{CAFile: existing}, false},
+		{"missing ca", TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, true},
+		{"cert without key", TLSConfig{CertFile: existing}, true},
+		{"cert and key", TLSConfig{CertFile: existing, KeyFile: existing}, false},
+	}
+	for _, g := range grid {
+		if err := g.config.Validate(); (err != nil) != g.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", g.name, err, g.wantErr)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+	"k8s.io/klog/v2"
+)
+
+// apiRequestCountMetric counts the API requests made with the project as the consumer, labelled by service.
+const apiRequestCountMetric = "serviceruntime.googleapis.com/api/request_count"
+
+func (p *ProjectManager) getMonitoringClient(ctx context.Context) (*monitoring.Service, error) {
+	if p.monitoringService != nil {
+		return p.monitoringService, nil
+	}
+	opts, err := p.clientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	monitoringService, err := monitoring.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating monitoring client: %w", err)
+	}
+	p.monitoringService = monitoringService
+	return monitoringService, nil
+}
+
+// getAPIRequestCounts returns the number of API requests made to each service, with the project as the consumer,
+// over the window ending now.
+func (p *ProjectManager) getAPIRequestCounts(ctx context.Context, projectName string, window time.Duration) (map[string]int64, error) {
+	monitoringService, err := p.getMonitoringClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	start := end.Add(-window)
+	counts := make(map[string]int64)
+	if err := monitoringService.Projects.TimeSeries.List("projects/"+projectName).
+		Filter(fmt.Sprintf("metric.type=%q AND resource.type=\"consumed_api\"", apiRequestCountMetric)).
+		IntervalStartTime(start.Format(time.RFC3339)).
+		IntervalEndTime(end.Format(time.RFC3339)).
+		AggregationAlignmentPeriod(fmt.Sprintf("%ds", int64(window.Seconds()))).
+		AggregationPerSeriesAligner("ALIGN_SUM").
+		AggregationCrossSeriesReducer("REDUCE_SUM").
+		AggregationGroupByFields("resource.label.service").
+		Pages(ctx, func(resp *monitoring.ListTimeSeriesResponse) error {
+			for _, series := range resp.TimeSeries {
+				if series.Resource == nil {
+					continue
+				}
+				service := series.Resource.Labels["service"]
+				for _, point := range series.Points {
+					if point.Value == nil {
+						continue
+					}
+					if point.Value.Int64Value != nil {
+						counts[service] += *point.Value.Int64Value
+					} else if point.Value.DoubleValue != nil {
+						counts[service] += int64(*point.Value.DoubleValue)
+					}
+				}
+			}
+			return nil
+		}); err != nil {
+		return nil, fmt.Errorf("error reading API request counts for project %q (is monitoring.googleapis.com enabled?): %w", projectName, err)
+	}
+	return counts, nil
+}
+
+// findUnusedServices returns the enabled services with no recorded API requests, sorted by name.
+func findUnusedServices(enabledServices map[string]bool, requestCounts map[string]int64) []string {
+	var unused []string
+	for service, enabled := range enabledServices {
+		if enabled && requestCounts[service] == 0 {
+			unused = append(unused, service)
+		}
+	}
+	slices.Sort(unused)
+	return unused
+}
+
+// ReportUnusedServices writes a report of the enabled services that look unused to w.
+// A service looks unused if no API requests were made to it, with the project as the consumer, within the window.
+// This is a heuristic: see the README for its limits. Nothing is disabled.
+func (p *ProjectManager) ReportUnusedServices(ctx context.Context, projectName string, window time.Duration, w io.Writer) error {
+	log := klog.FromContext(ctx)
+
+	enabledServices, err := p.getEnabledServices(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	requestCounts, err := p.getAPIRequestCounts(ctx, projectName, window)
+	if err != nil {
+		return err
+	}
+
+	unused := findUnusedServices(enabledServices, requestCounts)
+	log.Info("found enabled services with no recent API requests", "project", projectName, "count", len(unused), "enabled", len(enabledServices), "window", window)
+
+	fmt.Fprintf(w, "# Services enabled on %s with no API requests in the last %v (heuristic; review before disabling)\n", projectName, window)
+	for _, service := range unused {
+		if slices.Contains(p.config.Services, service) {
+			fmt.Fprintf(w, "%s\t(in config)\n", service)
+		} else {
+			fmt.Fprintf(w, "%s\n", service)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+)
+
+func TestReportUnusedServices(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	for _, service := range []string{"compute.googleapis.com", "pubsub.googleapis.com", "storage.googleapis.com", "bigquery.googleapis.com"} {
+		su.enabled[service] = true
+	}
+
+	int64Value := func(v int64) *monitoring.TypedValue { return &monitoring.TypedValue{Int64Value: &v} }
+	doubleValue := func(v float64) *monitoring.TypedValue { return &monitoring.TypedValue{DoubleValue: &v} }
+	series := func(service string, values ...*monitoring.TypedValue) *monitoring.TimeSeries {
+		s := &monitoring.TimeSeries{Resource: &monitoring.MonitoredResource{Type: "consumed_api", Labels: map[string]string{"service": service}}}
+		for _, v := range values {
+			s.Points = append(s.Points, &monitoring.Point{Value: v})
+		}
+		return s
+	}
+
+	api := newFakeAPI(t)
+	api.handle("GET /v3/projects/abc-test-1/timeSeries", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("filter"); got != `metric.type="serviceruntime.googleapis.com/api/request_count" AND resource.type="consumed_api"` {
+			t.Errorf("unexpected filter %q", got)
+		}
+		if got := r.URL.Query().Get("aggregation.alignmentPeriod"); got != "604800s" {
+			t.Errorf("got alignment period %q, want the 7d window", got)
+		}
+		writeJSON(w, &monitoring.ListTimeSeriesResponse{TimeSeries: []*monitoring.TimeSeries{
+			series("compute.googleapis.com", int64Value(12), int64Value(3)),
+			series("storage.googleapis.com", doubleValue(2)),
+			// A service with a zero count is as unused as one with no series at all.
+			series("pubsub.googleapis.com", int64Value(0)),
+		}})
+	})
+	p := newTestProjectManager(t, &Config{Services: []string{"pubsub.googleapis.com"}}, api, suClient)
+
+	var out bytes.Buffer
+	if err := p.ReportUnusedServices(context.Background(), "abc-test-1", 7*24*time.Hour, &out); err != nil {
+		t.Fatalf("ReportUnusedServices: %v", err)
+	}
+	want := "# Services enabled on abc-test-1 with no API requests in the last 168h0m0s (heuristic; review before disabling)\n" +
+		"bigquery.googleapis.com\n" +
+		"pubsub.googleapis.com\t(in config)\n"
+	if got := out.String(); got != want {
+		t.Errorf("got report\n%s\nwant\n%s", got, want)
+	}
+
+	// The report never disables anything.
+	if calls := su.CallsTo("DisableService"); len(calls) != 0 {
+		t.Errorf("expected no DisableService calls, got %v", calls)
+	}
+}
+
+func TestFindUnusedServices(t *testing.T) {
+	enabled := map[string]bool{"a.googleapis.com": true, "b.googleapis.com": true, "c.googleapis.com": false}
+	counts := map[string]int64{"a.googleapis.com": 5, "d.googleapis.com": 1}
+	if got, want := findUnusedServices(enabled, counts), []string{"b.googleapis.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the payload, as sha256=<hex>, when a webhook secret is configured.
+const webhookSignatureHeader = "X-Signature-256"
+
+// readWebhookSecret reads the HMAC secret for -webhook-secret-file; surrounding whitespace is ignored.
+func readWebhookSecret(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhook secret file %q: %w", path, err)
+	}
+	secret := strings.TrimSpace(string(b))
+	if secret == "" {
+		return nil, fmt.Errorf("webhook secret file %q is empty", path)
+	}
+	return []byte(secret), nil
+}
+
+// signWebhookPayload returns the value of webhookSignatureHeader for the payload.
+func signWebhookPayload(secret []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookStatusError is returned when the webhook responds with a non-2xx status.
+type webhookStatusError struct {
+	StatusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook returned status %d", e.StatusCode)
+}
+
+// isRetryableWebhookError returns true for errors that may succeed on retry: rate limiting, server errors
+// and failures to connect. Other 4xx responses mean the request itself was rejected, so are not retried.
+func isRetryableWebhookError(err error) bool {
+	var serr *webhookStatusError
+	if errors.As(err, &serr) {
+		switch serr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// postResultToWebhook POSTs the result as JSON to o.webhookURL, signing it if o.webhookSecret is set.
+// Transient failures are retried with backoff (see -retry-base-delay), until o.webhookTimeout passes.
+func postResultToWebhook(ctx context.Context, o *runOptions, result *Result) error {
+	log := klog.FromContext(ctx)
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error marshaling result: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.webhookTimeout)
+	defer cancel()
+
+	err = o.projectManager.retryWithBackoffIf(ctx, isRetryableWebhookError, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.webhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if len(o.webhookSecret) != 0 {
+			req.Header.Set(webhookSignatureHeader, signWebhookPayload(o.webhookSecret, payload))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &webhookStatusError{StatusCode: resp.StatusCode}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error posting result to webhook: %w", err)
+	}
+	log.Info("posted result to webhook")
+	return nil
+}
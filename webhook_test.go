@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWebhook records the requests to an httptest server, failing the first failures of them with failStatus.
+type fakeWebhook struct {
+	mu         sync.Mutex
+	failures   int
+	failStatus int
+	bodies     [][]byte
+	signatures []string
+}
+
+func newFakeWebhook(t *testing.T, failures int, failStatus int) (*fakeWebhook, string) {
+	f := &fakeWebhook{failures: failures, failStatus: failStatus}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.bodies = append(f.bodies, body)
+		f.signatures = append(f.signatures, r.Header.Get(webhookSignatureHeader))
+		if len(f.bodies) <= f.failures {
+			w.WriteHeader(f.failStatus)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return f, server.URL
+}
+
+func newWebhookRunOptions(url string) *runOptions {
+	return &runOptions{
+		webhookURL:     url,
+		webhookSecret:  []byte("s3cret"),
+		webhookTimeout: 5 * time.Second,
+		projectManager: projectManagerOptions{retryBaseDelay: time.Millisecond, retryMaxAttempts: 3},
+	}
+}
+
+func TestPostResultToWebhook(t *testing.T) {
+	webhook, url := newFakeWebhook(t, 1, http.StatusServiceUnavailable)
+	result := &Result{Projects: []*ProjectResult{{
+		ProjectID:       "abc-test-1",
+		Created:         true,
+		ServicesEnabled: []string{"compute.googleapis.com"},
+		BillingAccount:  "billingAccounts/012345-6789AB-CDEF01",
+		BillingStatus:   BillingStatusLinked,
+	}}}
+
+	if err := postResultToWebhook(context.Background(), newWebhookRunOptions(url), result); err != nil {
+		t.Fatalf("postResultToWebhook: %v", err)
+	}
+
+	// The 503 is retried.
+	if len(webhook.bodies) != 2 {
+		t.Fatalf("got %d requests, want 2", len(webhook.bodies))
+	}
+	body := webhook.bodies[1]
+	var got Result
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("payload is not valid JSON: %v\n%s", err, body)
+	}
+	if len(got.Projects) != 1 {
+		t.Fatalf("got payload %s, want one project", body)
+	}
+	if p := got.Projects[0]; p.ProjectID != "abc-test-1" || !p.Created || p.BillingStatus != BillingStatusLinked || len(p.ServicesEnabled) != 1 {
+		t.Errorf("got project result %+v", p)
+	}
+	// The receiver verifies the HMAC-SHA256 of the payload with the shared secret.
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if got, want := webhook.signatures[1], "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+}
+
+func TestPostResultToWebhookDoesNotRetryClientErrors(t *testing.T) {
+	webhook, url := newFakeWebhook(t, 10, http.StatusBadRequest)
+	o := newWebhookRunOptions(url)
+	o.webhookSecret = nil
+
+	err := postResultToWebhook(context.Background(), o, &Result{})
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("got error %v, want the 400 reported", err)
+	}
+	if len(webhook.bodies) != 1 {
+		t.Errorf("got %d requests, want 1", len(webhook.bodies))
+	}
+	if webhook.signatures[0] != "" {
+		t.Errorf("expected no signature without a secret, got %q", webhook.signatures[0])
+	}
+}
+
+func TestRunConfigPostsErrorToWebhook(t *testing.T) {
+	webhook, url := newFakeWebhook(t, 0, 0)
+
+	err := runConfig(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"), newWebhookRunOptions(url))
+	if err == nil {
+		t.Fatalf("expected an error for a missing config")
+	}
+	if len(webhook.bodies) != 1 {
+		t.Fatalf("got %d requests, want the result posted once", len(webhook.bodies))
+	}
+	var got Result
+	if err := json.Unmarshal(webhook.bodies[0], &got); err != nil {
+		t.Fatalf("payload is not valid JSON: %v", err)
+	}
+	if got.Error == "" {
+		t.Errorf("expected the run's error in the payload, got %s", webhook.bodies[0])
+	}
+}
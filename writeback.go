@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// WriteBackServices updates the services list in the config file to match the services enabled on the project.
+// The original file is kept as a .bak backup.
+func (p *ProjectManager) WriteBackServices(ctx context.Context, projectName string, configPath string) error {
+	log := klog.FromContext(ctx)
+
+	if filepath.Ext(configPath) == ".json" {
+		return fmt.Errorf("-write-back only supports YAML config files, not %q", configPath)
+	}
+
+	enabledServices, err := p.getEnabledServices(ctx, projectName)
+	if err != nil {
+		return err
+	}
+	var services []string
+	for service, enabled := range enabledServices {
+		if enabled {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+
+	original, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("error reading config file %q: %w", configPath, err)
+	}
+
+	backupPath := configPath + ".bak"
+	if err := os.WriteFile(backupPath, original, 0644); err != nil {
+		return fmt.Errorf("error writing backup %q: %w", backupPath, err)
+	}
+
+	updated := replaceServicesList(string(original), services)
+	if err := os.WriteFile(configPath, []byte(updated), 0644); err != nil {
+		return fmt.Errorf("error writing config file %q: %w", configPath, err)
+	}
+	log.Info("wrote enabled services back to config", "project", projectName, "path", configPath, "backup", backupPath, "count", len(services))
+	return nil
+}
+
+var topLevelServicesKey = regexp.MustCompile(`^services:`)
+
+// replaceServicesList replaces the top-level services list in the YAML document with services.
+// We edit the text rather than re-marshaling, so that comments and formatting elsewhere in the file are preserved.
+// If there is no top-level services key, one is appended.
+func replaceServicesList(doc string, services []string) string {
+	var list strings.Builder
+	list.WriteString("services:\n")
+	for _, service := range services {
+		list.WriteString("  - " + strconv.Quote(service) + "\n")
+	}
+
+	lines := strings.SplitAfter(doc, "\n")
+	start := -1
+	for i, line := range lines {
+		if topLevelServicesKey.MatchString(line) {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		if doc != "" && !strings.HasSuffix(doc, "\n") {
+			doc += "\n"
+		}
+		return doc + list.String()
+	}
+
+	// The list continues while lines are indented, are list items, or are blank.
+	end := start + 1
+	for end < len(lines) {
+		line := lines[end]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "-") {
+			end++
+			continue
+		}
+		break
+	}
+	// Leave trailing blank lines in place, they separate the list from the next key.
+	for end > start+1 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+
+	return strings.Join(lines[:start], "") + list.String() + strings.Join(lines[end:], "")
+}
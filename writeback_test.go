@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceServicesList(t *testing.T) {
+	services := []string{"compute.googleapis.com", "storage.googleapis.com"}
+	wantList := "services:\n  - \"compute.googleapis.com\"\n  - \"storage.googleapis.com\"\n"
+
+	grid := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "replaces the list, keeping comments and other keys",
+			doc:  "# Test project\nnamePattern: abc-test-1 # the ID\nservices:\n- pubsub.googleapis.com\n  # indented comment\n- compute.googleapis.com\n\nlabels:\n  team: infra\n",
+			want: "# Test project\nnamePattern: abc-test-1 # the ID\n" + wantList + "\nlabels:\n  team: infra\n",
+		},
+		{
+			name: "indented list at the end of the file",
+			doc:  "namePattern: abc-test-1\nservices:\n  - pubsub.googleapis.com\n",
+			want: "namePattern: abc-test-1\n" + wantList,
+		},
+		{
+			name: "nested services keys are not replaced",
+			doc:  "namePattern: abc-test-1\nserviceGroups:\n- name: data\n  services:\n  - bigquery.googleapis.com\n",
+			want: "namePattern: abc-test-1\nserviceGroups:\n- name: data\n  services:\n  - bigquery.googleapis.com\n" + wantList,
+		},
+		{
+			name: "appended when missing, without a trailing newline",
+			doc:  "namePattern: abc-test-1",
+			want: "namePattern: abc-test-1\n" + wantList,
+		},
+	}
+	for _, g := range grid {
+		if got := replaceServicesList(g.doc, services); got != g.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", g.name, got, g.want)
+		}
+	}
+}
+
+func TestWriteBackServices(t *testing.T) {
+	su, suClient := newFakeServiceUsage(t)
+	su.enabled["storage.googleapis.com"] = true
+	su.enabled["compute.googleapis.com"] = true
+
+	original := "namePattern: abc-test-1 # keep me\nservices:\n- pubsub.googleapis.com\n"
+	configPath := filepath.Join(t.TempDir(), "project.yaml")
+	if err := os.WriteFile(configPath, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestProjectManager(t, &Config{}, nil, suClient)
+	if err := p.WriteBackServices(context.Background(), "abc-test-1", configPath); err != nil {
+		t.Fatalf("WriteBackServices: %v", err)
+	}
+
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "namePattern: abc-test-1 # keep me\nservices:\n  - \"compute.googleapis.com\"\n  - \"storage.googleapis.com\"\n"
+	if string(b) != want {
+		t.Errorf("got config:\n%s\nwant:\n%s", b, want)
+	}
+
+	backup, err := os.ReadFile(configPath + ".bak")
+	if err != nil {
+		t.Fatalf("expected a backup: %v", err)
+	}
+	if string(backup) != original {
+		t.Errorf("got backup %q, want the original %q", backup, original)
+	}
+
+	// The rewritten file is still a valid config with the enabled services.
+	c, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(c.Services) != 2 || c.NamePattern != "abc-test-1" {
+		t.Errorf("got config %+v", c)
+	}
+
+	if err := p.WriteBackServices(context.Background(), "abc-test-1", filepath.Join(t.TempDir(), "project.json")); err == nil {
+		t.Errorf("expected an error writing back to a json config")
+	}
+}